@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/pem"
 	"fmt"
 	"os"
 	"time"
@@ -22,11 +23,16 @@ func healthcheck() error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	tlsOptions, err := localTLSOptions(cfg)
+	if err != nil {
+		return fmt.Errorf("getting TLS options: %w", err)
+	}
+
 	cl, close, err := connection.Dial(
 		ctx,
 		"localhost:"+cfg.Port,
 		cfg.ManageAuthPasswordFile,
-		false,
+		tlsOptions,
 	)
 	if err != nil {
 		return fmt.Errorf("connecting to gRPC server: %w", err)
@@ -51,3 +57,25 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// localTLSOptions returns the options for the connection to the local server.
+// If the server terminates TLS itself, its own certificate is pinned, so the
+// host names of the certificate do not matter.
+func localTLSOptions(cfg *server.Config) (connection.TLSOptions, error) {
+	enabled, err := cfg.TLSEnabled()
+	if err != nil {
+		return connection.TLSOptions{}, err
+	}
+	if !enabled {
+		return connection.TLSOptions{Disabled: true}, nil
+	}
+	content, err := os.ReadFile(cfg.ManageTLSCertFile)
+	if err != nil {
+		return connection.TLSOptions{}, fmt.Errorf("reading certificate: %w", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return connection.TLSOptions{}, fmt.Errorf("no PEM encoded certificate found in %q", cfg.ManageTLSCertFile)
+	}
+	return connection.TLSOptions{Fingerprint: connection.Fingerprint(block.Bytes)}, nil
+}
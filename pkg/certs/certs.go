@@ -0,0 +1,30 @@
+package certs
+
+import (
+	"github.com/spf13/cobra"
+)
+
+const (
+	// CertsHelp contains the short help text for the command.
+	CertsHelp = "Inspects and issues certificates using the files created by the setup command"
+
+	// CertsHelpExtra contains the long help text for the command without the
+	// headline.
+	CertsHelpExtra = `See help text for the respective commands for more information.`
+)
+
+// Cmd returns the subcommand.
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "certs",
+		Short: CertsHelp,
+		Long:  CertsHelp + "\n\n" + CertsHelpExtra,
+	}
+
+	cmd.AddCommand(
+		checkCmd(),
+		issueClientCmd(),
+	)
+
+	return cmd
+}
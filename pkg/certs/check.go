@@ -0,0 +1,304 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// CheckHelp contains the short help text for the command.
+	CheckHelp = "Checks the certificate for local HTTPS"
+
+	// CheckHelpExtra contains the long help text for the command without the
+	// headline.
+	CheckHelpExtra = `This command parses the files cert_crt and cert_key in the secrets directory
+in the given directory. It checks that the key belongs to the certificate, shows
+subject, subject alternative names, issuer, expiry and SHA-256 fingerprint of
+the certificate and checks that the certificate is valid for the hosts in
+SYSTEM_URL and EXTERNAL_ADDRESS of the merged config. The fingerprint can be
+given to the fingerprint flag of the commands connecting to the manage service.
+
+The exit codes follow the conventions of monitoring plugins, so the command can
+be used in cron jobs or monitoring systems:
+
+  0  OK
+  1  WARNING: the certificate expires within the warning window
+  2  CRITICAL: the certificate is expired or not yet valid, the key does not
+     belong to the certificate or a host is not covered by the certificate
+  3  UNKNOWN: the files can not be read or parsed`
+
+	defaultWarnDays = 30
+)
+
+// Exit codes of the check command.
+const (
+	StatusOK = iota
+	StatusWarning
+	StatusCritical
+	StatusUnknown
+)
+
+var statusNames = map[int]string{
+	StatusOK:       "OK",
+	StatusWarning:  "WARNING",
+	StatusCritical: "CRITICAL",
+	StatusUnknown:  "UNKNOWN",
+}
+
+// hostEnvVars are the environment variables which contain the hosts the
+// certificate has to be valid for.
+var hostEnvVars = []string{"SYSTEM_URL", "EXTERNAL_ADDRESS"}
+
+func checkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check directory",
+		Short: CheckHelp,
+		Long:  CheckHelp + "\n\n" + CheckHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	configFileNames := config.FlagConfig(cmd)
+	warnDays := cmd.Flags().Int("warn-days", defaultWarnDays, "warn if the certificate expires within this number of days")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		configFiles, err := config.ReadConfigFiles(*configFileNames)
+		if err != nil {
+			return fehler.ExitCode(StatusUnknown, err)
+		}
+		cfg, err := config.NewYmlConfig(configFiles)
+		if err != nil {
+			return fehler.ExitCode(StatusUnknown, fmt.Errorf("creating new YML config object: %w", err))
+		}
+
+		result, err := Check(args[0], cfg, time.Now(), time.Duration(*warnDays)*24*time.Hour)
+		if err != nil {
+			return fehler.ExitCode(StatusUnknown, fmt.Errorf("checking certificate: %w", err))
+		}
+
+		result.Print(cmd.OutOrStdout())
+		if status := result.Status(); status != StatusOK {
+			return fehler.ExitCode(status, fmt.Errorf("certificate check %s: %s", statusNames[status], result.Problems[0].Message))
+		}
+		return nil
+	}
+	return cmd
+}
+
+// Problem is a finding of the certificate check.
+type Problem struct {
+	Status  int
+	Message string
+}
+
+// Result contains the parsed certificate and all problems found by Check.
+type Result struct {
+	Certificate *x509.Certificate
+	Now         time.Time
+	Problems    []Problem
+}
+
+// Status returns the worst status of all problems or StatusOK if there are
+// no problems.
+func (r *Result) Status() int {
+	status := StatusOK
+	for _, p := range r.Problems {
+		if p.Status > status {
+			status = p.Status
+		}
+	}
+	return status
+}
+
+func (r *Result) add(status int, format string, a ...interface{}) {
+	r.Problems = append(r.Problems, Problem{Status: status, Message: fmt.Sprintf(format, a...)})
+}
+
+// Print writes a human readable report of the result to w.
+func (r *Result) Print(w io.Writer) {
+	c := r.Certificate
+	var ips []string
+	for _, ip := range c.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	fmt.Fprintf(w, "Subject:      %s\n", c.Subject)
+	fmt.Fprintf(w, "DNS names:    %s\n", strings.Join(c.DNSNames, ", "))
+	fmt.Fprintf(w, "IP addresses: %s\n", strings.Join(ips, ", "))
+	fmt.Fprintf(w, "Issuer:       %s\n", c.Issuer)
+	fmt.Fprintf(w, "Not before:   %s\n", c.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "Not after:    %s (%d days left)\n", c.NotAfter.UTC().Format(time.RFC3339), daysLeft(c, r.Now))
+	fmt.Fprintf(w, "Fingerprint:  SHA256 %s\n", connection.Fingerprint(c.Raw))
+
+	if len(r.Problems) == 0 {
+		fmt.Fprintln(w, "OK: certificate is valid")
+		return
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintf(w, "%s: %s\n", statusNames[p.Status], p.Message)
+	}
+}
+
+// Check checks the certificate and key in the secrets directory in the given
+// directory. It returns an error if the files can not be read or parsed. All
+// other findings are reported as problems in the result.
+func Check(dir string, cfg *config.YmlConfig, now time.Time, warnWindow time.Duration) (*Result, error) {
+	secrDir := path.Join(dir, setup.SecretsDirName)
+	cert, err := readCert(path.Join(secrDir, setup.CertCertName))
+	if err != nil {
+		return nil, err
+	}
+	key, err := readKey(path.Join(secrDir, setup.CertKeyName))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Result{Certificate: cert, Now: now}
+
+	if !publicKeysEqual(cert.PublicKey, key.Public()) {
+		r.add(StatusCritical, "key in %s does not belong to the certificate", setup.CertKeyName)
+	}
+
+	switch {
+	case now.After(cert.NotAfter):
+		r.add(StatusCritical, "certificate expired on %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	case now.Before(cert.NotBefore):
+		r.add(StatusCritical, "certificate is not valid before %s", cert.NotBefore.UTC().Format(time.RFC3339))
+	case now.Add(warnWindow).After(cert.NotAfter):
+		r.add(StatusWarning, "certificate expires in %d days on %s", daysLeft(cert, now), cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	for _, host := range configuredHosts(cfg) {
+		if err := cert.VerifyHostname(host); err != nil {
+			r.add(StatusCritical, "certificate is not valid for host %q", host)
+		}
+	}
+
+	return r, nil
+}
+
+func readCert(p string) (*x509.Certificate, error) {
+	content, err := shared.ReadSecretFile(p)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("file %q does not contain a PEM encoded certificate", p)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate %q: %w", p, err)
+	}
+	return cert, nil
+}
+
+// readKey reads a PEM encoded private key in the PKCS #8, PKCS #1 or SEC 1
+// format.
+func readKey(p string) (crypto.Signer, error) {
+	content, err := shared.ReadSecretFile(p)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("file %q does not contain a PEM encoded key", p)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing key %q: %w", p, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T in %q", key, p)
+	}
+	return signer, nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	switch k := a.(type) {
+	case *rsa.PublicKey:
+		return k.Equal(b)
+	case *ecdsa.PublicKey:
+		return k.Equal(b)
+	case ed25519.PublicKey:
+		return k.Equal(b)
+	default:
+		return false
+	}
+}
+
+// configuredHosts returns the hosts given in SYSTEM_URL and EXTERNAL_ADDRESS
+// in the default environment and the environment of all services.
+func configuredHosts(cfg *config.YmlConfig) []string {
+	envs := []map[string]string{cfg.DefaultEnvironment}
+	for _, s := range cfg.Services {
+		envs = append(envs, s.Environment)
+	}
+
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, env := range envs {
+		for _, name := range hostEnvVars {
+			host := hostname(env[name])
+			if host == "" || seen[host] {
+				continue
+			}
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// hostname returns the host of the given URL or address. The scheme and port
+// are optional.
+func hostname(v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return ""
+	}
+	if !strings.Contains(v, "://") {
+		v = "https://" + v
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return ""
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+func daysLeft(cert *x509.Certificate, now time.Time) int {
+	return int(cert.NotAfter.Sub(now).Hours() / 24)
+}
@@ -0,0 +1,175 @@
+package certs_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/certs"
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+)
+
+func TestCheck(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	customConfig := []byte(`---
+certificate:
+  dnsNames:
+  - localhost
+  - openslides.example.com
+  validityDays: 90
+`)
+	if err := setup.Setup(testDir, false, nil, [][]byte{customConfig}, nil); err != nil {
+		t.Fatalf("running Setup() failed with error: %v", err)
+	}
+	cfg, err := config.NewYmlConfig(nil)
+	if err != nil {
+		t.Fatalf("creating config: %v", err)
+	}
+	warn := 30 * 24 * time.Hour
+
+	t.Run("valid certificate", func(t *testing.T) {
+		result, err := certs.Check(testDir, cfg, time.Now(), warn)
+		if err != nil {
+			t.Fatalf("checking certificate: %v", err)
+		}
+		if status := result.Status(); status != certs.StatusOK {
+			t.Fatalf("wrong status, expected OK, got %d with problems %v", status, result.Problems)
+		}
+
+		buf := new(bytes.Buffer)
+		result.Print(buf)
+		for _, expected := range []string{"DNS names:    localhost, openslides.example.com", "O=OpenSlides", "OK: certificate is valid"} {
+			if !strings.Contains(buf.String(), expected) {
+				t.Fatalf("output does not contain %q, got\n%s", expected, buf.String())
+			}
+		}
+	})
+
+	t.Run("certificate expires within the warning window", func(t *testing.T) {
+		result, err := certs.Check(testDir, cfg, time.Now().AddDate(0, 0, 80), warn)
+		if err != nil {
+			t.Fatalf("checking certificate: %v", err)
+		}
+		if status := result.Status(); status != certs.StatusWarning {
+			t.Fatalf("wrong status, expected WARNING, got %d with problems %v", status, result.Problems)
+		}
+	})
+
+	t.Run("expired certificate", func(t *testing.T) {
+		result, err := certs.Check(testDir, cfg, time.Now().AddDate(0, 0, 100), warn)
+		if err != nil {
+			t.Fatalf("checking certificate: %v", err)
+		}
+		if status := result.Status(); status != certs.StatusCritical {
+			t.Fatalf("wrong status, expected CRITICAL, got %d with problems %v", status, result.Problems)
+		}
+	})
+
+	t.Run("host not covered by certificate", func(t *testing.T) {
+		customCfg, err := config.NewYmlConfig([][]byte{[]byte(`---
+defaultEnvironment:
+  SYSTEM_URL: https://openslides.example.com
+services:
+  proxy:
+    environment:
+      EXTERNAL_ADDRESS: other.example.com:443
+`)})
+		if err != nil {
+			t.Fatalf("creating config: %v", err)
+		}
+		result, err := certs.Check(testDir, customCfg, time.Now(), warn)
+		if err != nil {
+			t.Fatalf("checking certificate: %v", err)
+		}
+		if len(result.Problems) != 1 || !strings.Contains(result.Problems[0].Message, `"other.example.com"`) {
+			t.Fatalf("expected one problem for other.example.com, got %v", result.Problems)
+		}
+		if status := result.Status(); status != certs.StatusCritical {
+			t.Fatalf("wrong status, expected CRITICAL, got %d", status)
+		}
+	})
+
+	t.Run("key does not belong to certificate", func(t *testing.T) {
+		otherDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(otherDir)
+		if err := setup.Setup(otherDir, false, nil, nil, nil); err != nil {
+			t.Fatalf("running Setup() failed with error: %v", err)
+		}
+		key, err := os.ReadFile(path.Join(testDir, setup.SecretsDirName, setup.CertKeyName))
+		if err != nil {
+			t.Fatalf("reading key: %v", err)
+		}
+		if err := os.WriteFile(path.Join(otherDir, setup.SecretsDirName, setup.CertKeyName), key, 0600); err != nil {
+			t.Fatalf("writing key: %v", err)
+		}
+
+		result, err := certs.Check(otherDir, cfg, time.Now(), warn)
+		if err != nil {
+			t.Fatalf("checking certificate: %v", err)
+		}
+		if len(result.Problems) != 1 || !strings.Contains(result.Problems[0].Message, "does not belong") {
+			t.Fatalf("expected one problem for the key, got %v", result.Problems)
+		}
+	})
+
+	t.Run("missing files", func(t *testing.T) {
+		if _, err := certs.Check(path.Join(testDir, "does-not-exist"), cfg, time.Now(), warn); err == nil {
+			t.Fatalf("checking certificate in missing directory should fail")
+		}
+	})
+}
+
+func TestCheckCmd(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	if err := setup.Setup(testDir, false, nil, [][]byte{[]byte("certificate:\n  validityDays: 10\n")}, nil); err != nil {
+		t.Fatalf("running Setup() failed with error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"default warning window", []string{"check", testDir}, certs.StatusWarning},
+		{"small warning window", []string{"check", testDir, "--warn-days", "5"}, certs.StatusOK},
+		{"missing directory", []string{"check", path.Join(testDir, "does-not-exist")}, certs.StatusUnknown},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := certs.Cmd()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(new(bytes.Buffer))
+			err := cmd.Execute()
+
+			code := certs.StatusOK
+			var errExit interface {
+				ExitCode() int
+			}
+			if errors.As(err, &errExit) {
+				code = errExit.ExitCode()
+			} else if err != nil {
+				t.Fatalf("got error without exit code: %v", err)
+			}
+			if code != tt.code {
+				t.Fatalf("wrong exit code, expected %d, got %d (error: %v)", tt.code, code, err)
+			}
+		})
+	}
+}
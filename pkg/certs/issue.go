@@ -0,0 +1,67 @@
+package certs
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// IssueClientHelp contains the short help text for the command.
+	IssueClientHelp = "Issues a client certificate for the manage service"
+
+	// IssueClientHelpExtra contains the long help text for the command without
+	// the headline.
+	IssueClientHelpExtra = `This command creates a key and a client certificate for the operator with the
+given name. The certificate is signed by the local CA in the secrets directory
+of the setup directory (see certificate.createCA), so the manage service accepts
+it if manageAuth.clientCertificates is true. The files NAME.crt and NAME.key are
+written to the output directory. Give them to the operator who uses them with
+the flags client-cert and client-key.
+
+The subject of the certificate is printed. Add it to manageAuth.operators to
+allow only listed operators. Remove it from there to revoke the certificate.`
+
+	defaultClientValidityDays = 365
+)
+
+func issueClientCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "issue-client NAME",
+		Short: IssueClientHelp,
+		Long:  IssueClientHelp + "\n\n" + IssueClientHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	dir := cmd.Flags().StringP("directory", "d", ".", "setup directory with the secrets directory containing the local CA")
+	out := cmd.Flags().StringP("output", "o", ".", "directory for the certificate and the key")
+	force := cmd.Flags().BoolP("force", "f", false, "overwrite existing files")
+	validityDays := cmd.Flags().Int("validity-days", defaultClientValidityDays, "number of days the certificate is valid")
+	keyType := cmd.Flags().String("key-type", config.KeyTypeECDSA, fmt.Sprintf("key type of the certificate, one of %q, %q and %q", config.KeyTypeECDSA, config.KeyTypeRSA, config.KeyTypeEd25519))
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		secrDir := path.Join(*dir, setup.SecretsDirName)
+		cert, err := setup.IssueClientCert(secrDir, *out, name, *force, *keyType, *validityDays)
+		if err != nil {
+			return fmt.Errorf("issuing client certificate: %w", err)
+		}
+
+		w := cmd.OutOrStdout()
+		fmt.Fprintf(w, "Certificate: %s\n", path.Join(*out, name+".crt"))
+		fmt.Fprintf(w, "Key:         %s\n", path.Join(*out, name+".key"))
+		fmt.Fprintf(w, "Subject:     %s\n", cert.Subject)
+		fmt.Fprintf(w, "Not after:   %s\n", cert.NotAfter.UTC().Format(time.RFC3339))
+		fmt.Fprintf(w, "Fingerprint: SHA256 %s\n", connection.Fingerprint(cert.Raw))
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Add the operator to your YAML configuration file to allow only listed operators:")
+		fmt.Fprintf(w, "\nmanageAuth:\n  operators:\n    %s: %q\n", name, cert.Subject.String())
+		return nil
+	}
+	return cmd
+}
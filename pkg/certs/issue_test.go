@@ -0,0 +1,109 @@
+package certs_test
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/certs"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+)
+
+func TestIssueClientCmd(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	if err := setup.Setup(testDir, false, nil, [][]byte{[]byte("certificate:\n  createCA: true\n")}, nil); err != nil {
+		t.Fatalf("running Setup() failed with error: %v", err)
+	}
+	outDir := path.Join(testDir, "clients")
+
+	t.Run("issuing client certificate", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		cmd := certs.Cmd()
+		cmd.SetArgs([]string{"issue-client", "alice", "--directory", testDir, "--output", outDir})
+		cmd.SetOut(out)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing issue-client subcommand: %v", err)
+		}
+		if !strings.Contains(out.String(), `alice: "CN=alice,O=OpenSlides"`) {
+			t.Fatalf("output does not contain the operator, got\n%s", out.String())
+		}
+
+		cert := readTestCert(t, path.Join(outDir, "alice.crt"))
+		ca := readTestCert(t, path.Join(testDir, setup.SecretsDirName, setup.CACertName))
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+		opts := x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+		if _, err := cert.Verify(opts); err != nil {
+			t.Fatalf("verifying client certificate with local CA: %v", err)
+		}
+
+		info, err := os.Stat(path.Join(outDir, "alice.key"))
+		if err != nil {
+			t.Fatalf("reading key file: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Fatalf("wrong permissions of key file, expected 0600, got %o", perm)
+		}
+	})
+
+	t.Run("issuing client certificate again", func(t *testing.T) {
+		cmd := certs.Cmd()
+		cmd.SetArgs([]string{"issue-client", "alice", "--directory", testDir, "--output", outDir})
+		cmd.SetOut(new(bytes.Buffer))
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("issuing an existing client certificate without force should fail")
+		}
+		cmd.SetArgs([]string{"issue-client", "alice", "--directory", testDir, "--output", outDir, "--force"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing issue-client subcommand with force: %v", err)
+		}
+	})
+
+	t.Run("issuing client certificate with invalid name", func(t *testing.T) {
+		cmd := certs.Cmd()
+		cmd.SetArgs([]string{"issue-client", "../alice", "--directory", testDir, "--output", outDir})
+		cmd.SetOut(new(bytes.Buffer))
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("issuing client certificate with invalid name should fail")
+		}
+	})
+
+	t.Run("issuing client certificate without local CA", func(t *testing.T) {
+		dir := path.Join(testDir, "without-ca")
+		if err := setup.Setup(dir, false, nil, nil, nil); err != nil {
+			t.Fatalf("running Setup() failed with error: %v", err)
+		}
+		cmd := certs.Cmd()
+		cmd.SetArgs([]string{"issue-client", "bob", "--directory", dir, "--output", outDir})
+		cmd.SetOut(new(bytes.Buffer))
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("issuing client certificate without local CA should fail")
+		}
+	})
+}
+
+func readTestCert(t *testing.T, p string) *x509.Certificate {
+	t.Helper()
+	content, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("reading certificate %q: %v", p, err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		t.Fatalf("no PEM data found in %q", p)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("parsing certificate %q: %v", p, err)
+	}
+	return cert
+}
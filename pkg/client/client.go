@@ -4,12 +4,16 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/OpenSlides/openslides-manage-service/pkg/certs"
 	"github.com/OpenSlides/openslides-manage-service/pkg/checkserver"
 	"github.com/OpenSlides/openslides-manage-service/pkg/config"
 	"github.com/OpenSlides/openslides-manage-service/pkg/createuser"
+	"github.com/OpenSlides/openslides-manage-service/pkg/email"
 	"github.com/OpenSlides/openslides-manage-service/pkg/get"
 	"github.com/OpenSlides/openslides-manage-service/pkg/initialdata"
 	"github.com/OpenSlides/openslides-manage-service/pkg/migrations"
+	"github.com/OpenSlides/openslides-manage-service/pkg/preflight"
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
 	"github.com/OpenSlides/openslides-manage-service/pkg/set"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setpassword"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
@@ -58,6 +62,9 @@ func RootCmd() *cobra.Command {
 		setup.Cmd(),
 		config.Cmd(),
 		config.CmdCreateDefault(),
+		secrets.Cmd(),
+		certs.Cmd(),
+		preflight.Cmd(),
 		checkserver.Cmd(),
 		initialdata.Cmd(),
 		migrations.Cmd(),
@@ -66,6 +73,7 @@ func RootCmd() *cobra.Command {
 		get.Cmd(),
 		set.Cmd(),
 		version.Cmd(),
+		email.Cmd(),
 	)
 
 	return cmd
@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"text/template"
 
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
 	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
 	"github.com/ghodss/yaml"
 	"github.com/imdario/mergo"
@@ -19,15 +22,60 @@ import (
 //go:embed default-docker-compose.yml
 var defaultDockerComposeYml []byte
 
+//go:embed default-docker-stack.yml
+var defaultDockerStackYml []byte
+
+//go:embed default-kubernetes.yml
+var defaultKubernetesYml []byte
+
 //go:embed default-config.yml
 var defaultConfig []byte
 
+const (
+	// TargetCompose is the target for Docker Compose. It is the default target.
+	TargetCompose = "compose"
+
+	// TargetSwarm is the target for Docker Swarm stacks.
+	TargetSwarm = "swarm"
+
+	// TargetKubernetes is the target for Kubernetes manifests.
+	TargetKubernetes = "kubernetes"
+)
+
+const (
+	// KeyTypeECDSA is the key type for ECDSA P-256 keys. It is the default key
+	// type for the self-signed certificate.
+	KeyTypeECDSA = "ecdsa"
+
+	// KeyTypeRSA is the key type for 3072 bit RSA keys.
+	KeyTypeRSA = "rsa"
+
+	// KeyTypeEd25519 is the key type for Ed25519 keys.
+	KeyTypeEd25519 = "ed25519"
+)
+
+// defaultFilenames contains the name of the generated file for each target if
+// no filename is configured.
+var defaultFilenames = map[string]string{
+	TargetCompose:    "docker-compose.yml",
+	TargetSwarm:      "docker-stack.yml",
+	TargetKubernetes: "kubernetes.yml",
+}
+
 const (
 	// ConfigHelp contains the short help text for the command.
 	ConfigHelp = "(Re)creates the container configuration YAML file for using Docker Compose or Docker Swarm"
 
 	// ConfigHelpExtra contains the long help text for the command without the headline.
-	ConfigHelpExtra = `This command (re)creates the container configuration YAML file in the given directory.`
+	ConfigHelpExtra = `This command (re)creates the container configuration YAML file in the given directory.
+Use the target "swarm" to get a stack file for Docker Swarm. It uses external
+secrets which can be created with the command "secrets push-swarm". Use the
+target "kubernetes" to get Kubernetes manifests instead. In this case the
+secrets directory created by the setup command must exist because the secrets
+are embedded into the manifests.
+
+Use the inventory flag instead of the directory to (re)create the files of all
+instances of an inventory file. See the setup command for the format.`
 
 	// ConfigCreateDefaultHelp contains the short help text for the command.
 	ConfigCreateDefaultHelp = "(Re)creates the default setup configuration YAML file"
@@ -42,36 +90,73 @@ func Cmd() *cobra.Command {
 		Use:   "config directory",
 		Short: ConfigHelp,
 		Long:  ConfigHelp + "\n\n" + ConfigHelpExtra,
-		Args:  cobra.ExactArgs(1),
 	}
 
+	cmd.AddCommand(
+		cmdValidate(),
+		cmdDiff(),
+		cmdShow(),
+		cmdPin(),
+		cmdVerifyPins(),
+		cmdUpgrade(),
+	)
+
 	tplFileName := FlagTpl(cmd)
 	configFileNames := FlagConfig(cmd)
+	target := FlagTarget(cmd)
+	force := cmd.Flags().BoolP("force", "f", false, "overwrite the YAML file also if it was changed manually")
+	dryRun := cmd.Flags().Bool("dry-run", false, "do not write the file but print the changes like the diff subcommand")
+	inventory := FlagInventory(cmd)
+	cmd.Args = ArgsDirectoryOrInventory(inventory)
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		dir := args[0]
+		tplFile, err := ReadTplFile(*tplFileName)
+		if err != nil {
+			return err
+		}
+
+		configFiles, err := ReadConfigFiles(*configFileNames)
+		if err != nil {
+			return err
+		}
 
-		var tplFile []byte
-		if *tplFileName != "" {
-			fc, err := os.ReadFile(*tplFileName)
+		if *inventory != "" {
+			inv, err := ReadInventory(*inventory)
 			if err != nil {
-				return fmt.Errorf("reading file %q: %w", *tplFileName, err)
+				return err
+			}
+			instanceConfigFiles := func(instance Instance) [][]byte {
+				c := append(append([][]byte{}, configFiles...), instance.ConfigFiles()...)
+				if *target != "" {
+					c = append(c, TargetConfig(*target))
+				}
+				return c
 			}
-			tplFile = fc
+			if *dryRun {
+				return diffInventory(cmd.OutOrStdout(), inv, tplFile, instanceConfigFiles)
+			}
+			return RunInventory(cmd.OutOrStdout(), inv, func(instance Instance) error {
+				return Config(instance.Directory, *force, tplFile, instanceConfigFiles(instance))
+			})
 		}
 
-		var configFiles [][]byte
-		if len(*configFileNames) > 0 {
-			for _, configFileName := range *configFileNames {
-				fc, err := os.ReadFile(configFileName)
-				if err != nil {
-					return fmt.Errorf("reading file %q: %w", configFileName, err)
-				}
-				configFiles = append(configFiles, fc)
+		if *target != "" {
+			configFiles = append(configFiles, TargetConfig(*target))
+		}
+
+		dir := args[0]
+		if *dryRun {
+			changed, err := Diff(cmd.OutOrStdout(), dir, tplFile, configFiles)
+			if err != nil {
+				return fmt.Errorf("running Diff(): %w", err)
+			}
+			if changed {
+				return fehler.ExitCode(2, fmt.Errorf("container configuration YAML file would change"))
 			}
+			return nil
 		}
 
-		if err := Config(dir, tplFile, configFiles); err != nil {
+		if err := Config(dir, *force, tplFile, configFiles); err != nil {
 			return fmt.Errorf("running Config(): %w", err)
 		}
 		return nil
@@ -89,10 +174,59 @@ func FlagConfig(cmd *cobra.Command) *[]string {
 	return cmd.Flags().StringArrayP("config", "c", nil, "custom YAML config file, can be use more then once, ordering is important")
 }
 
+// ReadTplFile reads the given custom template file. It returns nil if the
+// filename is empty so that the default template is used.
+func ReadTplFile(tplFileName string) ([]byte, error) {
+	if tplFileName == "" {
+		return nil, nil
+	}
+	fc, err := os.ReadFile(tplFileName)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %q: %w", tplFileName, err)
+	}
+	return fc, nil
+}
+
+// ReadConfigFiles reads and validates the given setup configuration YAML files.
+// Relative paths in ${FILE:path} references are resolved against the directory
+// of the respective file.
+func ReadConfigFiles(configFileNames []string) ([][]byte, error) {
+	var configFiles [][]byte
+	for _, configFileName := range configFileNames {
+		fc, err := os.ReadFile(configFileName)
+		if err != nil {
+			return nil, fmt.Errorf("reading file %q: %w", configFileName, err)
+		}
+		if err := Validate(configFileName, fc); err != nil {
+			return nil, err
+		}
+		fc, err = absFileReferences(fc, filepath.Dir(configFileName))
+		if err != nil {
+			return nil, fmt.Errorf("resolving file references of %q: %w", configFileName, err)
+		}
+		configFiles = append(configFiles, fc)
+	}
+	return configFiles, nil
+}
+
+// FlagTarget setups the target flag to the given cobra command.
+func FlagTarget(cmd *cobra.Command) *string {
+	return cmd.Flags().String("target", "", fmt.Sprintf("target of the generated file, one of %q, %q and %q, overrides the target given in the config files", TargetCompose, TargetSwarm, TargetKubernetes))
+}
+
+// TargetConfig returns a YAML config which only sets the given target. It can
+// be appended to the config files so that the value of the target flag takes
+// precedence over all config files.
+func TargetConfig(target string) []byte {
+	return []byte(fmt.Sprintf("---\ntarget: %q\n", target))
+}
+
 // Config rebuilds the YAML file for using Docker Compose or Docker Swarm.
 //
-// A custom template for the YAML file and YAML configs can be provided.
-func Config(dir string, tplFile []byte, configFiles [][]byte) error {
+// A custom template for the YAML file and YAML configs can be provided. If the
+// YAML file was changed after it was generated, an error wrapping
+// ErrManualEdit is returned unless force is true.
+func Config(dir string, force bool, tplFile []byte, configFiles [][]byte) error {
 	// Create directory
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return fmt.Errorf("creating directory at %q: %w", dir, err)
@@ -104,18 +238,76 @@ func Config(dir string, tplFile []byte, configFiles [][]byte) error {
 		return fmt.Errorf("creating new YML config object: %w", err)
 	}
 
-	if err := CreateYmlFile(dir, true, tplFile, cfg); err != nil {
+	if !force {
+		state, err := loadState(dir)
+		if err != nil {
+			return fmt.Errorf("loading state: %w", err)
+		}
+		if err := state.checkUnchanged(dir, cfg.Filename); err != nil {
+			return err
+		}
+	}
+
+	if err := CreateYmlFile(dir, true, tplFile, configFiles, cfg); err != nil {
+		return fmt.Errorf("creating YAML file at %q: %w", dir, err)
+	}
+
+	return nil
+}
+
+// CreateYmlFile builds the YAML file at the given directory and records it in
+// the state file. Use a truthy value for force to override an existing file.
+// The setup configuration YAML files are only used for the state file.
+func CreateYmlFile(dir string, force bool, tplFile []byte, configFiles [][]byte, cfg *YmlConfig) error {
+	state, err := loadState(dir)
+	if err != nil {
+		return fmt.Errorf("loading state: %w", err)
+	}
+
+	if !force {
+		if _, err := os.Stat(path.Join(dir, cfg.Filename)); err == nil {
+			// No force-mode and file already exists, so skip this file.
+			return nil
+		}
+	}
+
+	content, err := RenderYmlFile(dir, tplFile, cfg)
+	if err != nil {
+		return fmt.Errorf("rendering YAML file: %w", err)
+	}
+
+	// Kubernetes manifests embed the secrets, so only the owner may read them.
+	createFile := shared.CreateFile
+	if cfg.Target == TargetKubernetes {
+		createFile = shared.CreatePrivateFile
+	}
+	if err := createFile(dir, true, cfg.Filename, content); err != nil {
 		return fmt.Errorf("creating YAML file at %q: %w", dir, err)
 	}
 
+	state.record(tplFile, configFiles, cfg.Filename, content)
+	if err := WriteState(dir, state); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// CreateYmlFile builds the YAML file at the given directory. Use a truthy value for force
-// to override an existing file.
-func CreateYmlFile(dir string, force bool, tplFile []byte, cfg *YmlConfig) error {
-	if tplFile == nil {
-		tplFile = defaultDockerComposeYml
+// RenderYmlFile executes the template for the YAML file and returns the result
+// without writing it. The directory is used by templates which embed secrets.
+//
+// A custom template is layered over the default template of the target. If it
+// only contains define blocks, these blocks replace the respective blocks of
+// the default template (e. g. service.proxy) and the rest is kept.
+func RenderYmlFile(dir string, tplFile []byte, cfg *YmlConfig) ([]byte, error) {
+	var defaultTpl []byte
+	switch cfg.Target {
+	case TargetSwarm:
+		defaultTpl = defaultDockerStackYml
+	case TargetKubernetes:
+		defaultTpl = defaultKubernetesYml
+	default:
+		defaultTpl = defaultDockerComposeYml
 	}
 
 	marshalContentFunc := func(ws int, v interface{}) (string, error) {
@@ -142,54 +334,128 @@ func CreateYmlFile(dir string, force bool, tplFile []byte, cfg *YmlConfig) error
 	funcMap := template.FuncMap{}
 	funcMap["marshalContent"] = marshalContentFunc
 	funcMap["checkFlag"] = checkFlagFunc
-
-	tmpl, err := template.New("YAML File").Option("missingkey=error").Funcs(funcMap).Parse(string(tplFile))
+	funcMap["quote"] = quoteFunc
+	funcMap["list"] = listFunc
+	funcMap["indent"] = indentFunc
+	funcMap["toYaml"] = toYamlFunc
+	funcMap["default"] = defaultFunc
+	funcMap["env"] = func(name string, service ...string) (string, error) { return envFunc(cfg, name, service...) }
+	funcMap["hasService"] = cfg.HasService
+	funcMap["extraServices"] = func() []namedExtraService { return extraServices(cfg) }
+	funcMap["extraSecrets"] = func() []string { return extraSecrets(cfg) }
+	funcMap["enabledServices"] = func(names ...string) []string { return enabledServices(cfg, names...) }
+	funcMap["usesSecret"] = func(name string) bool { return usesSecret(cfg, name) }
+	funcMap["secretData"] = secretDataFunc(dir)
+	funcMap["swarmServices"] = func() []swarmService { return swarmServices(cfg) }
+	funcMap["swarmSecrets"] = swarmSecrets
+	funcMap["kubernetesWorkloads"] = func() []workload { return kubernetesWorkloads(cfg) }
+	funcMap["kubernetesSecrets"] = workloadSecrets
+	funcMap["digest"] = func(name string) string { return digestSuffix(cfg, name) }
+
+	tmpl, err := template.New("YAML File").Option("missingkey=error").Funcs(funcMap).Parse(string(defaultTpl))
 	if err != nil {
-		return fmt.Errorf("parsing template: %w", err)
+		return nil, fmt.Errorf("parsing default template: %w", err)
+	}
+	if tplFile != nil {
+		if _, err := tmpl.Parse(string(tplFile)); err != nil {
+			return nil, fmt.Errorf("parsing custom template: %w", err)
+		}
 	}
 
 	var res bytes.Buffer
 	if err := tmpl.Execute(&res, cfg); err != nil {
-		return fmt.Errorf("executing template %v: %w", tmpl, err)
+		return nil, fmt.Errorf("executing template %v: %w", tmpl, err)
 	}
 
-	if err := shared.CreateFile(dir, force, cfg.Filename, res.Bytes()); err != nil {
-		return fmt.Errorf("creating YAML file at %q: %w", dir, err)
+	return res.Bytes(), nil
+}
+
+// quoteFunc returns the given string as double quoted scalar which is valid
+// in JSON and YAML.
+func quoteFunc(s string) (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
 	}
+	return string(b), nil
+}
 
-	return nil
+// listFunc returns its arguments as slice so that a template can range over
+// them.
+func listFunc(v ...interface{}) []interface{} {
+	return v
 }
 
 // YmlConfig contains the (merged) configuration for the creation of the Docker
-// Compose YAML file.
+// Compose YAML file. The JSON tags are used by the YAML unmarshaller which
+// converts YAML to JSON first and by the config show command.
 type YmlConfig struct {
-	Filename string `yaml:"filename"`
+	Filename string `yaml:"filename" json:"filename"`
+	Target   string `yaml:"target" json:"target"`
 
-	Host string `yaml:"host"`
-	Port string `yaml:"port"`
+	Host string `yaml:"host" json:"host"`
+	Port string `yaml:"port" json:"port"`
 
-	DisablePostgres  *bool `yaml:"disablePostgres"`
-	DisableDependsOn *bool `yaml:"disableDependsOn"`
-	EnableLocalHTTPS *bool `yaml:"enableLocalHTTPS"`
-	EnableAutoHTTPS  *bool `yaml:"enableAutoHTTPS"`
+	DisablePostgres  *bool `yaml:"disablePostgres" json:"disablePostgres"`
+	DisableDependsOn *bool `yaml:"disableDependsOn" json:"disableDependsOn"`
+	EnableLocalHTTPS *bool `yaml:"enableLocalHTTPS" json:"enableLocalHTTPS"`
+	EnableAutoHTTPS  *bool `yaml:"enableAutoHTTPS" json:"enableAutoHTTPS"`
+	EnableManageTLS  *bool `yaml:"enableManageTLS" json:"enableManageTLS"`
 
-	PostgresContainerUser string `yaml:"postgresContainerUser"`
+	PostgresContainerUser string `yaml:"postgresContainerUser" json:"postgresContainerUser"`
+
+	// Profile disables a predefined set of services, see profiles.
+	Profile string `yaml:"profile" json:"profile,omitempty"`
+
+	Certificate certificate `yaml:"certificate" json:"certificate"`
+
+	ExternalDatabase externalDatabase `yaml:"externalDatabase" json:"externalDatabase"`
+	ExternalRedis    externalRedis    `yaml:"externalRedis" json:"externalRedis"`
+
+	Email email `yaml:"email" json:"email"`
+
+	ManageAuth manageAuth `yaml:"manageAuth" json:"manageAuth"`
 
 	Defaults struct {
-		ContainerRegistry string `yaml:"containerRegistry"`
-		Tag               string `yaml:"tag"`
-	} `yaml:"defaults"`
+		ContainerRegistry string `yaml:"containerRegistry" json:"containerRegistry"`
+		Tag               string `yaml:"tag" json:"tag"`
+	} `yaml:"defaults" json:"defaults"`
+
+	DefaultEnvironment map[string]string `yaml:"defaultEnvironment" json:"defaultEnvironment"`
+
+	Services map[string]service `yaml:"services" json:"services"`
 
-	DefaultEnvironment map[string]string `yaml:"defaultEnvironment"`
+	// ExtraServices contains additional services like backup agents or
+	// monitoring exporters which are rendered after the OpenSlides services.
+	ExtraServices map[string]extraService `yaml:"extraServices" json:"extraServices,omitempty"`
 
-	Services map[string]service `yaml:"services"`
+	// Digests maps service names to image digests like sha256:... which are
+	// appended to the image references. They are usually written by the
+	// config pin command.
+	Digests map[string]string `yaml:"digests" json:"digests,omitempty"`
+}
+
+// certificate contains the options for the self-signed certificate created by
+// the setup command if local HTTPS is enabled.
+type certificate struct {
+	DNSNames       []string `yaml:"dnsNames" json:"dnsNames"`
+	IPAddresses    []string `yaml:"ipAddresses" json:"ipAddresses,omitempty"`
+	ValidityDays   int      `yaml:"validityDays" json:"validityDays"`
+	KeyType        string   `yaml:"keyType" json:"keyType"`
+	CreateCA       *bool    `yaml:"createCA" json:"createCA"`
+	CAValidityDays int      `yaml:"caValidityDays" json:"caValidityDays"`
 }
 
 type service struct {
-	ContainerRegistry string            `yaml:"containerRegistry"`
-	Tag               string            `yaml:"tag"`
-	Environment       map[string]string `yaml:"environment"`
-	AdditionalContent json.RawMessage   `yaml:"additionalContent"`
+	Disabled          *bool             `yaml:"disabled" json:"disabled,omitempty"`
+	ContainerRegistry string            `yaml:"containerRegistry" json:"containerRegistry"`
+	Tag               string            `yaml:"tag" json:"tag"`
+	Environment       map[string]string `yaml:"environment" json:"environment,omitempty"`
+	Resources         *resources        `yaml:"resources" json:"resources,omitempty"`
+	Healthcheck       *healthcheck      `yaml:"healthcheck" json:"healthcheck,omitempty"`
+	Restart           string            `yaml:"restart" json:"restart,omitempty"`
+	Deploy            *deploy           `yaml:"deploy" json:"deploy,omitempty"`
+	AdditionalContent json.RawMessage   `yaml:"additionalContent" json:"additionalContent,omitempty"`
 }
 
 // nullTransformer is used to fix a problem with mergo
@@ -209,7 +475,8 @@ func (t *nullTransformer) Transformer(typ reflect.Type) func(dst, src reflect.Va
 }
 
 // NewYmlConfig creates a ymlConfig object from all given files. The files were
-// merged together with the default config.
+// merged together with the default config. References like ${ENV:NAME} and
+// ${FILE:path} in string values are replaced afterwards.
 func NewYmlConfig(configFiles [][]byte) (*YmlConfig, error) {
 	allConfigFiles := [][]byte{
 		defaultConfig,
@@ -228,34 +495,50 @@ func NewYmlConfig(configFiles [][]byte) (*YmlConfig, error) {
 		}
 	}
 
+	// Replace references to environment variables and files
+	if err := interpolate(config); err != nil {
+		return nil, fmt.Errorf("interpolating config: %w", err)
+	}
+	if err := checkPort(config.Port); err != nil {
+		return nil, fmt.Errorf("checking port: %w", err)
+	}
+	if err := checkPostgresContainerUser(config.PostgresContainerUser); err != nil {
+		return nil, fmt.Errorf("checking postgresContainerUser: %w", err)
+	}
+	if err := checkCertificate(config.Certificate); err != nil {
+		return nil, fmt.Errorf("checking certificate: %w", err)
+	}
+	if err := applyExternalServices(config); err != nil {
+		return nil, fmt.Errorf("applying external services: %w", err)
+	}
+
+	// Check target and add default filename
+	if config.Target == "" {
+		config.Target = TargetCompose
+	}
+	defaultFilename, ok := defaultFilenames[config.Target]
+	if !ok {
+		return nil, fmt.Errorf("invalid target %q", config.Target)
+	}
+	if config.Filename == "" {
+		config.Filename = defaultFilename
+	}
+
+	if err := checkExtraServices(config); err != nil {
+		return nil, fmt.Errorf("checking extraServices: %w", err)
+	}
+
 	// Add default PostgresContainerUser
 	if config.PostgresContainerUser == "" {
 		config.PostgresContainerUser = fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
 	}
 
 	// Fill services
-	allServices := []string{
-		"proxy",
-		"client",
-		"backendAction",
-		"backendPresenter",
-		"backendManage",
-		"datastoreReader",
-		"datastoreWriter",
-		"postgres",
-		"autoupdate",
-		"auth",
-		"vote",
-		"redis",
-		"media",
-		"icc",
-		"manage",
-	}
 	if len(config.Services) == 0 {
-		config.Services = make(map[string]service, len(allServices))
+		config.Services = make(map[string]service, len(serviceSpecs))
 	}
 
-	for _, name := range allServices {
+	for _, name := range allServices() {
 		_, ok := config.Services[name]
 		if !ok {
 			config.Services[name] = service{}
@@ -272,6 +555,22 @@ func NewYmlConfig(configFiles [][]byte) (*YmlConfig, error) {
 		config.Services[name] = s
 	}
 
+	if *config.EnableManageTLS && !*config.EnableLocalHTTPS {
+		return nil, fmt.Errorf("enableManageTLS requires enableLocalHTTPS because the manage service uses its certificate")
+	}
+	if err := applyManageAuth(config); err != nil {
+		return nil, fmt.Errorf("applying manage authentication: %w", err)
+	}
+	if err := applyEmail(config); err != nil {
+		return nil, fmt.Errorf("applying email: %w", err)
+	}
+	if err := applyProfile(config); err != nil {
+		return nil, fmt.Errorf("applying profile: %w", err)
+	}
+	if err := checkRuntimeOptions(config); err != nil {
+		return nil, fmt.Errorf("checking services: %w", err)
+	}
+
 	return config, nil
 }
 
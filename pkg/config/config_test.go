@@ -70,7 +70,7 @@ defaults:
 		c := make([][]byte, 2)
 		c[0] = []byte(customConfig1)
 		c[1] = []byte(customConfig2)
-		if err := config.Config(testDir, nil, c); err != nil {
+		if err := config.Config(testDir, false, nil, c); err != nil {
 			t.Fatalf("running config.Config() failed with error: %v", err)
 		}
 		testFileContains(t, testDir, "docker-compose.yml", "image: example.com/test_Aeghies3me/openslides-proxy:latest")
@@ -86,7 +86,7 @@ disablePostgres: true
 		c := make([][]byte, 2)
 		c[0] = []byte(customConfig1)
 		c[1] = []byte(customConfig2)
-		if err := config.Config(testDir, nil, c); err != nil {
+		if err := config.Config(testDir, false, nil, c); err != nil {
 			t.Fatalf("running config.Config() failed with error: %v", err)
 		}
 		testFileNotContains(t, testDir, "docker-compose.yml", "image: postgres:11")
@@ -102,11 +102,99 @@ disablePostgres: false
 		c := make([][]byte, 2)
 		c[0] = []byte(customConfig1)
 		c[1] = []byte(customConfig2)
-		if err := config.Config(testDir, nil, c); err != nil {
+		if err := config.Config(testDir, false, nil, c); err != nil {
 			t.Fatalf("running config.Config() failed with error: %v", err)
 		}
 		testFileContains(t, testDir, "docker-compose.yml", "image: postgres:11")
 	})
+
+	t.Run("running config.Config() using a custom config with enableManageTLS", func(t *testing.T) {
+		customConfig := `---
+enableManageTLS: true
+`
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testFileContains(t, testDir, "docker-compose.yml", "MANAGE_ENABLE_TLS: 1")
+		testFileContains(t, testDir, "docker-compose.yml", "      - internal_auth_password\n      - cert_crt\n      - cert_key\n")
+	})
+
+	t.Run("running config.Config() using a custom config with enableManageTLS and published port", func(t *testing.T) {
+		customConfig := `---
+enableManageTLS: true
+services:
+  manage:
+    additionalContent:
+      ports:
+        - 127.0.0.1:9008:9008
+`
+		if err := config.Validate("custom.yml", []byte(customConfig)); err != nil {
+			t.Fatalf("validating config: %v", err)
+		}
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testFileContains(t, testDir, "docker-compose.yml", "      - cert_key\n    ports:\n    - 127.0.0.1:9008:9008\n")
+	})
+
+	t.Run("running config.Config() using a custom config with client certificates", func(t *testing.T) {
+		customConfig := `---
+enableManageTLS: true
+certificate:
+  createCA: true
+manageAuth:
+  clientCertificates: true
+  password: false
+  operators:
+    alice: CN=alice,O=OpenSlides
+`
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testFileContains(t, testDir, "docker-compose.yml", "MANAGE_CLIENT_CA_FILE: /run/secrets/ca_crt")
+		testFileContains(t, testDir, "docker-compose.yml", `MANAGE_OPERATORS: '{"alice":"CN=alice,O=OpenSlides"}'`)
+		testFileContains(t, testDir, "docker-compose.yml", `MANAGE_PASSWORD_AUTH: "0"`)
+		testFileContains(t, testDir, "docker-compose.yml", "      - cert_key\n      - ca_crt\n")
+		testFileContains(t, testDir, "docker-compose.yml", "\n  ca_crt:\n    file: ./secrets/ca_crt\n")
+	})
+
+	t.Run("running config.Config() using a custom config with a manage policy", func(t *testing.T) {
+		customConfig := `---
+manageAuth:
+  policyFile: policy.yml
+`
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testFileContains(t, testDir, "docker-compose.yml", "MANAGE_POLICY_FILE: /run/secrets/manage_policy")
+		testFileContains(t, testDir, "docker-compose.yml", "      - internal_auth_password\n      - manage_policy\n")
+		testFileContains(t, testDir, "docker-compose.yml", "\n  manage_policy:\n    file: ./secrets/manage_policy\n")
+	})
+
+	for _, tt := range []struct {
+		name   string
+		config string
+	}{
+		{"client certificates without enableManageTLS", "certificate:\n  createCA: true\nmanageAuth:\n  clientCertificates: true\n"},
+		{"client certificates without local CA", "enableManageTLS: true\nmanageAuth:\n  clientCertificates: true\n"},
+		{"disabled password without client certificates", "manageAuth:\n  password: false\n"},
+	} {
+		t.Run("creating config with "+tt.name, func(t *testing.T) {
+			if _, err := config.NewYmlConfig([][]byte{[]byte(tt.config)}); err == nil {
+				t.Fatalf("creating config should fail, but it did not")
+			}
+		})
+	}
+
+	t.Run("running config.Config() using a custom config with enableManageTLS without local HTTPS", func(t *testing.T) {
+		customConfig := `---
+enableLocalHTTPS: false
+enableManageTLS: true
+`
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(customConfig)}); err == nil {
+			t.Fatalf("running config.Config() should fail, but it did not")
+		}
+	})
 }
 
 func testFileContains(t testing.TB, dir, name, exp string) {
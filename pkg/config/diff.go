@@ -0,0 +1,388 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigDiffHelp contains the short help text for the command.
+	ConfigDiffHelp = "Shows the changes the config command would apply to the container configuration YAML file"
+
+	// ConfigDiffHelpExtra contains the long help text for the command without the headline.
+	ConfigDiffHelpExtra = `This command renders the container configuration YAML file in memory and
+compares it with the existing file in the given directory. The changes are
+grouped by service (images, environment variables, secrets and other
+properties). The values of Kubernetes secrets are redacted. The command exits
+with code 2 if there are differences.`
+)
+
+// cmdDiff returns the config diff subcommand.
+func cmdDiff() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff directory",
+		Short: ConfigDiffHelp,
+		Long:  ConfigDiffHelp + "\n\n" + ConfigDiffHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	tplFileName := FlagTpl(cmd)
+	configFileNames := FlagConfig(cmd)
+	target := FlagTarget(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		dir := args[0]
+
+		tplFile, err := ReadTplFile(*tplFileName)
+		if err != nil {
+			return err
+		}
+
+		configFiles, err := ReadConfigFiles(*configFileNames)
+		if err != nil {
+			return err
+		}
+		if *target != "" {
+			configFiles = append(configFiles, TargetConfig(*target))
+		}
+
+		changed, err := Diff(cmd.OutOrStdout(), dir, tplFile, configFiles)
+		if err != nil {
+			return fmt.Errorf("running Diff(): %w", err)
+		}
+		if changed {
+			return fehler.ExitCode(2, fmt.Errorf("container configuration YAML file is not up to date"))
+		}
+		return nil
+	}
+	return cmd
+}
+
+// Diff renders the YAML file in memory and compares it with the existing file
+// in the given directory. It writes a structured diff to w and reports whether
+// there are any differences.
+func Diff(w io.Writer, dir string, tplFile []byte, configFiles [][]byte) (bool, error) {
+	cfg, err := NewYmlConfig(configFiles)
+	if err != nil {
+		return false, fmt.Errorf("creating new YML config object: %w", err)
+	}
+
+	rendered, err := RenderYmlFile(dir, tplFile, cfg)
+	if err != nil {
+		return false, fmt.Errorf("rendering YAML file: %w", err)
+	}
+
+	p := path.Join(dir, cfg.Filename)
+	existing, err := os.ReadFile(p)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("reading file %q: %w", p, err)
+		}
+		fmt.Fprintf(w, "File %q does not exist and would be created.\n", p)
+		return true, nil
+	}
+
+	sections, err := diffYAML(existing, rendered)
+	if err != nil {
+		return false, fmt.Errorf("comparing %q with rendered YAML file: %w", p, err)
+	}
+	if len(sections) == 0 {
+		if !bytes.Equal(existing, rendered) {
+			fmt.Fprintf(w, "File %q differs only in formatting or comments.\n", p)
+			return true, nil
+		}
+		fmt.Fprintf(w, "File %q is up to date.\n", p)
+		return false, nil
+	}
+
+	for _, s := range sections {
+		fmt.Fprintln(w, s)
+	}
+	return true, nil
+}
+
+// diffSection contains all changes of one service, of one Kubernetes object
+// or of one top level key.
+type diffSection struct {
+	kind    byte // One of '+', '-' and '~'.
+	name    string
+	changes []diffChange
+}
+
+func (s diffSection) String() string {
+	lines := []string{fmt.Sprintf("%c %s", s.kind, s.name)}
+	for _, c := range s.changes {
+		lines = append(lines, "    "+c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type diffChange struct {
+	kind byte // One of '+', '-' and '~'.
+	path string
+	old  interface{}
+	new  interface{}
+}
+
+func (c diffChange) String() string {
+	if c.path == "" {
+		c.path = "value"
+	}
+	_, oldRedacted := c.old.(redacted)
+	_, newRedacted := c.new.(redacted)
+	if c.kind == '~' && (oldRedacted || newRedacted) {
+		return fmt.Sprintf("~ %s: <redacted, changed>", c.path)
+	}
+	switch c.kind {
+	case '+':
+		return fmt.Sprintf("+ %s: %s", c.path, formatValue(c.new))
+	case '-':
+		return fmt.Sprintf("- %s: %s", c.path, formatValue(c.old))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.path, formatValue(c.old), formatValue(c.new))
+	}
+}
+
+// redacted replaces a secret value in the diff. Only the hash of the value is
+// kept so that changes are detected without printing the value.
+type redacted [sha256.Size]byte
+
+func (r redacted) String() string {
+	return "<redacted>"
+}
+
+func (r redacted) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// redactSecret replaces the values of the data and stringData fields of the
+// given Kubernetes Secret object.
+func redactSecret(obj map[string]interface{}) {
+	for _, field := range []string{"data", "stringData"} {
+		data, ok := obj[field].(map[string]interface{})
+		if !ok {
+			if _, exists := obj[field]; exists {
+				obj[field] = redacted(sha256.Sum256([]byte(fmt.Sprintf("%v", obj[field]))))
+			}
+			continue
+		}
+		for k, v := range data {
+			data[k] = redacted(sha256.Sum256([]byte(fmt.Sprintf("%v", v))))
+		}
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(b)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// diffYAML compares two YAML files. Docker Compose files are compared service by
+// service. Files with several documents like Kubernetes manifests are compared
+// object by object.
+func diffYAML(old, new []byte) ([]diffSection, error) {
+	oldSections, err := yamlSections(old)
+	if err != nil {
+		return nil, fmt.Errorf("parsing existing file: %w", err)
+	}
+	newSections, err := yamlSections(new)
+	if err != nil {
+		return nil, fmt.Errorf("parsing rendered file: %w", err)
+	}
+
+	var result []diffSection
+	for _, name := range unionKeys(oldSections, newSections) {
+		o, inOld := oldSections[name]
+		n, inNew := newSections[name]
+		switch {
+		case !inOld:
+			result = append(result, diffSection{kind: '+', name: name})
+		case !inNew:
+			result = append(result, diffSection{kind: '-', name: name})
+		default:
+			changes := diffValues("", o, n)
+			if len(changes) > 0 {
+				result = append(result, diffSection{kind: '~', name: name, changes: changes})
+			}
+		}
+	}
+	return result, nil
+}
+
+// yamlSections splits the given YAML file into named sections.
+func yamlSections(content []byte) (map[string]interface{}, error) {
+	sections := make(map[string]interface{})
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for i := 1; ; i++ {
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			if doc != nil {
+				sections[fmt.Sprintf("document %d", i)] = doc
+			}
+			continue
+		}
+
+		// Kubernetes object
+		if kind, ok := m["kind"].(string); ok {
+			if kind == "Secret" {
+				redactSecret(m)
+			}
+			name := ""
+			if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+				name, _ = metadata["name"].(string)
+			}
+			sections[kind+" "+name] = m
+			continue
+		}
+
+		// Docker Compose file
+		for k, v := range m {
+			if k == "services" {
+				services, ok := v.(map[string]interface{})
+				if ok {
+					for name, s := range services {
+						sections["service "+name] = s
+					}
+					continue
+				}
+			}
+			if strings.HasPrefix(k, "x-") {
+				// Extension fields are only used for anchors and merged into the services.
+				continue
+			}
+			sections[k] = v
+		}
+	}
+	return sections, nil
+}
+
+// diffValues compares two values recursively. Lists of scalars are compared
+// like sets so that added and removed entries are reported.
+func diffValues(p string, old, new interface{}) []diffChange {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		var changes []diffChange
+		for _, k := range unionKeys(oldMap, newMap) {
+			childPath := k
+			if p != "" {
+				childPath = p + "." + k
+			}
+			o, inOld := oldMap[k]
+			n, inNew := newMap[k]
+			switch {
+			case !inOld:
+				changes = append(changes, diffChange{kind: '+', path: childPath, new: n})
+			case !inNew:
+				changes = append(changes, diffChange{kind: '-', path: childPath, old: o})
+			default:
+				changes = append(changes, diffValues(childPath, o, n)...)
+			}
+		}
+		return changes
+	}
+
+	oldList, oldIsList := old.([]interface{})
+	newList, newIsList := new.([]interface{})
+	if oldIsList && newIsList && scalars(oldList) && scalars(newList) {
+		var changes []diffChange
+		for _, o := range oldList {
+			if !contains(newList, o) {
+				changes = append(changes, diffChange{kind: '-', path: p, old: o})
+			}
+		}
+		for _, n := range newList {
+			if !contains(oldList, n) {
+				changes = append(changes, diffChange{kind: '+', path: p, new: n})
+			}
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+	return []diffChange{{kind: '~', path: p, old: old, new: new}}
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func scalars(l []interface{}) bool {
+	for _, v := range l {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func contains(l []interface{}, v interface{}) bool {
+	for _, e := range l {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffInventory runs Diff for every instance of the inventory without writing
+// anything. It returns an error with exit code 2 if at least one file would
+// change.
+func diffInventory(w io.Writer, inv *Inventory, tplFile []byte, configFiles func(Instance) [][]byte) error {
+	var changed int
+	for _, instance := range inv.Instances {
+		fmt.Fprintf(w, "==> %s (%s)\n", instance.Name, instance.Directory)
+		c, err := Diff(w, instance.Directory, tplFile, configFiles(instance))
+		if err != nil {
+			return fmt.Errorf("running Diff() for instance %q: %w", instance.Name, err)
+		}
+		if c {
+			changed++
+		}
+	}
+	if changed > 0 {
+		return fehler.ExitCode(2, fmt.Errorf("container configuration YAML files of %d of %d instances would change", changed, len(inv.Instances)))
+	}
+	return nil
+}
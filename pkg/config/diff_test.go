@@ -0,0 +1,204 @@
+package config_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+func TestDiff(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	t.Run("running config.Diff() without existing file", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		changed, err := config.Diff(buf, testDir, nil, nil)
+		if err != nil {
+			t.Fatalf("running config.Diff() failed with error: %v", err)
+		}
+		if !changed {
+			t.Fatalf("running config.Diff() without existing file should report changes")
+		}
+		if !strings.Contains(buf.String(), "does not exist") {
+			t.Fatalf("got output %q, expected hint for non existing file", buf.String())
+		}
+	})
+
+	if err := config.Config(testDir, false, nil, nil); err != nil {
+		t.Fatalf("running config.Config() failed with error: %v", err)
+	}
+
+	t.Run("running config.Diff() with unchanged config", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		changed, err := config.Diff(buf, testDir, nil, nil)
+		if err != nil {
+			t.Fatalf("running config.Diff() failed with error: %v", err)
+		}
+		if changed {
+			t.Fatalf("running config.Diff() with unchanged config should not report changes, got %q", buf.String())
+		}
+	})
+
+	t.Run("running config.Diff() with changed config", func(t *testing.T) {
+		customConfig := `---
+disablePostgres: true
+enableLocalHTTPS: false
+defaultEnvironment:
+  OPENSLIDES_LOGLEVEL: debug
+services:
+  proxy:
+    tag: 4.0.1
+  backendAction:
+    environment:
+      EMAIL_HOST: mail.example.com
+`
+		buf := new(bytes.Buffer)
+		changed, err := config.Diff(buf, testDir, nil, [][]byte{[]byte(customConfig)})
+		if err != nil {
+			t.Fatalf("running config.Diff() failed with error: %v", err)
+		}
+		if !changed {
+			t.Fatalf("running config.Diff() with changed config should report changes")
+		}
+		got := buf.String()
+		for _, exp := range []string{
+			"- service postgres\n",
+			"~ service proxy\n",
+			"    ~ image: ghcr.io/openslides/openslides/openslides-proxy:latest -> ghcr.io/openslides/openslides/openslides-proxy:4.0.1\n",
+			"    - secrets: [\"cert_crt\",\"cert_key\"]\n",
+			"    - environment.ENABLE_LOCAL_HTTPS: 1\n",
+			"~ service backendAction\n",
+			"    + environment.EMAIL_HOST: mail.example.com\n",
+			"    ~ environment.OPENSLIDES_LOGLEVEL: info -> debug\n",
+			"~ secrets\n",
+			"    - cert_key: {\"file\":\"./secrets/cert_key\"}\n",
+		} {
+			if !strings.Contains(got, exp) {
+				t.Fatalf("got output\n%s\nexpected it to contain %q", got, exp)
+			}
+		}
+		testFileContains(t, testDir, "docker-compose.yml", "image: postgres:11")
+	})
+}
+
+func TestDiffCmd(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	if err := config.Config(testDir, false, nil, nil); err != nil {
+		t.Fatalf("running config.Config() failed with error: %v", err)
+	}
+	customConfigFileName := path.Join(testDir, "custom-config.yml")
+	if err := os.WriteFile(customConfigFileName, []byte("---\nport: 8001\n"), 0666); err != nil {
+		t.Fatalf("writing custom config file: %v", err)
+	}
+
+	t.Run("executing config diff without changes", func(t *testing.T) {
+		cmd := config.Cmd()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetArgs([]string{"diff", testDir})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing config diff subcommand: %v", err)
+		}
+	})
+
+	t.Run("executing config diff with changes", func(t *testing.T) {
+		cmd := config.Cmd()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetArgs([]string{"diff", testDir, "--config", customConfigFileName})
+		err := cmd.Execute()
+		var errExit interface {
+			ExitCode() int
+		}
+		if !errors.As(err, &errExit) || errExit.ExitCode() != 2 {
+			t.Fatalf("executing config diff subcommand with changes should return exit code 2, got error %v", err)
+		}
+	})
+
+	t.Run("executing config with dry-run flag", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		cmd := config.Cmd()
+		cmd.SetOut(buf)
+		cmd.SetArgs([]string{testDir, "--dry-run", "--config", customConfigFileName})
+		err := cmd.Execute()
+		var errExit interface {
+			ExitCode() int
+		}
+		if !errors.As(err, &errExit) || errExit.ExitCode() != 2 {
+			t.Fatalf("executing config subcommand with dry-run flag and changes should return exit code 2, got error %v", err)
+		}
+		if !strings.Contains(buf.String(), "+ ports: 127.0.0.1:8001:8000") {
+			t.Fatalf("got output %q, expected changed port", buf.String())
+		}
+		testFileContains(t, testDir, "docker-compose.yml", "127.0.0.1:8000:8000")
+	})
+	t.Run("executing config with dry-run flag without changes", func(t *testing.T) {
+		cmd := config.Cmd()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetArgs([]string{testDir, "--dry-run"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing config subcommand with dry-run flag: %v", err)
+		}
+	})
+}
+
+func TestDiffKubernetesSecrets(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	secDir := path.Join(testDir, "secrets")
+	if err := os.Mkdir(secDir, os.ModePerm); err != nil {
+		t.Fatalf("creating secrets directory: %v", err)
+	}
+	for _, name := range []string{"auth_token_key", "auth_cookie_key", "superadmin", "manage_auth_password", "internal_auth_password", "postgres_password", "cert_crt", "cert_key"} {
+		if err := os.WriteFile(path.Join(secDir, name), []byte("secret_"+name), 0600); err != nil {
+			t.Fatalf("writing secret file: %v", err)
+		}
+	}
+	c := [][]byte{config.TargetConfig(config.TargetKubernetes)}
+	if err := config.Config(testDir, false, nil, c); err != nil {
+		t.Fatalf("running config.Config() failed with error: %v", err)
+	}
+
+	t.Run("running config.Diff() with changed secret", func(t *testing.T) {
+		oldSecret, newSecret := "secret_auth_token_key", "changed_Ohdae5ie"
+		if err := os.WriteFile(path.Join(secDir, "auth_token_key"), []byte(newSecret), 0600); err != nil {
+			t.Fatalf("writing secret file: %v", err)
+		}
+
+		buf := new(bytes.Buffer)
+		changed, err := config.Diff(buf, testDir, nil, c)
+		if err != nil {
+			t.Fatalf("running config.Diff() failed with error: %v", err)
+		}
+		if !changed {
+			t.Fatalf("running config.Diff() with changed secret should report changes")
+		}
+		got := buf.String()
+		if !strings.Contains(got, "~ data.auth_token_key: <redacted, changed>\n") {
+			t.Fatalf("got output\n%s\nexpected redacted change of auth_token_key", got)
+		}
+		for _, secret := range []string{oldSecret, newSecret} {
+			for _, s := range []string{secret, base64.StdEncoding.EncodeToString([]byte(secret))} {
+				if strings.Contains(got, s) {
+					t.Fatalf("got output\n%s\nwhich contains the secret %q", got, s)
+				}
+			}
+		}
+	})
+}
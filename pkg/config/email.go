@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// EmailPasswordFileName is the name of the secrets file containing the
+// password of the email server user.
+const EmailPasswordFileName = "email_password"
+
+// email contains the options for the email server used by the backend. Email
+// is disabled if the host is empty.
+type email struct {
+	Host                        string `yaml:"host" json:"host"`
+	Port                        string `yaml:"port" json:"port"`
+	TLSMode                     string `yaml:"tlsMode" json:"tlsMode"`
+	User                        string `yaml:"user" json:"user"`
+	PasswordFile                string `yaml:"passwordFile" json:"passwordFile"`
+	From                        string `yaml:"from" json:"from"`
+	AcceptSelfSignedCertificate *bool  `yaml:"acceptSelfSignedCertificate" json:"acceptSelfSignedCertificate"`
+}
+
+// emailTLSModes maps the TLS modes of the email section to the values of the
+// environment variable EMAIL_CONNECTION_SECURITY.
+var emailTLSModes = map[string]string{
+	"tls":      "SSL/TLS",
+	"starttls": "STARTTLS",
+	"none":     "NONE",
+}
+
+// emailServices contains the services which get the email settings. The
+// manage service uses them to send test emails.
+var emailServices = []string{"backendAction", "manage"}
+
+// emailEnvNames contains the environment variables of the email settings. The
+// manage service gets the values of the backendAction service, so a test email
+// uses exactly the settings of the backend.
+var emailEnvNames = []string{
+	"EMAIL_HOST",
+	"EMAIL_PORT",
+	"EMAIL_CONNECTION_SECURITY",
+	"EMAIL_HOST_USER",
+	"EMAIL_HOST_PASSWORD_FILE",
+	"DEFAULT_FROM_EMAIL",
+	"EMAIL_ACCEPT_SELF_SIGNED_CERTIFICATE",
+}
+
+// localEmailHosts contains the hosts which may be used without TLS together
+// with a user because the password does not leave the host.
+var localEmailHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// UsesEmail reports whether an email server is configured.
+func (c *YmlConfig) UsesEmail() bool {
+	return c.Email.Host != ""
+}
+
+func checkEmailTLSMode(v string) error {
+	if _, ok := emailTLSModes[v]; !ok {
+		return fmt.Errorf("%q is not one of \"tls\", \"starttls\" and \"none\"", v)
+	}
+	return nil
+}
+
+// applyEmail adds the environment variables of the email section to the
+// backendAction service. Variables given in the environment of the service
+// take precedence. The manage service gets the resulting email settings of the
+// backendAction service.
+func applyEmail(cfg *YmlConfig) error {
+	if !cfg.UsesEmail() {
+		if cfg.Email.PasswordFile != "" {
+			return fmt.Errorf("email.passwordFile requires email.host")
+		}
+		return shareEmailEnv(cfg)
+	}
+
+	e := cfg.Email
+	if err := checkPort(e.Port); err != nil {
+		return fmt.Errorf("email.port: %w", err)
+	}
+	if err := checkEmailTLSMode(e.TLSMode); err != nil {
+		return fmt.Errorf("email.tlsMode: %w", err)
+	}
+	if e.PasswordFile != "" && e.User == "" {
+		return fmt.Errorf("email.passwordFile requires email.user")
+	}
+	if e.TLSMode == "none" && e.User != "" && !isLocalEmailHost(e.Host) {
+		return fmt.Errorf("email.user requires email.tlsMode \"tls\" or \"starttls\" because the password must not be sent unencrypted to %q", e.Host)
+	}
+
+	env := map[string]string{
+		"EMAIL_HOST":                e.Host,
+		"EMAIL_PORT":                e.Port,
+		"EMAIL_CONNECTION_SECURITY": emailTLSModes[e.TLSMode],
+	}
+	if e.User != "" {
+		env["EMAIL_HOST_USER"] = e.User
+	}
+	if e.PasswordFile != "" {
+		env["EMAIL_HOST_PASSWORD_FILE"] = "/run/secrets/" + EmailPasswordFileName
+	}
+	if e.From != "" {
+		env["DEFAULT_FROM_EMAIL"] = e.From
+	}
+	if e.AcceptSelfSignedCertificate != nil {
+		env["EMAIL_ACCEPT_SELF_SIGNED_CERTIFICATE"] = strconv.FormatBool(*e.AcceptSelfSignedCertificate)
+	}
+
+	s := cfg.Services["backendAction"]
+	for k, v := range s.Environment {
+		env[k] = v
+	}
+	s.Environment = env
+	cfg.Services["backendAction"] = s
+	return shareEmailEnv(cfg)
+}
+
+// shareEmailEnv sets the email settings of the manage service to the
+// effective email settings of the backendAction service. They can not be
+// given in the environment of the manage service.
+func shareEmailEnv(cfg *YmlConfig) error {
+	action := cfg.Services["backendAction"]
+	s := cfg.Services["manage"]
+	env := make(map[string]string, len(s.Environment))
+	for k, v := range s.Environment {
+		env[k] = v
+	}
+	for _, name := range emailEnvNames {
+		if _, ok := s.Environment[name]; ok {
+			return fmt.Errorf("%s can not be set for the manage service, it always uses the email settings of the backendAction service", name)
+		}
+		// Values of the default environment are shared anyway.
+		if v, ok := action.Environment[name]; ok {
+			env[name] = v
+		}
+	}
+	if len(env) > 0 {
+		s.Environment = env
+		cfg.Services["manage"] = s
+	}
+	return nil
+}
+
+func isLocalEmailHost(host string) bool {
+	for _, h := range localEmailHosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// usesEmailPassword reports whether the given service gets the email password
+// secret.
+func usesEmailPassword(cfg *YmlConfig, name string) bool {
+	if !cfg.UsesEmail() || cfg.Email.PasswordFile == "" {
+		return false
+	}
+	for _, s := range emailServices {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package config_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+const emailConfig = `---
+email:
+  host: mail.example.com
+  port: 587
+  tlsMode: starttls
+  user: openslides
+  passwordFile: ./email-password
+  from: openslides@example.com
+services:
+  backendAction:
+    environment:
+      DEFAULT_FROM_EMAIL: noreply@example.com
+`
+
+func TestEmail(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	t.Run("creating config with email section", func(t *testing.T) {
+		if err := config.Validate("email.yml", []byte(emailConfig)); err != nil {
+			t.Fatalf("validating config: %v", err)
+		}
+		cfg, err := config.NewYmlConfig([][]byte{[]byte(emailConfig)})
+		if err != nil {
+			t.Fatalf("creating config: %v", err)
+		}
+		for service, env := range map[string]map[string]string{
+			"backendAction": {
+				"EMAIL_HOST":                "mail.example.com",
+				"EMAIL_PORT":                "587",
+				"EMAIL_CONNECTION_SECURITY": "STARTTLS",
+				"EMAIL_HOST_USER":           "openslides",
+				"EMAIL_HOST_PASSWORD_FILE":  "/run/secrets/email_password",
+				"DEFAULT_FROM_EMAIL":        "noreply@example.com",
+			},
+			"manage": {
+				"EMAIL_HOST":                "mail.example.com",
+				"EMAIL_CONNECTION_SECURITY": "STARTTLS",
+				"EMAIL_HOST_PASSWORD_FILE":  "/run/secrets/email_password",
+				"DEFAULT_FROM_EMAIL":        "noreply@example.com",
+			},
+		} {
+			for name, expected := range env {
+				if got := cfg.Services[service].Environment[name]; got != expected {
+					t.Fatalf("wrong value of %s in service %s, expected %q, got %q", name, service, expected, got)
+				}
+			}
+		}
+		if _, ok := cfg.Services["backendPresenter"].Environment["EMAIL_HOST"]; ok {
+			t.Fatalf("service backendPresenter should not get the email settings")
+		}
+	})
+
+	t.Run("running config.Config() with email section", func(t *testing.T) {
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(emailConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		got := string(content)
+		for _, expected := range []string{
+			"\n      - email_password\n",
+			"\n  email_password:\n    file: ./secrets/email_password\n",
+		} {
+			if !strings.Contains(got, expected) {
+				t.Fatalf("compose file does not contain %q, got\n%s", expected, got)
+			}
+		}
+		if strings.Count(got, "\n      - email_password\n") != 2 {
+			t.Fatalf("compose file should contain the secret email_password for two services, got\n%s", got)
+		}
+	})
+
+	t.Run("running config.Config() with email section for target swarm", func(t *testing.T) {
+		c := [][]byte{[]byte(emailConfig), config.TargetConfig(config.TargetSwarm)}
+		if err := config.Config(testDir, true, nil, c); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-stack.yml"))
+		if err != nil {
+			t.Fatalf("reading stack file: %v", err)
+		}
+		if !strings.Contains(string(content), "\n  email_password:\n    external: true\n") {
+			t.Fatalf("stack file does not contain secret email_password, got\n%s", content)
+		}
+	})
+
+	t.Run("creating config with user without TLS for localhost", func(t *testing.T) {
+		c := "email:\n  host: localhost\n  port: 25\n  tlsMode: none\n  user: openslides\n"
+		if _, err := config.NewYmlConfig([][]byte{[]byte(c)}); err != nil {
+			t.Fatalf("creating config: %v", err)
+		}
+	})
+
+	t.Run("creating config with email settings in the backendAction service", func(t *testing.T) {
+		c := "services:\n  backendAction:\n    environment:\n      EMAIL_HOST: mail.example.com\n"
+		cfg, err := config.NewYmlConfig([][]byte{[]byte(c)})
+		if err != nil {
+			t.Fatalf("creating config: %v", err)
+		}
+		if got := cfg.Services["manage"].Environment["EMAIL_HOST"]; got != "mail.example.com" {
+			t.Fatalf("manage service should get the email settings of the backendAction service, got EMAIL_HOST %q", got)
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		config string
+	}{
+		{"invalid TLS mode", "email:\n  host: mail.example.com\n  tlsMode: ssl\n"},
+		{"password file without host", "email:\n  passwordFile: ./email-password\n"},
+		{"password file without user", "email:\n  host: mail.example.com\n  passwordFile: ./email-password\n"},
+		{"user without TLS", "email:\n  host: mail.example.com\n  tlsMode: none\n  user: openslides\n"},
+		{"email settings of the manage service", "services:\n  manage:\n    environment:\n      EMAIL_HOST: mail.example.com\n"},
+	} {
+		t.Run("creating config with "+tt.name, func(t *testing.T) {
+			if _, err := config.NewYmlConfig([][]byte{[]byte(tt.config)}); err == nil {
+				t.Fatalf("creating config should fail, but it did not")
+			}
+		})
+	}
+}
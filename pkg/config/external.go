@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+)
+
+const (
+	// PostgresCAFileName is the name of the secrets file containing the CA
+	// certificate used to verify an external database server.
+	PostgresCAFileName = "postgres_ca"
+
+	postgresPasswordFileName = "postgres_password"
+)
+
+// externalDatabase contains the connection options for a database server
+// which is not managed by the generated file. It is used if the host is not
+// empty.
+type externalDatabase struct {
+	Host         string `yaml:"host" json:"host"`
+	Port         string `yaml:"port" json:"port"`
+	Name         string `yaml:"name" json:"name"`
+	User         string `yaml:"user" json:"user"`
+	PasswordFile string `yaml:"passwordFile" json:"passwordFile"`
+	SSLMode      string `yaml:"sslMode" json:"sslMode"`
+	CAFile       string `yaml:"caFile" json:"caFile"`
+}
+
+// externalRedis contains the connection options for a Redis server which is
+// not managed by the generated file. It is used if the host is not empty.
+type externalRedis struct {
+	Host string `yaml:"host" json:"host"`
+	Port string `yaml:"port" json:"port"`
+}
+
+// databaseEnvPrefixes are the prefixes of the environment variables of all
+// services connecting to the database.
+var databaseEnvPrefixes = []string{"DATASTORE_DATABASE", "VOTE_DATABASE", "MEDIA_DATABASE"}
+
+// redisEnvPrefixes are the prefixes of the environment variables of all
+// services connecting to Redis.
+var redisEnvPrefixes = []string{"CACHE", "MESSAGE_BUS", "VOTE_REDIS", "ICC_REDIS"}
+
+// sslModes are the values of the libpq option sslmode.
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// UsesExternalDatabase reports whether the database server is not managed by
+// the generated file.
+func (c *YmlConfig) UsesExternalDatabase() bool {
+	return c.ExternalDatabase.Host != ""
+}
+
+// UsesExternalRedis reports whether the Redis server is not managed by the
+// generated file.
+func (c *YmlConfig) UsesExternalRedis() bool {
+	return c.ExternalRedis.Host != ""
+}
+
+// applyExternalServices rewrites the default environment for the external
+// database and Redis servers. The postgres service is disabled for an external
+// database. The SSL options are given as libpq environment variables which are
+// understood by all services connecting to the database.
+func applyExternalServices(cfg *YmlConfig) error {
+	if !cfg.UsesExternalDatabase() && (cfg.ExternalDatabase.PasswordFile != "" || cfg.ExternalDatabase.CAFile != "") {
+		return fmt.Errorf("externalDatabase.passwordFile and externalDatabase.caFile require externalDatabase.host")
+	}
+
+	if cfg.UsesExternalDatabase() {
+		db := cfg.ExternalDatabase
+		if err := checkPort(db.Port); err != nil {
+			return fmt.Errorf("externalDatabase.port: %w", err)
+		}
+		if err := checkSSLMode(db.SSLMode); err != nil {
+			return fmt.Errorf("externalDatabase.sslMode: %w", err)
+		}
+		if cfg.DefaultEnvironment == nil {
+			cfg.DefaultEnvironment = make(map[string]string)
+		}
+		for _, prefix := range databaseEnvPrefixes {
+			cfg.DefaultEnvironment[prefix+"_HOST"] = db.Host
+			cfg.DefaultEnvironment[prefix+"_PORT"] = db.Port
+			cfg.DefaultEnvironment[prefix+"_NAME"] = db.Name
+			cfg.DefaultEnvironment[prefix+"_USER"] = db.User
+		}
+		if db.SSLMode != "" {
+			cfg.DefaultEnvironment["PGSSLMODE"] = db.SSLMode
+		}
+		if db.CAFile != "" {
+			cfg.DefaultEnvironment["PGSSLROOTCERT"] = "/run/secrets/" + PostgresCAFileName
+		}
+		disabled := true
+		cfg.DisablePostgres = &disabled
+	}
+
+	if cfg.UsesExternalRedis() {
+		if err := checkPort(cfg.ExternalRedis.Port); err != nil {
+			return fmt.Errorf("externalRedis.port: %w", err)
+		}
+		if cfg.DefaultEnvironment == nil {
+			cfg.DefaultEnvironment = make(map[string]string)
+		}
+		for _, prefix := range redisEnvPrefixes {
+			cfg.DefaultEnvironment[prefix+"_HOST"] = cfg.ExternalRedis.Host
+			cfg.DefaultEnvironment[prefix+"_PORT"] = cfg.ExternalRedis.Port
+		}
+	}
+	return nil
+}
+
+// serviceSecrets returns the secrets of the given service spec. Services
+// connecting to an external database with a CA file get the CA as additional
+// secret. Services sending emails get the email password and the manage
+// service gets its policy.
+func serviceSecrets(cfg *YmlConfig, spec serviceSpec) []string {
+	secrets := spec.secrets
+	if cfg.ExternalDatabase.CAFile != "" {
+		for _, s := range spec.secrets {
+			if s == postgresPasswordFileName {
+				secrets = append(append([]string{}, secrets...), PostgresCAFileName)
+				break
+			}
+		}
+	}
+	if usesEmailPassword(cfg, spec.name) {
+		secrets = append(append([]string{}, secrets...), EmailPasswordFileName)
+	}
+	if spec.name == "manage" && cfg.ManageAuth.PolicyFile != "" {
+		secrets = append(append([]string{}, secrets...), ManagePolicyFileName)
+	}
+	return secrets
+}
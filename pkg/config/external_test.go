@@ -0,0 +1,100 @@
+package config_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+const externalConfig = `---
+postgresContainerUser: "1000:1000"
+externalDatabase:
+  host: db.example.com
+  port: 5433
+  name: os4
+  user: os4user
+  sslMode: verify-full
+  caFile: ./db-ca.pem
+externalRedis:
+  host: redis.example.com
+  port: 6380
+`
+
+func TestExternalServices(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	t.Run("creating config with external database and Redis", func(t *testing.T) {
+		if err := config.Validate("external.yml", []byte(externalConfig)); err != nil {
+			t.Fatalf("validating config: %v", err)
+		}
+		cfg, err := config.NewYmlConfig([][]byte{[]byte(externalConfig)})
+		if err != nil {
+			t.Fatalf("creating config: %v", err)
+		}
+		if !*cfg.DisablePostgres {
+			t.Fatalf("postgres service should be disabled for an external database")
+		}
+		for name, expected := range map[string]string{
+			"DATASTORE_DATABASE_HOST": "db.example.com",
+			"VOTE_DATABASE_PORT":      "5433",
+			"MEDIA_DATABASE_NAME":     "os4",
+			"MEDIA_DATABASE_USER":     "os4user",
+			"PGSSLMODE":               "verify-full",
+			"PGSSLROOTCERT":           "/run/secrets/postgres_ca",
+			"CACHE_HOST":              "redis.example.com",
+			"MESSAGE_BUS_PORT":        "6380",
+			"VOTE_REDIS_HOST":         "redis.example.com",
+			"ICC_REDIS_PORT":          "6380",
+		} {
+			if got := cfg.DefaultEnvironment[name]; got != expected {
+				t.Fatalf("wrong value of %s, expected %q, got %q", name, expected, got)
+			}
+		}
+	})
+
+	t.Run("running config.Config() with external database and Redis", func(t *testing.T) {
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(externalConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testGoldenFile(t, path.Join(testDir, "docker-compose.yml"), "docker-compose-external.yml")
+	})
+
+	t.Run("running config.Config() with external database and Redis for target swarm", func(t *testing.T) {
+		c := [][]byte{[]byte(externalConfig), config.TargetConfig(config.TargetSwarm)}
+		if err := config.Config(testDir, false, nil, c); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-stack.yml"))
+		if err != nil {
+			t.Fatalf("reading stack file: %v", err)
+		}
+		got := string(content)
+		for _, unexpected := range []string{"\n  postgres:\n", "\n  redis:\n", "db-data"} {
+			if strings.Contains(got, unexpected) {
+				t.Fatalf("stack file should not contain %q, got\n%s", unexpected, got)
+			}
+		}
+		if !strings.Contains(got, "\n  postgres_ca:\n    external: true\n") {
+			t.Fatalf("stack file does not contain secret postgres_ca, got\n%s", got)
+		}
+	})
+
+	t.Run("invalid external database config", func(t *testing.T) {
+		for _, c := range []string{
+			"externalDatabase:\n  caFile: ./ca.pem\n",
+			"externalDatabase:\n  host: db\n  sslMode: always\n",
+			"externalRedis:\n  host: redis\n  port: 0\n",
+		} {
+			if _, err := config.NewYmlConfig([][]byte{[]byte(c)}); err == nil {
+				t.Fatalf("creating config %q should fail", c)
+			}
+		}
+	})
+}
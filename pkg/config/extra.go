@@ -0,0 +1,155 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// extraService is a service which is not part of OpenSlides, e. g. a backup
+// agent, a log shipper or a monitoring exporter. Extra services are rendered
+// after the OpenSlides services and get the default environment like them.
+type extraService struct {
+	Image             string            `yaml:"image" json:"image"`
+	Command           []string          `yaml:"command" json:"command,omitempty"`
+	Port              int               `yaml:"port" json:"port,omitempty"`
+	Environment       map[string]string `yaml:"environment" json:"environment,omitempty"`
+	Networks          []string          `yaml:"networks" json:"networks,omitempty"`
+	Volumes           []string          `yaml:"volumes" json:"volumes,omitempty"`
+	Secrets           []string          `yaml:"secrets" json:"secrets,omitempty"`
+	Resources         *resources        `yaml:"resources" json:"resources,omitempty"`
+	Healthcheck       *healthcheck      `yaml:"healthcheck" json:"healthcheck,omitempty"`
+	Restart           string            `yaml:"restart" json:"restart,omitempty"`
+	Deploy            *deploy           `yaml:"deploy" json:"deploy,omitempty"`
+	AdditionalContent json.RawMessage   `yaml:"additionalContent" json:"additionalContent,omitempty"`
+}
+
+// namedExtraService is an extra service together with its name as used by
+// the templates.
+type namedExtraService struct {
+	Name string
+	extraService
+}
+
+// networkNames contains all networks a service can join.
+var networkNames = []string{"uplink", "frontend", "data"}
+
+var (
+	extraServiceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+	secretNameRegexp       = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`)
+)
+
+// extraServices returns all extra services sorted by name.
+func extraServices(cfg *YmlConfig) []namedExtraService {
+	names := make([]string, 0, len(cfg.ExtraServices))
+	for name := range cfg.ExtraServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]namedExtraService, len(names))
+	for i, name := range names {
+		result[i] = namedExtraService{Name: name, extraService: cfg.ExtraServices[name]}
+	}
+	return result
+}
+
+// extraWorkloads returns the workloads of all extra services.
+func extraWorkloads(cfg *YmlConfig) []workload {
+	var result []workload
+	for _, s := range extraServices(cfg) {
+		env := make(map[string]string)
+		for k, v := range cfg.DefaultEnvironment {
+			env[k] = v
+		}
+		for k, v := range s.Environment {
+			env[k] = v
+		}
+		result = append(result, workload{
+			Name:        s.Name,
+			Image:       s.Image,
+			Port:        s.Port,
+			Command:     s.Command,
+			Networks:    s.Networks,
+			Secrets:     s.Secrets,
+			Environment: sortedEnv(env),
+			Volumes:     s.Volumes,
+		})
+	}
+	return result
+}
+
+// extraSecrets returns the names of all secrets of the extra services which
+// are not one of the secrets of the OpenSlides services. The Docker Compose
+// template has to declare them additionally.
+func extraSecrets(cfg *YmlConfig) []string {
+	known := map[string]bool{
+		PostgresCAFileName:    true,
+		EmailPasswordFileName: true,
+		ManagePolicyFileName:  true,
+		"ca_crt":              true,
+		"cert_crt":            true,
+		"cert_key":            true,
+	}
+	for _, spec := range serviceSpecs {
+		for _, name := range spec.secrets {
+			known[name] = true
+		}
+	}
+	var result []string
+	for _, name := range workloadSecrets(extraWorkloads(cfg)) {
+		if !known[name] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// checkExtraServices checks the extra services of the merged config. The names
+// must not collide with OpenSlides services, also not after converting them
+// to lowercase for Kubernetes.
+func checkExtraServices(cfg *YmlConfig) error {
+	for _, s := range extraServices(cfg) {
+		if err := checkExtraServiceName(s.Name); err != nil {
+			return fmt.Errorf("extra service %q: %w", s.Name, err)
+		}
+		if s.Image == "" {
+			return fmt.Errorf("extra service %q: image is missing", s.Name)
+		}
+		for _, n := range s.Networks {
+			if err := checkEnum(networkNames...)(n); err != nil {
+				return fmt.Errorf("extra service %q: network %q: %w", s.Name, n, err)
+			}
+		}
+		for _, n := range s.Secrets {
+			if err := checkSecretName(n); err != nil {
+				return fmt.Errorf("extra service %q: secret %q: %w", s.Name, n, err)
+			}
+		}
+		if len(s.Volumes) > 0 && cfg.Target == TargetKubernetes {
+			return fmt.Errorf("extra service %q: volumes are not supported for target %s", s.Name, TargetKubernetes)
+		}
+	}
+	return nil
+}
+
+func checkExtraServiceName(name string) error {
+	if !extraServiceNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid name, use only letters, digits and hyphens")
+	}
+	for _, known := range allServices() {
+		if strings.EqualFold(name, known) {
+			return fmt.Errorf("name is already used by an OpenSlides service")
+		}
+	}
+	return nil
+}
+
+func checkSecretName(name string) error {
+	if !secretNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid name, use only letters, digits, dots, hyphens and underscores")
+	}
+	return nil
+}
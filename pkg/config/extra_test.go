@@ -0,0 +1,90 @@
+package config_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+const extraServicesConfig = `---
+postgresContainerUser: "1000:1000"
+extraServices:
+  backup:
+    image: example.com/backup-agent:1.2
+    command: ["backup", "--schedule", "@daily"]
+    environment:
+      BACKUP_TARGET: s3://backups
+    networks:
+      - data
+    volumes:
+      - ./backups:/backups
+    secrets:
+      - postgres_password
+      - backup_key
+  exporter:
+    image: example.com/exporter:latest
+    port: 9187
+    networks:
+      - data
+    additionalContent:
+      restart: always
+`
+
+func TestExtraServices(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	t.Run("running config.Config() with extra services", func(t *testing.T) {
+		if err := config.Validate("extra.yml", []byte(extraServicesConfig)); err != nil {
+			t.Fatalf("validating config: %v", err)
+		}
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(extraServicesConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testGoldenFile(t, path.Join(testDir, "docker-compose.yml"), "docker-compose-extra.yml")
+	})
+
+	t.Run("running config.Config() with extra services for target swarm", func(t *testing.T) {
+		c := [][]byte{[]byte(extraServicesConfig), config.TargetConfig(config.TargetSwarm)}
+		if err := config.Config(testDir, false, nil, c); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-stack.yml"))
+		if err != nil {
+			t.Fatalf("reading stack file: %v", err)
+		}
+		got := string(content)
+		for _, expected := range []string{
+			"\n  backup:\n    image: example.com/backup-agent:1.2\n",
+			"\n      BACKUP_TARGET: \"s3://backups\"\n",
+			"\n    volumes:\n      - \"./backups:/backups\"\n",
+			"\n  exporter:\n    image: example.com/exporter:latest\n",
+			"\n    restart: always\n",
+			"\n  backup_key:\n    external: true\n",
+		} {
+			if !strings.Contains(got, expected) {
+				t.Fatalf("stack file does not contain %q, got\n%s", expected, got)
+			}
+		}
+	})
+
+	t.Run("extra services with invalid values", func(t *testing.T) {
+		for _, c := range []string{
+			"extraServices:\n  backup:\n    networks: [data]\n",
+			"extraServices:\n  Proxy:\n    image: example.com/proxy\n",
+			"extraServices:\n  backup:\n    image: example.com/backup\n    networks: [internet]\n",
+			"extraServices:\n  backup:\n    image: example.com/backup\n    secrets: [../key]\n",
+			"target: kubernetes\nextraServices:\n  backup:\n    image: example.com/backup\n    volumes: [./backups:/backups]\n",
+		} {
+			if _, err := config.NewYmlConfig([][]byte{[]byte(c)}); err == nil {
+				t.Fatalf("creating config %q should fail", c)
+			}
+		}
+	})
+}
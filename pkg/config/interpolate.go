@@ -0,0 +1,288 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	interpolationEnv  = "ENV"
+	interpolationFile = "FILE"
+)
+
+// interpolation is one reference like ${ENV:NAME} or ${FILE:path:-default}
+// in a string value of the setup configuration.
+type interpolation struct {
+	source     string // One of interpolationEnv and interpolationFile.
+	name       string
+	def        string
+	hasDefault bool
+}
+
+// interpolate replaces all references to environment variables and files in
+// all string values of the given config. Use ${ENV:NAME} for the environment
+// variable NAME and ${FILE:path} for the content of the file at path without
+// trailing newlines. Relative paths must have been resolved against the
+// directory of the config file before, see absFileReferences. A default can be given like ${ENV:NAME:-default}. It is used if
+// the variable is not set or empty or if the file does not exist. All other
+// ${...} like Docker Compose variables and the Docker Compose escape $${ are
+// kept unchanged.
+func interpolate(cfg *YmlConfig) error {
+	return interpolateValue(reflect.ValueOf(cfg).Elem(), "")
+}
+
+func interpolateValue(v reflect.Value, p string) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := expand(v.String(), resolve)
+		if err != nil {
+			return fmt.Errorf("value of %q: %w", p, err)
+		}
+		v.SetString(s)
+
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return interpolateValue(v.Elem(), p)
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				// Unexported field
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if err := interpolateValue(v.Field(i), joinPath(p, name)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			// Map values are not addressable so we work on a copy.
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+			if err := interpolateValue(elem, joinPath(p, k.String())); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, elem)
+		}
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Raw content like additionalContent is not interpolated.
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := interpolateValue(v.Index(i), fmt.Sprintf("%s[%d]", p, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func joinPath(p, name string) string {
+	if p == "" {
+		return name
+	}
+	return p + "." + name
+}
+
+// expand replaces all references in s using the given resolve function. Only
+// references starting with ${ENV: or ${FILE: are replaced. They are not
+// replaced if they are escaped for Docker Compose like $${ENV:NAME}.
+func expand(s string, resolve func(interpolation) (string, error)) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i == -1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if (i > 0 && s[i-1] == '$') || !isReference(s[i+2:]) {
+			// Docker Compose variable or escape
+			b.WriteString(s[:i+2])
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+
+		end := strings.Index(s[i:], "}")
+		if end == -1 {
+			return "", fmt.Errorf("unterminated reference %q", s[i:])
+		}
+		ref, err := parseInterpolation(s[i+2 : i+end])
+		if err != nil {
+			return "", err
+		}
+		value, err := resolve(ref)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// isReference reports whether the part after ${ starts with one of the
+// sources of the references.
+func isReference(s string) bool {
+	return strings.HasPrefix(s, interpolationEnv+":") || strings.HasPrefix(s, interpolationFile+":")
+}
+
+// parseInterpolation parses the part between ${ and }.
+func parseInterpolation(expr string) (interpolation, error) {
+	parts := strings.SplitN(expr, ":", 2)
+	if len(parts) != 2 || (parts[0] != interpolationEnv && parts[0] != interpolationFile) {
+		return interpolation{}, fmt.Errorf("invalid reference ${%s}, use ${%s:NAME} or ${%s:path}", expr, interpolationEnv, interpolationFile)
+	}
+	ref := interpolation{source: parts[0], name: parts[1]}
+	if i := strings.Index(ref.name, ":-"); i != -1 {
+		ref.def = ref.name[i+2:]
+		ref.hasDefault = true
+		ref.name = ref.name[:i]
+	}
+	if ref.name == "" {
+		return interpolation{}, fmt.Errorf("invalid reference ${%s}, name is missing", expr)
+	}
+	return ref, nil
+}
+
+// String returns the reference in the form it is written in the config.
+func (ref interpolation) String() string {
+	s := "${" + ref.source + ":" + ref.name
+	if ref.hasDefault {
+		s += ":-" + ref.def
+	}
+	return s + "}"
+}
+
+// absFileReferences rewrites the relative paths of all ${FILE:path} references
+// in the given setup configuration YAML file to absolute paths using dir as
+// base directory. So the file gives the same result regardless of the current
+// working directory. Raw content like additionalContent is kept unchanged
+// because it is not interpolated. The content is only encoded again if a
+// reference was changed.
+func absFileReferences(content []byte, dir string) ([]byte, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("getting absolute path of %q: %w", dir, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshaling YAML: %w", err)
+	}
+
+	var changed bool
+	var walk func(n *yaml.Node) error
+	walk = func(n *yaml.Node) error {
+		switch n.Kind {
+		case yaml.ScalarNode:
+			s, err := expand(n.Value, func(ref interpolation) (string, error) {
+				if ref.source == interpolationFile && !filepath.IsAbs(ref.name) {
+					ref.name = filepath.Join(dir, ref.name)
+					changed = true
+				}
+				return ref.String(), nil
+			})
+			if err != nil {
+				return err
+			}
+			n.Value = s
+
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == "additionalContent" {
+					continue
+				}
+				if err := walk(n.Content[i+1]); err != nil {
+					return err
+				}
+			}
+
+		default:
+			for _, c := range n.Content {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(&doc); err != nil {
+		return nil, err
+	}
+	if !changed {
+		return content, nil
+	}
+
+	buf := new(bytes.Buffer)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("encoding YAML: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// resolve returns the value of the given reference from the environment or the
+// filesystem.
+func resolve(ref interpolation) (string, error) {
+	switch ref.source {
+	case interpolationEnv:
+		value, ok := os.LookupEnv(ref.name)
+		if ref.hasDefault && value == "" {
+			return ref.def, nil
+		}
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", ref.name)
+		}
+		return value, nil
+
+	default:
+		content, err := os.ReadFile(ref.name)
+		if err != nil {
+			if ref.hasDefault && os.IsNotExist(err) {
+				return ref.def, nil
+			}
+			return "", fmt.Errorf("reading file %q: %w", ref.name, err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+}
+
+// checkInterpolation checks the syntax of all references in s without
+// resolving them.
+func checkInterpolation(s string) error {
+	_, err := expand(s, func(interpolation) (string, error) { return "", nil })
+	return err
+}
+
+// hasInterpolation reports whether s contains a reference.
+func hasInterpolation(s string) bool {
+	var found bool
+	expand(s, func(interpolation) (string, error) {
+		found = true
+		return "", nil
+	})
+	return found
+}
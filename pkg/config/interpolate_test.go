@@ -0,0 +1,168 @@
+package config_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+func TestInterpolation(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	smtpPassFile := path.Join(testDir, "smtp_pass")
+	if err := os.WriteFile(smtpPassFile, []byte("my-smtp-password\n"), 0666); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	t.Setenv("OS_DOMAIN", "openslides.example.com")
+	t.Setenv("OS_REGISTRY", "registry.example.com/openslides")
+	t.Setenv("OS_PORT", "8443")
+
+	t.Run("interpolating environment variables and files", func(t *testing.T) {
+		customConfig := `---
+port: ${ENV:OS_PORT}
+defaults:
+  containerRegistry: ${ENV:OS_REGISTRY}
+defaultEnvironment:
+  SYSTEM_URL: https://${ENV:OS_DOMAIN}
+services:
+  backendAction:
+    environment:
+      EMAIL_PASSWORD: ${FILE:` + smtpPassFile + `}
+      EMAIL_HOST: ${ENV:OS_SMTP_HOST:-localhost}
+      LITERAL: $${ENV:OS_DOMAIN}
+`
+		cfg, err := config.NewYmlConfig([][]byte{[]byte(customConfig)})
+		if err != nil {
+			t.Fatalf("creating new YML config object: %v", err)
+		}
+		if cfg.Port != "8443" {
+			t.Fatalf("wrong port, got %q, expected %q", cfg.Port, "8443")
+		}
+		if cfg.Services["vote"].ContainerRegistry != "registry.example.com/openslides" {
+			t.Fatalf("wrong container registry, got %q", cfg.Services["vote"].ContainerRegistry)
+		}
+		if got := cfg.DefaultEnvironment["SYSTEM_URL"]; got != "https://openslides.example.com" {
+			t.Fatalf("wrong SYSTEM_URL, got %q", got)
+		}
+		env := cfg.Services["backendAction"].Environment
+		for k, v := range map[string]string{
+			"EMAIL_PASSWORD": "my-smtp-password",
+			"EMAIL_HOST":     "localhost",
+			"LITERAL":        "$${ENV:OS_DOMAIN}",
+		} {
+			if env[k] != v {
+				t.Fatalf("wrong value for %s, got %q, expected %q", k, env[k], v)
+			}
+		}
+	})
+
+	for _, tt := range []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{
+			name:    "undefined environment variable",
+			content: "---\nhost: ${ENV:OS_UNDEFINED}\n",
+			errMsg:  `value of "host": environment variable "OS_UNDEFINED" is not set`,
+		},
+		{
+			name:    "missing file",
+			content: "---\nservices:\n  proxy:\n    environment:\n      FOO: ${FILE:" + path.Join(testDir, "unknown") + "}\n",
+			errMsg:  `value of "services.proxy.environment.FOO": reading file`,
+		},
+		{
+			name:    "missing name",
+			content: "---\nhost: ${ENV:}\n",
+			errMsg:  `invalid reference ${ENV:}, name is missing`,
+		},
+		{
+			name:    "invalid value after interpolation",
+			content: "---\nport: ${ENV:OS_DOMAIN}\n",
+			errMsg:  `"openslides.example.com" is not a valid port number`,
+		},
+	} {
+		t.Run("interpolating with "+tt.name, func(t *testing.T) {
+			_, err := config.NewYmlConfig([][]byte{[]byte(tt.content)})
+			if err == nil {
+				t.Fatalf("creating new YML config object should fail")
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("got error message %q, expected %q", err.Error(), tt.errMsg)
+			}
+		})
+	}
+
+	t.Run("keeping Docker Compose variables", func(t *testing.T) {
+		// The values are rendered like before references were introduced, so
+		// Docker Compose still substitutes ${FOO} and unescapes $${FOO}.
+		customConfig := "---\nservices:\n  backendAction:\n    environment:\n      VARIABLE: ${FOO}\n      ESCAPED: $${FOO}\n      MIXED: ${FOO}-${ENV:OS_PORT}-$$${BAR:-x}\n"
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testFileContains(t, testDir, "docker-compose.yml", "      VARIABLE: ${FOO}\n")
+		testFileContains(t, testDir, "docker-compose.yml", "      ESCAPED: $${FOO}\n")
+		testFileContains(t, testDir, "docker-compose.yml", "      MIXED: ${FOO}-8443-$$${BAR:-x}\n")
+	})
+
+	t.Run("resolving relative file paths against the directory of the config file", func(t *testing.T) {
+		configDir := path.Join(testDir, "config")
+		if err := os.MkdirAll(configDir, os.ModePerm); err != nil {
+			t.Fatalf("creating directory: %v", err)
+		}
+		if err := os.WriteFile(path.Join(configDir, "smtp_pass"), []byte("relative-password\n"), 0666); err != nil {
+			t.Fatalf("writing file: %v", err)
+		}
+		customConfig := `---
+services:
+  backendAction:
+    environment:
+      EMAIL_PASSWORD: ${FILE:./smtp_pass}
+      LITERAL: $${FILE:./smtp_pass}
+    additionalContent:
+      labels:
+        password: ${FILE:./smtp_pass}
+`
+		configFile := path.Join(configDir, "config.yml")
+		if err := os.WriteFile(configFile, []byte(customConfig), 0666); err != nil {
+			t.Fatalf("writing file: %v", err)
+		}
+
+		// The tests run in the directory of the package, not in configDir.
+		configFiles, err := config.ReadConfigFiles([]string{configFile})
+		if err != nil {
+			t.Fatalf("reading config files: %v", err)
+		}
+		cfg, err := config.NewYmlConfig(configFiles)
+		if err != nil {
+			t.Fatalf("creating new YML config object: %v", err)
+		}
+		env := cfg.Services["backendAction"].Environment
+		if got := env["EMAIL_PASSWORD"]; got != "relative-password" {
+			t.Fatalf("wrong value for EMAIL_PASSWORD, got %q, expected %q", got, "relative-password")
+		}
+		if got := env["LITERAL"]; got != "$${FILE:./smtp_pass}" {
+			t.Fatalf("wrong value for LITERAL, got %q, expected %q", got, "$${FILE:./smtp_pass}")
+		}
+		if got := string(cfg.Services["backendAction"].AdditionalContent); !strings.Contains(got, "${FILE:./smtp_pass}") {
+			t.Fatalf("additional content was changed, got %s", got)
+		}
+	})
+
+	t.Run("validating config with references", func(t *testing.T) {
+		if err := config.Validate("custom.yml", []byte("---\nport: ${ENV:OS_PORT}\n")); err != nil {
+			t.Fatalf("validating config: %v", err)
+		}
+		err := config.Validate("custom.yml", []byte("---\nhost: ${ENV:OS_DOMAIN\n"))
+		if err == nil || !strings.Contains(err.Error(), "custom.yml:2:7: value of \"host\": unterminated reference") {
+			t.Fatalf("got error %v, expected unterminated reference", err)
+		}
+	})
+}
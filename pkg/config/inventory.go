@@ -0,0 +1,302 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// InstanceFileName is the name of the setup configuration YAML file which
+	// is written to the directory of every instance of an inventory. It keeps
+	// the allocated port so that later runs use the same port.
+	InstanceFileName = "instance.yml"
+
+	defaultInventoryBasePort = 8000
+)
+
+var instanceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// FlagInventory setups the inventory flag to the given cobra command.
+func FlagInventory(cmd *cobra.Command) *string {
+	return cmd.Flags().String("inventory", "", "inventory file with several instances, replaces the directory argument")
+}
+
+// ArgsDirectoryOrInventory returns a cobra.PositionalArgs which requires
+// exactly one directory argument unless the inventory flag is given.
+func ArgsDirectoryOrInventory(inventory *string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if *inventory == "" {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		if len(args) > 0 {
+			return fmt.Errorf("do not give a directory together with the inventory flag")
+		}
+		return nil
+	}
+}
+
+// Inventory contains several OpenSlides instances which are set up with the
+// same setup configuration YAML files and their own overrides.
+type Inventory struct {
+	// BasePort is the first host port used for instances without port.
+	BasePort  int        `json:"basePort"`
+	Instances []Instance `json:"instances"`
+}
+
+// Instance is one OpenSlides instance of an inventory.
+type Instance struct {
+	Name string `json:"name"`
+
+	// Directory is the setup directory of the instance. Relative paths are
+	// relative to the directory of the inventory file. It defaults to the
+	// name.
+	Directory string `json:"directory"`
+
+	// Port is the host port of the proxy service. It is allocated if empty.
+	Port string `json:"port"`
+
+	// Domain is used as SYSTEM_URL and as DNS name of the certificate.
+	Domain string `json:"domain"`
+
+	// Config contains setup configuration overrides for this instance.
+	Config json.RawMessage `json:"config"`
+}
+
+// ReadInventory reads the given inventory file. The directories of the
+// instances are resolved and the ports are allocated.
+func ReadInventory(filename string) (*Inventory, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %q: %w", filename, err)
+	}
+	inv, err := ParseInventory(content, filepath.Dir(filename))
+	if err != nil {
+		return nil, fmt.Errorf("parsing inventory %q: %w", filename, err)
+	}
+	return inv, nil
+}
+
+// ParseInventory parses the given inventory. Relative directories and relative
+// paths of file references in the instance configs are resolved against
+// baseDir. Instances without port get the port from the instance file of an
+// earlier run or the lowest free port starting at the base port.
+func ParseInventory(content []byte, baseDir string) (*Inventory, error) {
+	inv := new(Inventory)
+	if err := yaml.Unmarshal(content, inv); err != nil {
+		return nil, fmt.Errorf("unmarshaling YAML: %w", err)
+	}
+	if len(inv.Instances) == 0 {
+		return nil, fmt.Errorf("inventory does not contain any instance")
+	}
+	if inv.BasePort == 0 {
+		inv.BasePort = defaultInventoryBasePort
+	}
+
+	names := make(map[string]bool)
+	dirs := make(map[string]string)
+	for i := range inv.Instances {
+		instance := &inv.Instances[i]
+		if !instanceNameRegexp.MatchString(instance.Name) {
+			return nil, fmt.Errorf("instance %d: invalid name %q", i+1, instance.Name)
+		}
+		if names[instance.Name] {
+			return nil, fmt.Errorf("instance %q: name is used more than once", instance.Name)
+		}
+		names[instance.Name] = true
+
+		if instance.Directory == "" {
+			instance.Directory = instance.Name
+		}
+		if !filepath.IsAbs(instance.Directory) {
+			instance.Directory = filepath.Join(baseDir, instance.Directory)
+		}
+		instance.Directory = filepath.Clean(instance.Directory)
+		if other, ok := dirs[instance.Directory]; ok {
+			return nil, fmt.Errorf("instance %q: directory %q is also used by instance %q", instance.Name, instance.Directory, other)
+		}
+		dirs[instance.Directory] = instance.Name
+
+		if len(instance.Config) > 0 && string(instance.Config) != "null" {
+			if err := Validate(fmt.Sprintf("instance %s", instance.Name), instance.Config); err != nil {
+				return nil, err
+			}
+			c, err := absFileReferences(instance.Config, baseDir)
+			if err != nil {
+				return nil, fmt.Errorf("instance %q: resolving file references: %w", instance.Name, err)
+			}
+			instance.Config = c
+		}
+	}
+
+	if err := allocatePorts(inv); err != nil {
+		return nil, fmt.Errorf("allocating ports: %w", err)
+	}
+	return inv, nil
+}
+
+// allocatePorts sets the port of all instances without port. Ports of earlier
+// runs are kept, so adding an instance does not change the other ones.
+func allocatePorts(inv *Inventory) error {
+	used := make(map[int]string)
+	use := func(instance *Instance) error {
+		if err := checkPort(instance.Port); err != nil {
+			return fmt.Errorf("instance %q: %w", instance.Name, err)
+		}
+		port, _ := strconv.Atoi(instance.Port)
+		if other, ok := used[port]; ok {
+			return fmt.Errorf("instance %q: port %d is also used by instance %q", instance.Name, port, other)
+		}
+		used[port] = instance.Name
+		return nil
+	}
+
+	var pending []*Instance
+	for i := range inv.Instances {
+		instance := &inv.Instances[i]
+		if instance.Port != "" {
+			if err := use(instance); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range inv.Instances {
+		instance := &inv.Instances[i]
+		if instance.Port != "" {
+			continue
+		}
+		port, err := readInstancePort(instance.Directory)
+		if err != nil {
+			return fmt.Errorf("instance %q: %w", instance.Name, err)
+		}
+		if port == "" {
+			pending = append(pending, instance)
+			continue
+		}
+		instance.Port = port
+		if err := use(instance); err != nil {
+			return err
+		}
+	}
+
+	next := inv.BasePort
+	for _, instance := range pending {
+		for used[next] != "" {
+			next++
+		}
+		if next > 65535 {
+			return fmt.Errorf("instance %q: no free port left", instance.Name)
+		}
+		instance.Port = strconv.Itoa(next)
+		used[next] = instance.Name
+	}
+	return nil
+}
+
+// readInstancePort returns the port in the instance file in the given
+// directory or an empty string if there is no such file.
+func readInstancePort(dir string) (string, error) {
+	p := path.Join(dir, InstanceFileName)
+	content, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("reading file %q: %w", p, err)
+	}
+	var c struct {
+		Port string `json:"port"`
+	}
+	if err := yaml.Unmarshal(content, &c); err != nil {
+		return "", fmt.Errorf("unmarshaling file %q: %w", p, err)
+	}
+	return c.Port, nil
+}
+
+// instanceFile returns the content of the instance file. It contains the port
+// and the domain of the instance.
+func (i Instance) instanceFile() []byte {
+	content := fmt.Sprintf("---\n# Written by the setup and config commands from the inventory. Changes are\n# overwritten.\nport: %q\n", i.Port)
+	if i.Domain != "" {
+		content += fmt.Sprintf("defaultEnvironment:\n  SYSTEM_URL: %q\ncertificate:\n  dnsNames:\n    - %q\n", i.Domain, i.Domain)
+	}
+	return []byte(content)
+}
+
+// ConfigFiles returns the setup configuration YAML files of the instance: the
+// instance file and the overrides of the instance. They have to be merged after
+// the setup configuration YAML files given for all instances.
+func (i Instance) ConfigFiles() [][]byte {
+	result := [][]byte{i.instanceFile()}
+	if len(i.Config) > 0 && string(i.Config) != "null" {
+		result = append(result, i.Config)
+	}
+	return result
+}
+
+// InstanceResult is the result of running a command for one instance of an
+// inventory.
+type InstanceResult struct {
+	Instance Instance
+	Err      error
+}
+
+// RunInventory writes the instance file of every instance and calls fn with
+// the instance. It does not stop at the first failed instance. A summary table
+// is written to w. It returns an error if at least one instance failed.
+func RunInventory(w io.Writer, inv *Inventory, fn func(instance Instance) error) error {
+	results := make([]InstanceResult, 0, len(inv.Instances))
+	for _, instance := range inv.Instances {
+		err := runInstance(instance, fn)
+		results = append(results, InstanceResult{Instance: instance, Err: err})
+	}
+	PrintInventoryResults(w, results)
+
+	var failed int
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d instances failed", failed, len(results))
+	}
+	return nil
+}
+
+func runInstance(instance Instance, fn func(instance Instance) error) error {
+	if err := os.MkdirAll(instance.Directory, os.ModePerm); err != nil {
+		return fmt.Errorf("creating directory at %q: %w", instance.Directory, err)
+	}
+	if err := shared.CreateFile(instance.Directory, true, InstanceFileName, instance.instanceFile()); err != nil {
+		return fmt.Errorf("creating instance file: %w", err)
+	}
+	return fn(instance)
+}
+
+// PrintInventoryResults writes the results as table to w.
+func PrintInventoryResults(w io.Writer, results []InstanceResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDIRECTORY\tPORT\tDOMAIN\tRESULT")
+	for _, r := range results {
+		result := "OK"
+		if r.Err != nil {
+			result = fmt.Sprintf("FAILED: %v", r.Err)
+		}
+		i := r.Instance
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", i.Name, i.Directory, i.Port, i.Domain, result)
+	}
+	tw.Flush()
+}
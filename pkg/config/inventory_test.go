@@ -0,0 +1,169 @@
+package config_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+const testInventory = `---
+basePort: 9000
+instances:
+  - name: org-a
+    domain: a.example.com
+  - name: org-b
+    port: 9000
+    config:
+      services:
+        backendAction:
+          tag: 4.0.1
+  - name: org-c
+    directory: custom/org-c
+`
+
+func TestInventory(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	invFile := path.Join(testDir, "instances.yml")
+	if err := os.WriteFile(invFile, []byte(testInventory), 0644); err != nil {
+		t.Fatalf("writing inventory: %v", err)
+	}
+
+	t.Run("reading inventory", func(t *testing.T) {
+		inv, err := config.ReadInventory(invFile)
+		if err != nil {
+			t.Fatalf("reading inventory: %v", err)
+		}
+		expected := map[string][2]string{
+			"org-a": {path.Join(testDir, "org-a"), "9001"},
+			"org-b": {path.Join(testDir, "org-b"), "9000"},
+			"org-c": {path.Join(testDir, "custom/org-c"), "9002"},
+		}
+		for _, instance := range inv.Instances {
+			e := expected[instance.Name]
+			if instance.Directory != e[0] || instance.Port != e[1] {
+				t.Fatalf("wrong directory or port of instance %q, expected %v, got %q and %q", instance.Name, e, instance.Directory, instance.Port)
+			}
+		}
+	})
+
+	t.Run("running config.RunInventory() with config.Config()", func(t *testing.T) {
+		inv, err := config.ReadInventory(invFile)
+		if err != nil {
+			t.Fatalf("reading inventory: %v", err)
+		}
+		buf := new(bytes.Buffer)
+		if err := config.RunInventory(buf, inv, func(instance config.Instance) error {
+			return config.Config(instance.Directory, false, nil, instance.ConfigFiles())
+		}); err != nil {
+			t.Fatalf("running config.RunInventory() failed with error: %v", err)
+		}
+		if !strings.Contains(buf.String(), "org-c") || strings.Contains(buf.String(), "FAILED") {
+			t.Fatalf("wrong summary, got\n%s", buf.String())
+		}
+
+		content, err := os.ReadFile(path.Join(testDir, "org-a", "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		for _, expected := range []string{"127.0.0.1:9001:8000", "SYSTEM_URL: a.example.com"} {
+			if !strings.Contains(string(content), expected) {
+				t.Fatalf("compose file of org-a does not contain %q, got\n%s", expected, content)
+			}
+		}
+		content, err = os.ReadFile(path.Join(testDir, "org-b", "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		if !strings.Contains(string(content), "openslides-backend:4.0.1") {
+			t.Fatalf("compose file of org-b does not contain the overridden tag, got\n%s", content)
+		}
+	})
+
+	t.Run("executing config with inventory and dry-run flag", func(t *testing.T) {
+		cmd := config.Cmd()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetArgs([]string{"--inventory", invFile, "--dry-run"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing config subcommand with inventory and dry-run flag: %v", err)
+		}
+
+		customConfigFileName := path.Join(testDir, "custom-config.yml")
+		if err := os.WriteFile(customConfigFileName, []byte("---\ndefaultEnvironment:\n  FOO: bar\n"), 0644); err != nil {
+			t.Fatalf("writing custom config file: %v", err)
+		}
+		cmd = config.Cmd()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetArgs([]string{"--inventory", invFile, "--dry-run", "--config", customConfigFileName})
+		err := cmd.Execute()
+		var errExit interface {
+			ExitCode() int
+		}
+		if !errors.As(err, &errExit) || errExit.ExitCode() != 2 {
+			t.Fatalf("executing config subcommand with inventory, dry-run flag and changes should return exit code 2, got error %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "org-a", "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		if strings.Contains(string(content), "FOO: bar") {
+			t.Fatalf("dry-run must not change the compose file")
+		}
+	})
+
+	t.Run("rerunning with a new instance keeps the ports", func(t *testing.T) {
+		inventory := strings.Replace(testInventory, "instances:\n", "instances:\n  - name: org-new\n", 1)
+		inv, err := config.ParseInventory([]byte(inventory), testDir)
+		if err != nil {
+			t.Fatalf("parsing inventory: %v", err)
+		}
+		expected := map[string]string{"org-new": "9003", "org-a": "9001", "org-b": "9000", "org-c": "9002"}
+		for _, instance := range inv.Instances {
+			if instance.Port != expected[instance.Name] {
+				t.Fatalf("wrong port of instance %q, expected %q, got %q", instance.Name, expected[instance.Name], instance.Port)
+			}
+		}
+	})
+
+	t.Run("resolving file references of instance configs against the inventory directory", func(t *testing.T) {
+		if err := os.WriteFile(path.Join(testDir, "org_d_token"), []byte("token-d\n"), 0666); err != nil {
+			t.Fatalf("writing file: %v", err)
+		}
+		inventory := "instances:\n  - name: org-d\n    config:\n      defaultEnvironment:\n        TOKEN: ${FILE:./org_d_token}\n"
+		inv, err := config.ParseInventory([]byte(inventory), testDir)
+		if err != nil {
+			t.Fatalf("parsing inventory: %v", err)
+		}
+		cfg, err := config.NewYmlConfig(inv.Instances[0].ConfigFiles())
+		if err != nil {
+			t.Fatalf("creating new YML config object: %v", err)
+		}
+		if got := cfg.DefaultEnvironment["TOKEN"]; got != "token-d" {
+			t.Fatalf("wrong value for TOKEN, got %q, expected %q", got, "token-d")
+		}
+	})
+
+	t.Run("parsing invalid inventories", func(t *testing.T) {
+		for _, inventory := range []string{
+			"instances: []\n",
+			"instances:\n  - name: a\n  - name: a\n",
+			"instances:\n  - name: a\n    port: 8001\n  - name: b\n    port: 8001\n",
+			"instances:\n  - name: a\n    directory: x\n  - name: b\n    directory: x\n",
+			"instances:\n  - name: a\n    config:\n      services:\n        unknown: {}\n",
+			"instances:\n  - name: ../a\n",
+		} {
+			if _, err := config.ParseInventory([]byte(inventory), testDir); err == nil {
+				t.Fatalf("parsing inventory %q should fail", inventory)
+			}
+		}
+	})
+}
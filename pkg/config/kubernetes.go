@@ -0,0 +1,38 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+)
+
+// secretsDirName is the name of the directory for the secrets relative to
+// the setup directory. It has to be the same as in the setup package.
+const secretsDirName = "secrets"
+
+// kubernetesWorkloads returns all workloads for the given config. The names are
+// lowercase because Kubernetes object names must be DNS labels.
+func kubernetesWorkloads(cfg *YmlConfig) []workload {
+	result := append(workloads(cfg), extraWorkloads(cfg)...)
+	for i := range result {
+		result[i].Name = strings.ToLower(result[i].Name)
+	}
+	return result
+}
+
+// secretDataFunc returns a template function that reads a secret from the
+// secrets directory in the given setup directory and encodes it in base64
+// as required for the data field of Kubernetes secrets.
+func secretDataFunc(dir string) func(string) (string, error) {
+	return func(name string) (string, error) {
+		p := path.Join(dir, secretsDirName, name)
+		content, err := shared.ReadSecretFile(p)
+		if err != nil {
+			return "", fmt.Errorf("reading secret (secrets are created by the setup command): %w", err)
+		}
+		return base64.StdEncoding.EncodeToString(content), nil
+	}
+}
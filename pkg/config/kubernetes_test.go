@@ -0,0 +1,104 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata directory")
+
+func TestKubernetesTarget(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	secDir := path.Join(testDir, "secrets")
+	if err := os.Mkdir(secDir, os.ModePerm); err != nil {
+		t.Fatalf("creating secrets directory: %v", err)
+	}
+	for _, name := range []string{"auth_token_key", "auth_cookie_key", "superadmin", "manage_auth_password", "internal_auth_password", "postgres_password", "cert_crt", "cert_key"} {
+		if err := os.WriteFile(path.Join(secDir, name), []byte("secret_"+name), 0600); err != nil {
+			t.Fatalf("writing secret file: %v", err)
+		}
+	}
+
+	t.Run("running config.Config() with target kubernetes", func(t *testing.T) {
+		c := [][]byte{config.TargetConfig(config.TargetKubernetes)}
+		if err := config.Config(testDir, false, nil, c); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testGoldenFile(t, path.Join(testDir, "kubernetes.yml"), "kubernetes.yml")
+		fi, err := os.Stat(path.Join(testDir, "kubernetes.yml"))
+		if err != nil {
+			t.Fatalf("getting file info: %v", err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Fatalf("wrong mode of manifest file, got %o, expected %o", fi.Mode().Perm(), 0600)
+		}
+	})
+
+	t.Run("running config.Config() with target kubernetes and custom config", func(t *testing.T) {
+		customConfig := `---
+target: kubernetes
+filename: my-manifests.yml
+port: 443
+disablePostgres: true
+enableLocalHTTPS: false
+services:
+  backendAction:
+    tag: 4.0.1
+    environment:
+      EMAIL_HOST: mail.example.com
+`
+		c := [][]byte{[]byte(customConfig)}
+		if err := config.Config(testDir, false, nil, c); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testGoldenFile(t, path.Join(testDir, "my-manifests.yml"), "kubernetes-custom.yml")
+	})
+
+	t.Run("running config.Config() with target kubernetes without secrets", func(t *testing.T) {
+		emptyDir := path.Join(testDir, "empty")
+		c := [][]byte{config.TargetConfig(config.TargetKubernetes)}
+		if err := config.Config(emptyDir, false, nil, c); err == nil {
+			t.Fatalf("running config.Config() without secrets directory should fail")
+		}
+	})
+
+	t.Run("running config.Config() with invalid target", func(t *testing.T) {
+		c := [][]byte{config.TargetConfig("invalid_target_Eiz2ohng")}
+		if err := config.Config(testDir, false, nil, c); err == nil {
+			t.Fatalf("running config.Config() with invalid target should fail")
+		}
+	})
+}
+
+// testGoldenFile compares the content of the file at the given path with the
+// golden file of the given name in the testdata directory. Use the -update flag
+// to rewrite the golden file.
+func testGoldenFile(t testing.TB, p, golden string) {
+	t.Helper()
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("error reading file %q: %v", p, err)
+	}
+	goldenPath := path.Join("testdata", golden)
+	if *update {
+		if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+			t.Fatalf("error updating golden file %q: %v", goldenPath, err)
+		}
+	}
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("error reading golden file %q: %v", goldenPath, err)
+	}
+	if string(got) != string(expected) {
+		t.Fatalf("wrong content of file %q, got %q, expected content of golden file %q", p, got, goldenPath)
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ManagePolicyFileName is the name of the secrets file containing the policy
+// of the manage service.
+const ManagePolicyFileName = "manage_policy"
+
+// manageAuth contains the options for the authentication at the manage
+// service.
+type manageAuth struct {
+	ClientCertificates *bool             `yaml:"clientCertificates" json:"clientCertificates"`
+	Password           *bool             `yaml:"password" json:"password"`
+	Operators          map[string]string `yaml:"operators" json:"operators"`
+	PolicyFile         string            `yaml:"policyFile" json:"policyFile"`
+}
+
+// applyManageAuth adds the environment variables for client certificates and
+// the policy to the manage service. Variables given in the environment of the
+// service take precedence.
+func applyManageAuth(cfg *YmlConfig) error {
+	a := cfg.ManageAuth
+	env := make(map[string]string)
+	if a.PolicyFile != "" {
+		env["MANAGE_POLICY_FILE"] = "/run/secrets/" + ManagePolicyFileName
+	}
+
+	if !*a.ClientCertificates {
+		if !*a.Password {
+			return fmt.Errorf("manageAuth.password can only be disabled together with manageAuth.clientCertificates")
+		}
+		if len(a.Operators) > 0 {
+			return fmt.Errorf("manageAuth.operators requires manageAuth.clientCertificates")
+		}
+	} else {
+		if !*cfg.EnableManageTLS {
+			return fmt.Errorf("manageAuth.clientCertificates requires enableManageTLS")
+		}
+		if cfg.Certificate.CreateCA == nil || !*cfg.Certificate.CreateCA {
+			return fmt.Errorf("manageAuth.clientCertificates requires certificate.createCA because the client certificates are signed by the local CA")
+		}
+
+		env["MANAGE_CLIENT_CA_FILE"] = "/run/secrets/ca_crt"
+		if len(a.Operators) > 0 {
+			operators, err := json.Marshal(a.Operators)
+			if err != nil {
+				return fmt.Errorf("marshalling operators: %w", err)
+			}
+			env["MANAGE_OPERATORS"] = string(operators)
+		}
+		if !*a.Password {
+			env["MANAGE_PASSWORD_AUTH"] = "0"
+		}
+	}
+
+	if len(env) == 0 {
+		return nil
+	}
+
+	s := cfg.Services["manage"]
+	for k, v := range s.Environment {
+		env[k] = v
+	}
+	s.Environment = env
+	cfg.Services["manage"] = s
+	return nil
+}
@@ -0,0 +1,323 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/fehler"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigPinHelp contains the short help text for the command.
+	ConfigPinHelp = "Pins the images of all services to the digests of a release"
+
+	// ConfigPinHelpExtra contains the long help text for the command without the headline.
+	ConfigPinHelpExtra = `This command reads a release manifest and writes the image digests of all
+services to the file pins.yml in the given directory. Afterwards the container
+configuration YAML file is (re)created with images like image:tag@sha256:...
+Use pins.yml as last config file for later runs of the config command to keep
+the digests.
+
+The release manifest is a JSON or YAML file like this:
+
+  release: 4.0.15
+  services:
+    proxy: sha256:...
+    client: sha256:...
+    ...
+
+It must contain a digest for every service. The release flag must match the
+release of the manifest. The letter x matches every number, e. g. 4.0.x.`
+
+	// ConfigVerifyPinsHelp contains the short help text for the command.
+	ConfigVerifyPinsHelp = "Checks that all images in the container configuration YAML file are pinned to digests"
+
+	// ConfigVerifyPinsHelpExtra contains the long help text for the command without the headline.
+	ConfigVerifyPinsHelpExtra = `This command reads the container configuration YAML file in the given directory
+and reports all services whose images use a mutable tag instead of a digest.
+The command exits with code 2 if there are such services.`
+
+	// PinsFileName is the name of the setup configuration YAML file written by
+	// the config pin command.
+	PinsFileName = "pins.yml"
+)
+
+var digestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// cmdPin returns the config pin subcommand.
+func cmdPin() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pin directory",
+		Short: ConfigPinHelp,
+		Long:  ConfigPinHelp + "\n\n" + ConfigPinHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	tplFileName := FlagTpl(cmd)
+	configFileNames := FlagConfig(cmd)
+	target := FlagTarget(cmd)
+	release := cmd.Flags().String("release", "", "release of the manifest, e. g. 4.0.x (required)")
+	manifestFileName := cmd.Flags().StringP("manifest", "m", "", "release manifest file (required)")
+	force := cmd.Flags().BoolP("force", "f", false, "overwrite the YAML file also if it was changed manually")
+	cmd.MarkFlagRequired("release")
+	cmd.MarkFlagRequired("manifest")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		dir := args[0]
+
+		tplFile, err := ReadTplFile(*tplFileName)
+		if err != nil {
+			return err
+		}
+		configFiles, err := ReadConfigFiles(*configFileNames)
+		if err != nil {
+			return err
+		}
+		if *target != "" {
+			configFiles = append(configFiles, TargetConfig(*target))
+		}
+
+		manifestFile, err := os.ReadFile(*manifestFileName)
+		if err != nil {
+			return fmt.Errorf("reading file %q: %w", *manifestFileName, err)
+		}
+		m, err := ParseManifest(manifestFile, *release)
+		if err != nil {
+			return fmt.Errorf("parsing release manifest %q: %w", *manifestFileName, err)
+		}
+
+		if err := Pin(dir, *force, tplFile, configFiles, m); err != nil {
+			return fmt.Errorf("running Pin(): %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Images pinned to release %s, digests written to %q.\n", m.Release, path.Join(dir, PinsFileName))
+		return nil
+	}
+	return cmd
+}
+
+// Manifest contains the image digests of all services of one release.
+type Manifest struct {
+	Release  string            `json:"release"`
+	Services map[string]string `json:"services"`
+}
+
+// ParseManifest parses the given JSON or YAML release manifest. The release of
+// the manifest must match the given release pattern. Every service must have
+// a digest. The digests may also be given as image references with digest.
+func ParseManifest(content []byte, release string) (*Manifest, error) {
+	m := new(Manifest)
+	if err := yaml.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("unmarshaling manifest: %w", err)
+	}
+	if m.Release == "" {
+		return nil, fmt.Errorf("manifest does not contain a release")
+	}
+	if !matchRelease(release, m.Release) {
+		return nil, fmt.Errorf("manifest is for release %s, not for %s", m.Release, release)
+	}
+
+	var errs []string
+	for name, ref := range m.Services {
+		if err := checkServiceName(name); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if i := strings.LastIndex(ref, "@"); i >= 0 {
+			ref = ref[i+1:]
+		}
+		if !digestRegexp.MatchString(ref) {
+			errs = append(errs, fmt.Sprintf("invalid digest %q for service %q", m.Services[name], name))
+			continue
+		}
+		m.Services[name] = ref
+	}
+	for _, name := range allServices() {
+		if _, ok := m.Services[name]; !ok {
+			errs = append(errs, fmt.Sprintf("missing digest for service %q", name))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	return m, nil
+}
+
+// matchRelease reports whether the release matches the pattern. The letter x
+// in the pattern matches every version component.
+func matchRelease(pattern, release string) bool {
+	p := strings.Split(strings.TrimPrefix(pattern, "v"), ".")
+	r := strings.Split(strings.TrimPrefix(release, "v"), ".")
+	if len(p) != len(r) {
+		return false
+	}
+	for i := range p {
+		if p[i] != "x" && p[i] != r[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// PinsConfig returns a setup configuration YAML file which sets the tag to the
+// release and the digests of all services of the given manifest.
+func PinsConfig(m *Manifest) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "---\n# Image digests of release %s written by the config pin command.\n", m.Release)
+	fmt.Fprintf(buf, "defaults:\n  tag: %q\n", m.Release)
+	fmt.Fprintln(buf, "digests:")
+	for _, name := range allServices() {
+		fmt.Fprintf(buf, "  %s: %s\n", name, m.Services[name])
+	}
+	return buf.Bytes()
+}
+
+// Pin (re)creates the YAML file with the digests of the given manifest and
+// writes them to the pins file in the given directory. See Config for force.
+// The pins file is only written if the YAML file was created, so a refused
+// run does not change the pins used by later runs.
+func Pin(dir string, force bool, tplFile []byte, configFiles [][]byte, m *Manifest) error {
+	pins := PinsConfig(m)
+	if err := Config(dir, force, tplFile, append(configFiles, pins)); err != nil {
+		return err
+	}
+	if err := shared.CreateFile(dir, true, PinsFileName, pins); err != nil {
+		return fmt.Errorf("creating pins file at %q: %w", dir, err)
+	}
+	return nil
+}
+
+// digestSuffix returns the digest of the given service prefixed with @ or an
+// empty string if there is no digest.
+func digestSuffix(cfg *YmlConfig, name string) string {
+	d := cfg.Digests[name]
+	if d == "" {
+		return ""
+	}
+	return "@" + d
+}
+
+// cmdVerifyPins returns the config verify-pins subcommand.
+func cmdVerifyPins() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-pins directory",
+		Short: ConfigVerifyPinsHelp,
+		Long:  ConfigVerifyPinsHelp + "\n\n" + ConfigVerifyPinsHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	configFileNames := FlagConfig(cmd)
+	target := FlagTarget(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		configFiles, err := ReadConfigFiles(*configFileNames)
+		if err != nil {
+			return err
+		}
+		if *target != "" {
+			configFiles = append(configFiles, TargetConfig(*target))
+		}
+		cfg, err := NewYmlConfig(configFiles)
+		if err != nil {
+			return fmt.Errorf("creating new YML config object: %w", err)
+		}
+
+		p := path.Join(args[0], cfg.Filename)
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("reading file %q: %w", p, err)
+		}
+		unpinned, err := VerifyPins(cmd.OutOrStdout(), content)
+		if err != nil {
+			return fmt.Errorf("checking file %q: %w", p, err)
+		}
+		if unpinned > 0 {
+			return fehler.ExitCode(2, fmt.Errorf("%d images in %q are not pinned to a digest", unpinned, p))
+		}
+		return nil
+	}
+	return cmd
+}
+
+// VerifyPins writes every image of the given container configuration YAML file
+// which is not pinned to a digest to w. It returns the number of these images.
+func VerifyPins(w io.Writer, content []byte) (int, error) {
+	images, err := findImages(content)
+	if err != nil {
+		return 0, err
+	}
+
+	var unpinned int
+	for _, img := range images {
+		if strings.Contains(img.image, "@sha256:") {
+			continue
+		}
+		unpinned++
+		fmt.Fprintf(w, "Service %q uses mutable image %q.\n", img.name, img.image)
+	}
+	if unpinned == 0 {
+		fmt.Fprintf(w, "All %d images are pinned to digests.\n", len(images))
+	}
+	return unpinned, nil
+}
+
+type namedImage struct {
+	name  string
+	image string
+}
+
+// findImages returns all images in the given YAML file. The name is the key of
+// the service for Docker Compose files and the container name for Kubernetes
+// manifests.
+func findImages(content []byte) ([]namedImage, error) {
+	var images []namedImage
+	var walk func(v interface{}, key string)
+	walk = func(v interface{}, key string) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if image, ok := v["image"].(string); ok {
+				name, ok := v["name"].(string)
+				if !ok {
+					name = key
+				}
+				images = append(images, namedImage{name: name, image: image})
+			}
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(v[k], k)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e, key)
+			}
+		}
+	}
+
+	dec := yamlv3.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("parsing YAML: %w", err)
+		}
+		walk(doc, "")
+	}
+	return images, nil
+}
@@ -0,0 +1,166 @@
+package config_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+var allServiceNames = []string{
+	"proxy", "client", "backendAction", "backendPresenter", "backendManage",
+	"datastoreReader", "datastoreWriter", "postgres", "autoupdate", "auth",
+	"vote", "icc", "redis", "media", "manage",
+}
+
+func testManifest(release string, skip string) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "release: %s\nservices:\n", release)
+	for i, name := range allServiceNames {
+		if name == skip {
+			continue
+		}
+		fmt.Fprintf(buf, "  %s: sha256:%064x\n", name, i+1)
+	}
+	return buf.Bytes()
+}
+
+func TestPin(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	t.Run("parsing manifest", func(t *testing.T) {
+		m, err := config.ParseManifest(testManifest("4.0.15", ""), "4.0.x")
+		if err != nil {
+			t.Fatalf("parsing manifest: %v", err)
+		}
+		if got := m.Services["client"]; got != fmt.Sprintf("sha256:%064x", 2) {
+			t.Fatalf("wrong digest for client, got %q", got)
+		}
+	})
+
+	t.Run("parsing manifest with image references", func(t *testing.T) {
+		manifest := strings.Replace(string(testManifest("4.0.15", "")), "proxy: sha256:", "proxy: ghcr.io/openslides/openslides/openslides-proxy:4.0.15@sha256:", 1)
+		m, err := config.ParseManifest([]byte(manifest), "4.0.15")
+		if err != nil {
+			t.Fatalf("parsing manifest: %v", err)
+		}
+		if got := m.Services["proxy"]; got != fmt.Sprintf("sha256:%064x", 1) {
+			t.Fatalf("wrong digest for proxy, got %q", got)
+		}
+	})
+
+	t.Run("parsing invalid manifests", func(t *testing.T) {
+		for _, tc := range []struct {
+			name     string
+			manifest []byte
+			release  string
+		}{
+			{"wrong release", testManifest("4.1.0", ""), "4.0.x"},
+			{"missing service", testManifest("4.0.15", "vote"), "4.0.x"},
+			{"unknown service", append(testManifest("4.0.15", ""), []byte("  unknown: sha256:abc\n")...), "4.0.x"},
+			{"invalid digest", []byte(strings.Replace(string(testManifest("4.0.15", "")), "sha256:", "sha512:", 1)), "4.0.x"},
+		} {
+			if _, err := config.ParseManifest(tc.manifest, tc.release); err == nil {
+				t.Fatalf("parsing manifest with %s should fail", tc.name)
+			}
+		}
+	})
+
+	t.Run("running config.Pin() and verifying the pins", func(t *testing.T) {
+		m, err := config.ParseManifest(testManifest("4.0.15", ""), "4.0.x")
+		if err != nil {
+			t.Fatalf("parsing manifest: %v", err)
+		}
+		if err := config.Pin(testDir, false, nil, nil, m); err != nil {
+			t.Fatalf("running config.Pin() failed with error: %v", err)
+		}
+		pins, err := os.ReadFile(path.Join(testDir, config.PinsFileName))
+		if err != nil {
+			t.Fatalf("reading pins file: %v", err)
+		}
+		if err := config.Validate(config.PinsFileName, pins); err != nil {
+			t.Fatalf("pins file is invalid: %v", err)
+		}
+
+		content, err := os.ReadFile(path.Join(testDir, "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		expected := fmt.Sprintf("image: ghcr.io/openslides/openslides/openslides-client:4.0.15@sha256:%064x\n", 2)
+		if !strings.Contains(string(content), expected) {
+			t.Fatalf("compose file does not contain %q, got\n%s", expected, content)
+		}
+
+		buf := new(bytes.Buffer)
+		unpinned, err := config.VerifyPins(buf, content)
+		if err != nil {
+			t.Fatalf("verifying pins: %v", err)
+		}
+		if unpinned != 0 {
+			t.Fatalf("expected all images to be pinned, got %d unpinned:\n%s", unpinned, buf.String())
+		}
+	})
+
+	t.Run("running config.Pin() on manually changed file", func(t *testing.T) {
+		p := path.Join(testDir, "docker-compose.yml")
+		content, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		if err := os.WriteFile(p, append(content, []byte("# manual edit\n")...), 0666); err != nil {
+			t.Fatalf("writing compose file: %v", err)
+		}
+		pins, err := os.ReadFile(path.Join(testDir, config.PinsFileName))
+		if err != nil {
+			t.Fatalf("reading pins file: %v", err)
+		}
+
+		m, err := config.ParseManifest(testManifest("4.0.16", ""), "4.0.x")
+		if err != nil {
+			t.Fatalf("parsing manifest: %v", err)
+		}
+		if err := config.Pin(testDir, false, nil, nil, m); !errors.Is(err, config.ErrManualEdit) {
+			t.Fatalf("running config.Pin() should fail with ErrManualEdit, got %v", err)
+		}
+		got, err := os.ReadFile(path.Join(testDir, config.PinsFileName))
+		if err != nil {
+			t.Fatalf("reading pins file: %v", err)
+		}
+		if !bytes.Equal(got, pins) {
+			t.Fatalf("pins file was changed by refused run, got\n%s", got)
+		}
+		if err := os.WriteFile(p, content, 0666); err != nil {
+			t.Fatalf("restoring compose file: %v", err)
+		}
+	})
+
+	t.Run("verifying pins of unpinned file", func(t *testing.T) {
+		if err := config.Config(testDir, false, nil, nil); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		buf := new(bytes.Buffer)
+		unpinned, err := config.VerifyPins(buf, content)
+		if err != nil {
+			t.Fatalf("verifying pins: %v", err)
+		}
+		if unpinned == 0 {
+			t.Fatalf("expected unpinned images")
+		}
+		if !strings.Contains(buf.String(), `Service "client" uses mutable image`) {
+			t.Fatalf("output does not mention the client service, got\n%s", buf.String())
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profiles for the profile key of the setup configuration. A profile disables
+// a predefined set of services.
+const (
+	ProfileFull    = "full"
+	ProfileMinimal = "minimal"
+	ProfileDev     = "dev"
+)
+
+// profiles maps the profile names to the services they disable.
+var profiles = map[string][]string{
+	ProfileFull:    nil,
+	ProfileMinimal: {"vote", "icc", "media"},
+	ProfileDev:     {"vote", "icc"},
+}
+
+func checkProfile(v string) error {
+	if v == "" {
+		return nil
+	}
+	if _, ok := profiles[v]; !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile, use one of %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// applyProfile disables the services of the configured profile unless the
+// disabled flag of a service is set explicitly. A disabled postgres service
+// is the same as disablePostgres.
+func applyProfile(cfg *YmlConfig) error {
+	if err := checkProfile(cfg.Profile); err != nil {
+		return err
+	}
+	for _, name := range profiles[cfg.Profile] {
+		s := cfg.Services[name]
+		if s.Disabled == nil {
+			disabled := true
+			s.Disabled = &disabled
+			cfg.Services[name] = s
+		}
+	}
+	if isDisabled(cfg.Services["postgres"]) {
+		disabled := true
+		cfg.DisablePostgres = &disabled
+	}
+	return nil
+}
+
+func isDisabled(s service) bool {
+	return s.Disabled != nil && *s.Disabled
+}
+
+// enabledServices returns the given services without the ones which are not
+// part of the deployment. The Docker Compose template uses it for depends_on.
+func enabledServices(cfg *YmlConfig, names ...string) []string {
+	var result []string
+	for _, name := range names {
+		if cfg.HasService(name) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// usesSecret reports whether at least one service of the deployment uses the
+// secret with the given name.
+func usesSecret(cfg *YmlConfig, name string) bool {
+	for _, s := range workloadSecrets(append(workloads(cfg), extraWorkloads(cfg)...)) {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
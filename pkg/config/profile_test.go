@@ -0,0 +1,109 @@
+package config_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+func TestProfiles(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	readFile := func(t *testing.T, name string) string {
+		t.Helper()
+		content, err := os.ReadFile(path.Join(testDir, name))
+		if err != nil {
+			t.Fatalf("reading file %q: %v", name, err)
+		}
+		return string(content)
+	}
+
+	t.Run("running config.Config() with profile minimal", func(t *testing.T) {
+		customConfig := "---\nprofile: minimal\n"
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		got := readFile(t, "docker-compose.yml")
+		for _, unexpected := range []string{"\n  vote:\n", "\n  icc:\n", "\n  media:\n", "      - vote\n", "      - icc\n", "      - media\n"} {
+			if strings.Contains(got, unexpected) {
+				t.Fatalf("compose file should not contain %q, got\n%s", unexpected, got)
+			}
+		}
+		if !strings.Contains(got, "\n  proxy:\n") {
+			t.Fatalf("compose file should contain the proxy service, got\n%s", got)
+		}
+	})
+
+	t.Run("running config.Config() with profile and explicitly enabled service", func(t *testing.T) {
+		customConfig := `---
+profile: minimal
+services:
+  vote:
+    disabled: false
+`
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		got := readFile(t, "docker-compose.yml")
+		if !strings.Contains(got, "\n  vote:\n") {
+			t.Fatalf("compose file should contain the vote service, got\n%s", got)
+		}
+		if strings.Contains(got, "\n  icc:\n") {
+			t.Fatalf("compose file should not contain the icc service, got\n%s", got)
+		}
+	})
+
+	t.Run("running config.Config() with disabled services", func(t *testing.T) {
+		customConfig := `---
+services:
+  manage:
+    disabled: true
+  postgres:
+    disabled: true
+`
+		cfg, err := config.NewYmlConfig([][]byte{[]byte(customConfig)})
+		if err != nil {
+			t.Fatalf("creating config: %v", err)
+		}
+		if !*cfg.DisablePostgres {
+			t.Fatalf("disabling the postgres service should set disablePostgres")
+		}
+
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		got := readFile(t, "docker-compose.yml")
+		for _, unexpected := range []string{"\n  manage:\n", "\n  postgres:\n", "      - postgres\n", "\n  superadmin:\n", "\n  manage_auth_password:\n"} {
+			if strings.Contains(got, unexpected) {
+				t.Fatalf("compose file should not contain %q, got\n%s", unexpected, got)
+			}
+		}
+		if !strings.Contains(got, "\n  internal_auth_password:\n") {
+			t.Fatalf("compose file should still contain the secret internal_auth_password, got\n%s", got)
+		}
+	})
+
+	t.Run("running config.Config() with disabled service for target swarm", func(t *testing.T) {
+		c := [][]byte{[]byte("---\nprofile: dev\n"), config.TargetConfig(config.TargetSwarm)}
+		if err := config.Config(testDir, false, nil, c); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		got := readFile(t, "docker-stack.yml")
+		if strings.Contains(got, "\n  vote:\n") {
+			t.Fatalf("stack file should not contain the vote service, got\n%s", got)
+		}
+	})
+
+	t.Run("invalid profile", func(t *testing.T) {
+		if _, err := config.NewYmlConfig([][]byte{[]byte("---\nprofile: tiny\n")}); err == nil {
+			t.Fatalf("creating config with unknown profile should fail")
+		}
+	})
+}
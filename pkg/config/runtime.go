@@ -0,0 +1,204 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// resources contains the resource limits and reservations of a service.
+type resources struct {
+	Limits       *resourceSpec `yaml:"limits" json:"limits,omitempty"`
+	Reservations *resourceSpec `yaml:"reservations" json:"reservations,omitempty"`
+}
+
+type resourceSpec struct {
+	CPUs   string `yaml:"cpus" json:"cpus,omitempty"`
+	Memory string `yaml:"memory" json:"memory,omitempty"`
+}
+
+// healthcheck contains the healthcheck of a service. The durations are Go
+// durations like 10s or 1m30s which are also valid in Compose files.
+type healthcheck struct {
+	Test        []string `yaml:"test" json:"test,omitempty"`
+	Interval    string   `yaml:"interval" json:"interval,omitempty"`
+	Timeout     string   `yaml:"timeout" json:"timeout,omitempty"`
+	StartPeriod string   `yaml:"startPeriod" json:"startPeriod,omitempty"`
+	Retries     *int     `yaml:"retries" json:"retries,omitempty"`
+	Disable     *bool    `yaml:"disable" json:"disable,omitempty"`
+}
+
+// restartPolicies contains the values of the restart key of a service.
+var restartPolicies = []string{"no", "always", "on-failure", "unless-stopped"}
+
+// swarmRestartConditions maps the restart key of a service to the restart
+// condition of Docker Swarm which ignores the restart key.
+var swarmRestartConditions = map[string]string{
+	"no":             "none",
+	"always":         "any",
+	"on-failure":     "on-failure",
+	"unless-stopped": "any",
+}
+
+var memoryRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[bkmgBKMG]?$`)
+
+func checkCPUs(v string) error {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		return fmt.Errorf("%q is not a positive number of CPUs like 0.5 or 2", v)
+	}
+	return nil
+}
+
+func checkMemory(v string) error {
+	if !memoryRegexp.MatchString(v) {
+		return fmt.Errorf("%q is not a valid amount of memory like 512m or 2g", v)
+	}
+	return nil
+}
+
+// checkRuntimeOptions checks the resources, the healthcheck and the restart
+// policy of all services and extra services of the merged config. The keys
+// rendered from these options must not be given in additionalContent too
+// because the rendered file would contain duplicate keys.
+func checkRuntimeOptions(cfg *YmlConfig) error {
+	for _, name := range allServices() {
+		s := cfg.Services[name]
+		if s.Restart == "false" {
+			// The YAML unmarshaller reads an unquoted no as boolean.
+			s.Restart = "no"
+			cfg.Services[name] = s
+		}
+		if err := checkServiceRuntimeOptions(cfg.Target, s.Restart, s.Healthcheck, s.Resources, s.AdditionalContent); err != nil {
+			return fmt.Errorf("service %q: %w", name, err)
+		}
+	}
+	for name, s := range cfg.ExtraServices {
+		if s.Restart == "false" {
+			s.Restart = "no"
+			cfg.ExtraServices[name] = s
+		}
+		if err := checkServiceRuntimeOptions(cfg.Target, s.Restart, s.Healthcheck, s.Resources, s.AdditionalContent); err != nil {
+			return fmt.Errorf("extra service %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func checkServiceRuntimeOptions(target string, restart string, hc *healthcheck, res *resources, additionalContent json.RawMessage) error {
+	if restart != "" {
+		if err := checkEnum(restartPolicies...)(restart); err != nil {
+			return fmt.Errorf("restart: %w", err)
+		}
+	}
+	if hc != nil && len(hc.Test) > 0 {
+		if err := checkEnum("NONE", "CMD", "CMD-SHELL")(hc.Test[0]); err != nil {
+			return fmt.Errorf("healthcheck test must start with NONE, CMD or CMD-SHELL: %w", err)
+		}
+	}
+
+	if len(additionalContent) == 0 || string(additionalContent) == "null" {
+		return nil
+	}
+	var content map[string]interface{}
+	if err := json.Unmarshal(additionalContent, &content); err != nil {
+		return fmt.Errorf("additionalContent must be a mapping: %w", err)
+	}
+	var rendered map[string]interface{}
+	if target == TargetSwarm {
+		// The stack file always contains the deploy section.
+		rendered = map[string]interface{}{"deploy": true}
+		if h := hc.composeHealthcheck(); h != nil {
+			rendered["healthcheck"] = h
+		}
+	} else {
+		rendered = composeOptions(restart, hc, res)
+	}
+	var duplicates []string
+	for key := range rendered {
+		if _, ok := content[key]; ok {
+			duplicates = append(duplicates, key)
+		}
+	}
+	if len(duplicates) > 0 {
+		sort.Strings(duplicates)
+		return fmt.Errorf("additionalContent contains the keys %q which are already rendered from resources, healthcheck, restart or deploy, remove them from additionalContent", duplicates)
+	}
+	return nil
+}
+
+// composeResources returns the resources in the format of the Compose file
+// specification or nil if there are no resources.
+func (r *resources) composeResources() map[string]interface{} {
+	if r == nil {
+		return nil
+	}
+	result := make(map[string]interface{})
+	for key, spec := range map[string]*resourceSpec{"limits": r.Limits, "reservations": r.Reservations} {
+		if spec == nil {
+			continue
+		}
+		m := make(map[string]interface{})
+		addNonEmpty(m, "cpus", spec.CPUs)
+		addNonEmpty(m, "memory", spec.Memory)
+		if len(m) > 0 {
+			result[key] = m
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// composeHealthcheck returns the healthcheck in the format of the Compose file
+// specification or nil if there is no healthcheck.
+func (h *healthcheck) composeHealthcheck() map[string]interface{} {
+	if h == nil {
+		return nil
+	}
+	result := make(map[string]interface{})
+	if len(h.Test) > 0 {
+		result["test"] = h.Test
+	}
+	addNonEmpty(result, "interval", h.Interval)
+	addNonEmpty(result, "timeout", h.Timeout)
+	addNonEmpty(result, "start_period", h.StartPeriod)
+	if h.Retries != nil {
+		result["retries"] = *h.Retries
+	}
+	if h.Disable != nil {
+		result["disable"] = *h.Disable
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// ComposeOptions returns the restart policy, the healthcheck and the
+// resources of the service for the Docker Compose template. The result is
+// rendered with marshalContent.
+func (s service) ComposeOptions() map[string]interface{} {
+	return composeOptions(s.Restart, s.Healthcheck, s.Resources)
+}
+
+// ComposeOptions returns the restart policy, the healthcheck and the
+// resources of the extra service for the Docker Compose template.
+func (s extraService) ComposeOptions() map[string]interface{} {
+	return composeOptions(s.Restart, s.Healthcheck, s.Resources)
+}
+
+func composeOptions(restart string, hc *healthcheck, res *resources) map[string]interface{} {
+	result := make(map[string]interface{})
+	addNonEmpty(result, "restart", restart)
+	if h := hc.composeHealthcheck(); h != nil {
+		result["healthcheck"] = h
+	}
+	if r := res.composeResources(); r != nil {
+		result["deploy"] = map[string]interface{}{"resources": r}
+	}
+	return result
+}
@@ -0,0 +1,162 @@
+package config_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+const runtimeOptionsConfig = `---
+services:
+  backendAction:
+    restart: unless-stopped
+    resources:
+      limits:
+        cpus: "1.5"
+        memory: 1g
+      reservations:
+        memory: 512m
+    healthcheck:
+      test: ["CMD", "curl", "-f", "http://localhost:9002/system/action/health"]
+      interval: 30s
+      timeout: 5s
+      startPeriod: 1m
+      retries: 3
+  redis:
+    restart: no
+`
+
+func TestRuntimeOptions(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	t.Run("running config.Config() with resources, healthcheck and restart", func(t *testing.T) {
+		if err := config.Validate("runtime.yml", []byte(runtimeOptionsConfig)); err != nil {
+			t.Fatalf("validating config: %v", err)
+		}
+		if err := config.Config(testDir, false, nil, [][]byte{[]byte(runtimeOptionsConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		got := string(content)
+		for _, expected := range []string{
+			`
+    deploy:
+      resources:
+        limits:
+          cpus: "1.5"
+          memory: 1g
+        reservations:
+          memory: 512m
+    healthcheck:
+      interval: 30s
+      retries: 3
+      start_period: 1m
+      test:
+      - CMD
+      - curl
+      - -f
+      - http://localhost:9002/system/action/health
+      timeout: 5s
+    restart: unless-stopped
+`,
+			"\n    restart: \"no\"\n",
+		} {
+			if !strings.Contains(got, expected) {
+				t.Fatalf("compose file does not contain %q, got\n%s", expected, got)
+			}
+		}
+	})
+
+	t.Run("running config.Config() with resources, healthcheck and restart for target swarm", func(t *testing.T) {
+		c := [][]byte{[]byte(runtimeOptionsConfig), config.TargetConfig(config.TargetSwarm)}
+		if err := config.Config(testDir, false, nil, c); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-stack.yml"))
+		if err != nil {
+			t.Fatalf("reading stack file: %v", err)
+		}
+		got := string(content)
+		for _, expected := range []string{
+			"\n    healthcheck:\n      interval: 30s\n",
+			"\n      resources:\n        limits:\n          cpus: \"1.5\"\n",
+			"\n      restart_policy:\n        condition: any\n",
+			"\n      restart_policy:\n        condition: none\n",
+		} {
+			if !strings.Contains(got, expected) {
+				t.Fatalf("stack file does not contain %q, got\n%s", expected, got)
+			}
+		}
+	})
+
+	t.Run("running config.Config() with resources, healthcheck and restart for extra services", func(t *testing.T) {
+		c := `---
+extraServices:
+  backup:
+    image: example.com/backup:1
+    restart: always
+    resources:
+      limits:
+        memory: 256m
+    healthcheck:
+      test: ["CMD", "true"]
+`
+		if err := config.Validate("extra.yml", []byte(c)); err != nil {
+			t.Fatalf("validating config: %v", err)
+		}
+		if err := config.Config(testDir, true, nil, [][]byte{[]byte(c)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		expected := "\n    deploy:\n      resources:\n        limits:\n          memory: 256m\n    healthcheck:\n      test:\n      - CMD\n      - \"true\"\n    restart: always\n"
+		if !strings.Contains(string(content), expected) {
+			t.Fatalf("compose file does not contain %q, got\n%s", expected, content)
+		}
+	})
+
+	t.Run("duplicate keys in additionalContent", func(t *testing.T) {
+		for _, c := range []string{
+			"services:\n  vote:\n    resources:\n      limits:\n        memory: 1g\n    additionalContent:\n      deploy:\n        labels: [a]\n",
+			"services:\n  vote:\n    restart: always\n    additionalContent:\n      restart: always\n",
+			"extraServices:\n  backup:\n    image: backup\n    healthcheck:\n      interval: 10s\n    additionalContent:\n      healthcheck:\n        retries: 3\n",
+			"target: swarm\nservices:\n  vote:\n    additionalContent:\n      deploy:\n        labels: [a]\n",
+		} {
+			if _, err := config.NewYmlConfig([][]byte{[]byte(c)}); err == nil || !strings.Contains(err.Error(), "already rendered") {
+				t.Fatalf("config %q should be rejected because of duplicate keys, got error %v", c, err)
+			}
+		}
+		c := "services:\n  vote:\n    restart: always\n    additionalContent:\n      labels: [a]\n"
+		if _, err := config.NewYmlConfig([][]byte{[]byte(c)}); err != nil {
+			t.Fatalf("config %q without duplicate keys should be valid, got %v", c, err)
+		}
+	})
+
+	t.Run("invalid resources, healthcheck and restart", func(t *testing.T) {
+		for _, c := range []string{
+			"services:\n  vote:\n    restart: sometimes\n",
+			"services:\n  vote:\n    resources:\n      limits:\n        cpus: many\n",
+			"services:\n  vote:\n    resources:\n      limits:\n        memory: 1 GB\n",
+			"services:\n  vote:\n    healthcheck:\n      interval: often\n",
+			"services:\n  vote:\n    healthcheck:\n      test: [curl, localhost]\n",
+		} {
+			errValidate := config.Validate("invalid.yml", []byte(c))
+			_, errNew := config.NewYmlConfig([][]byte{[]byte(c)})
+			if errValidate == nil && errNew == nil {
+				t.Fatalf("config %q should be invalid", c)
+			}
+		}
+	})
+}
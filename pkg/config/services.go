@@ -0,0 +1,275 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// serviceSpec describes the static facts of an OpenSlides service that do not
+// depend on the setup configuration. It is used by all targets that do not
+// hardcode these facts in their template.
+type serviceSpec struct {
+	name        string
+	image       string // Name of the image in the container registry.
+	fixedImage  string // Complete image reference for third party images. Overrides image.
+	port        int
+	command     []string
+	networks    []string
+	secrets     []string
+	environment map[string]string
+}
+
+// serviceSpecs contains all OpenSlides services in the order they are rendered.
+var serviceSpecs = []serviceSpec{
+	{
+		name:     "proxy",
+		image:    "openslides-proxy",
+		port:     8000,
+		networks: []string{"uplink", "frontend"},
+	},
+	{
+		name:     "client",
+		image:    "openslides-client",
+		port:     9001,
+		networks: []string{"frontend"},
+	},
+	{
+		name:        "backendAction",
+		image:       "openslides-backend",
+		port:        9002,
+		networks:    []string{"frontend", "data"},
+		secrets:     []string{"auth_token_key", "auth_cookie_key", "postgres_password"},
+		environment: map[string]string{"OPENSLIDES_BACKEND_COMPONENT": "action"},
+	},
+	{
+		name:        "backendPresenter",
+		image:       "openslides-backend",
+		port:        9003,
+		networks:    []string{"frontend", "data"},
+		secrets:     []string{"auth_token_key", "auth_cookie_key", "postgres_password"},
+		environment: map[string]string{"OPENSLIDES_BACKEND_COMPONENT": "presenter"},
+	},
+	{
+		name:        "backendManage",
+		image:       "openslides-backend",
+		port:        9002,
+		networks:    []string{"data"},
+		secrets:     []string{"auth_token_key", "auth_cookie_key", "internal_auth_password", "postgres_password"},
+		environment: map[string]string{"OPENSLIDES_BACKEND_COMPONENT": "action"},
+	},
+	{
+		name:     "datastoreReader",
+		image:    "openslides-datastore-reader",
+		port:     9010,
+		networks: []string{"data"},
+		secrets:  []string{"postgres_password"},
+	},
+	{
+		name:     "datastoreWriter",
+		image:    "openslides-datastore-writer",
+		port:     9011,
+		networks: []string{"data"},
+		secrets:  []string{"postgres_password"},
+	},
+	{
+		name:       "postgres",
+		fixedImage: "postgres:11",
+		port:       5432,
+		networks:   []string{"data"},
+		secrets:    []string{"postgres_password"},
+		environment: map[string]string{
+			"POSTGRES_DB":            "openslides",
+			"POSTGRES_USER":          "openslides",
+			"POSTGRES_PASSWORD_FILE": "/run/secrets/postgres_password",
+			"PGDATA":                 "/var/lib/postgresql/data/pgdata",
+		},
+	},
+	{
+		name:        "autoupdate",
+		image:       "openslides-autoupdate",
+		port:        9012,
+		networks:    []string{"frontend", "data"},
+		secrets:     []string{"auth_token_key", "auth_cookie_key"},
+		environment: map[string]string{"MESSAGING": "redis", "AUTH": "ticket"},
+	},
+	{
+		name:     "auth",
+		image:    "openslides-auth",
+		port:     9004,
+		networks: []string{"frontend", "data"},
+		secrets:  []string{"auth_token_key", "auth_cookie_key"},
+	},
+	{
+		name:        "vote",
+		image:       "openslides-vote",
+		port:        9013,
+		networks:    []string{"frontend", "data"},
+		secrets:     []string{"auth_token_key", "auth_cookie_key", "postgres_password"},
+		environment: map[string]string{"MESSAGING": "redis", "AUTH": "ticket"},
+	},
+	{
+		name:       "redis",
+		fixedImage: "redis:latest",
+		port:       6379,
+		command:    []string{"redis-server", "--save", ""},
+		networks:   []string{"data"},
+	},
+	{
+		name:     "media",
+		image:    "openslides-media",
+		port:     9006,
+		networks: []string{"frontend", "data"},
+		secrets:  []string{"postgres_password"},
+	},
+	{
+		name:        "icc",
+		image:       "openslides-icc",
+		port:        9007,
+		networks:    []string{"frontend", "data"},
+		secrets:     []string{"auth_token_key", "auth_cookie_key"},
+		environment: map[string]string{"MESSAGING": "redis", "AUTH": "ticket"},
+	},
+	{
+		name:     "manage",
+		image:    "openslides-manage",
+		port:     9008,
+		networks: []string{"frontend", "data"},
+		secrets:  []string{"superadmin", "manage_auth_password", "internal_auth_password"},
+	},
+}
+
+// allServices returns the names of all OpenSlides services.
+func allServices() []string {
+	names := make([]string, len(serviceSpecs))
+	for i, spec := range serviceSpecs {
+		names[i] = spec.name
+	}
+	return names
+}
+
+// workload contains the facts of one OpenSlides service merged with the setup
+// configuration. It is used by the targets which build their services from
+// serviceSpecs.
+type workload struct {
+	Name        string
+	Image       string
+	Port        int
+	Command     []string
+	Networks    []string
+	Secrets     []string
+	Environment []envVar
+	Volumes     []string
+	DBData      bool
+}
+
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// workloads returns all workloads for the given config. The environment of
+// every workload is the default environment merged with the service
+// environment and the fixed environment of the service.
+func workloads(cfg *YmlConfig) []workload {
+	var result []workload
+	for _, spec := range serviceSpecs {
+		if !cfg.HasService(spec.name) {
+			continue
+		}
+		s := cfg.Services[spec.name]
+
+		env := make(map[string]string)
+		for k, v := range cfg.DefaultEnvironment {
+			env[k] = v
+		}
+		for k, v := range s.Environment {
+			env[k] = v
+		}
+		for k, v := range spec.environment {
+			env[k] = v
+		}
+
+		secrets := serviceSecrets(cfg, spec)
+		if spec.name == "proxy" {
+			if *cfg.EnableLocalHTTPS {
+				env["ENABLE_LOCAL_HTTPS"] = "1"
+				env["HTTPS_CERT_FILE"] = "/run/secrets/cert_crt"
+				env["HTTPS_KEY_FILE"] = "/run/secrets/cert_key"
+				secrets = []string{"cert_crt", "cert_key"}
+			}
+			if *cfg.EnableAutoHTTPS {
+				env["ENABLE_AUTO_HTTPS"] = "1"
+			}
+		}
+		if spec.name == "manage" && *cfg.EnableManageTLS {
+			env["MANAGE_ENABLE_TLS"] = "1"
+			secrets = append(append([]string{}, secrets...), "cert_crt", "cert_key")
+			if *cfg.ManageAuth.ClientCertificates {
+				secrets = append(secrets, "ca_crt")
+			}
+		}
+
+		image := spec.fixedImage
+		if image == "" {
+			image = fmt.Sprintf("%s/%s:%s", s.ContainerRegistry, spec.image, s.Tag)
+		}
+		image += digestSuffix(cfg, spec.name)
+
+		result = append(result, workload{
+			Name:        spec.name,
+			Image:       image,
+			Port:        spec.port,
+			Command:     spec.command,
+			Networks:    spec.networks,
+			Secrets:     secrets,
+			Environment: sortedEnv(env),
+			DBData:      spec.name == "postgres",
+		})
+	}
+	return result
+}
+
+// workloadSecrets returns the names of all secrets used by the given
+// workloads in the order of their first usage.
+func workloadSecrets(workloads []workload) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, w := range workloads {
+		for _, name := range w.Secrets {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func sortedEnv(env map[string]string) []envVar {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]envVar, len(keys))
+	for i, k := range keys {
+		result[i] = envVar{Name: k, Value: env[k]}
+	}
+	return result
+}
+
+// ServicesUsingSecret returns the names of all OpenSlides services which get
+// the secret with the given name.
+func ServicesUsingSecret(secret string) []string {
+	var names []string
+	for _, spec := range serviceSpecs {
+		for _, s := range spec.secrets {
+			if s == secret {
+				names = append(names, spec.name)
+				break
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigShowHelp contains the short help text for the command.
+	ConfigShowHelp = "Shows the effective merged setup configuration"
+
+	// ConfigShowHelpExtra contains the long help text for the command without the headline.
+	ConfigShowHelpExtra = `This command merges the given setup configuration YAML files with the default
+config and prints the result after all service defaults were filled in. Use
+the provenance flag to see which file set each value.`
+
+	formatYAML = "yaml"
+	formatJSON = "json"
+
+	provenanceDefault = "default"
+)
+
+// cmdShow returns the config show subcommand.
+func cmdShow() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: ConfigShowHelp,
+		Long:  ConfigShowHelp + "\n\n" + ConfigShowHelpExtra,
+		Args:  cobra.NoArgs,
+	}
+
+	configFileNames := FlagConfig(cmd)
+	target := FlagTarget(cmd)
+	format := cmd.Flags().StringP("format", "o", formatYAML, fmt.Sprintf("output format, one of %q and %q", formatYAML, formatJSON))
+	provenance := cmd.Flags().BoolP("provenance", "p", false, "annotate each value with the config file that set it")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		configFiles, err := ReadConfigFiles(*configFileNames)
+		if err != nil {
+			return err
+		}
+		names := append([]string{}, *configFileNames...)
+		if *target != "" {
+			configFiles = append(configFiles, TargetConfig(*target))
+			names = append(names, "--target flag")
+		}
+
+		if err := Show(cmd.OutOrStdout(), configFiles, names, *format, *provenance); err != nil {
+			return fmt.Errorf("running Show(): %w", err)
+		}
+		return nil
+	}
+	return cmd
+}
+
+// Show writes the merged config to w using the given format. If withProvenance
+// is true, every value is annotated with the name of the config file that set
+// it. The names must be given in the same order as the config files.
+func Show(w io.Writer, configFiles [][]byte, names []string, format string, withProvenance bool) error {
+	if len(names) != len(configFiles) {
+		return fmt.Errorf("got %d names for %d config files", len(names), len(configFiles))
+	}
+	if format != formatYAML && format != formatJSON {
+		return fmt.Errorf("invalid format %q", format)
+	}
+
+	cfg, err := NewYmlConfig(configFiles)
+	if err != nil {
+		return fmt.Errorf("creating new YML config object: %w", err)
+	}
+	cfgJSON, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshalling config: %w", err)
+	}
+
+	var prov map[string]string
+	if withProvenance {
+		prov, err = provenance(cfg, configFiles, names)
+		if err != nil {
+			return fmt.Errorf("calculating provenance: %w", err)
+		}
+	}
+
+	if format == formatJSON {
+		var result interface{} = json.RawMessage(cfgJSON)
+		if withProvenance {
+			result = struct {
+				Config     json.RawMessage   `json:"config"`
+				Provenance map[string]string `json:"provenance"`
+			}{cfgJSON, prov}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return fmt.Errorf("encoding JSON: %w", err)
+		}
+		return nil
+	}
+
+	// JSON is valid YAML so we can use it to build the YAML node tree.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(cfgJSON, &doc); err != nil {
+		return fmt.Errorf("building YAML nodes: %w", err)
+	}
+	resetStyle(&doc)
+	if withProvenance {
+		annotate(doc.Content[0], "", prov)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("encoding YAML: %w", err)
+	}
+	return enc.Close()
+}
+
+// provenance returns for every leaf of the merged config the name of the config
+// file that set it. The keys are the paths of the leafs joined by dots.
+func provenance(cfg *YmlConfig, configFiles [][]byte, names []string) (map[string]string, error) {
+	layers := append([][]byte{defaultConfig}, configFiles...)
+	layerNames := append([]string{provenanceDefault}, names...)
+
+	prov := make(map[string]string)
+	for i, layer := range layers {
+		var v interface{}
+		if err := yaml.Unmarshal(layer, &v); err != nil {
+			return nil, fmt.Errorf("unmarshalling config %q: %w", layerNames[i], err)
+		}
+		// The merging replaces whole services so we have to forget all values
+		// of a service that is given in this layer.
+		if m, ok := v.(map[string]interface{}); ok {
+			if services, ok := m["services"].(map[string]interface{}); ok {
+				for name := range services {
+					for p := range prov {
+						if strings.HasPrefix(p, "services."+name+".") {
+							delete(prov, p)
+						}
+					}
+				}
+			}
+		}
+		for p, leaf := range leafs("", v) {
+			if s, ok := leaf.(string); ok && s == "" {
+				// Empty strings do not override values during merging.
+				continue
+			}
+			prov[p] = layerNames[i]
+		}
+	}
+
+	// Values that are filled in by NewYmlConfig
+	if _, ok := prov["filename"]; !ok {
+		prov["filename"] = fmt.Sprintf("default for target %s", cfg.Target)
+	}
+	if _, ok := prov["postgresContainerUser"]; !ok {
+		prov["postgresContainerUser"] = "detected user and group id"
+	}
+	for name := range cfg.Services {
+		for _, key := range []string{"containerRegistry", "tag"} {
+			p := "services." + name + "." + key
+			if _, ok := prov[p]; !ok {
+				prov[p] = fmt.Sprintf("defaults.%s (%s)", key, prov["defaults."+key])
+			}
+		}
+	}
+	return prov, nil
+}
+
+// leafs returns all leafs of the given value with their paths. The value of
+// additionalContent is treated as a leaf because it is not merged.
+func leafs(p string, v interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	m, ok := v.(map[string]interface{})
+	if !ok || strings.HasSuffix(p, "additionalContent") {
+		if v != nil {
+			result[p] = v
+		}
+		return result
+	}
+	for k, child := range m {
+		childPath := k
+		if p != "" {
+			childPath = p + "." + k
+		}
+		for lp, leaf := range leafs(childPath, child) {
+			result[lp] = leaf
+		}
+	}
+	return result
+}
+
+// annotate adds the provenance as line comment to all values in the given
+// mapping node.
+func annotate(n *yaml.Node, p string, prov map[string]string) {
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		childPath := k.Value
+		if p != "" {
+			childPath = p + "." + k.Value
+		}
+		if from, ok := prov[childPath]; ok {
+			if v.Kind == yaml.ScalarNode {
+				v.LineComment = from
+			} else {
+				k.LineComment = from
+			}
+			continue
+		}
+		annotate(v, childPath, prov)
+	}
+}
+
+// resetStyle removes the flow style and the double quotes that come from the
+// JSON input so that the output looks like usual block style YAML. Strings
+// which look like other types are quoted again by the encoder.
+func resetStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		resetStyle(child)
+	}
+}
@@ -0,0 +1,157 @@
+package config_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+func TestShow(t *testing.T) {
+	customConfig1 := `---
+port: 9000
+defaults:
+  tag: 4.0.0
+services:
+  proxy:
+    environment:
+      EXTERNAL_ADDRESS: openslides.example.com
+`
+	customConfig2 := `---
+port: 9001
+services:
+  client:
+    tag: 4.0.1
+`
+	c := [][]byte{[]byte(customConfig1), []byte(customConfig2)}
+	names := []string{"a.yml", "b.yml"}
+
+	t.Run("running config.Show() with YAML format", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		if err := config.Show(buf, c, names, "yaml", false); err != nil {
+			t.Fatalf("running config.Show() failed with error: %v", err)
+		}
+		got := buf.String()
+		for _, exp := range []string{
+			"filename: docker-compose.yml\n",
+			"port: \"9001\"\n",
+			"  client:\n    containerRegistry: ghcr.io/openslides/openslides\n    tag: 4.0.1\n",
+			"  proxy:\n    containerRegistry: ghcr.io/openslides/openslides\n    tag: 4.0.0\n    environment:\n      EXTERNAL_ADDRESS: openslides.example.com\n",
+		} {
+			if !strings.Contains(got, exp) {
+				t.Fatalf("got output\n%s\nexpected it to contain %q", got, exp)
+			}
+		}
+		if strings.Contains(got, "#") {
+			t.Fatalf("got output\n%s\nexpected no comments", got)
+		}
+	})
+
+	t.Run("running config.Show() with YAML format and provenance", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		if err := config.Show(buf, c, names, "yaml", true); err != nil {
+			t.Fatalf("running config.Show() failed with error: %v", err)
+		}
+		got := buf.String()
+		for _, exp := range []string{
+			"filename: docker-compose.yml # default for target compose\n",
+			"host: 127.0.0.1 # default\n",
+			"port: \"9001\" # b.yml\n",
+			"  tag: 4.0.0 # a.yml\n",
+			"      EXTERNAL_ADDRESS: openslides.example.com # a.yml\n",
+			"    tag: 4.0.1 # b.yml\n",
+			"    tag: 4.0.0 # defaults.tag (a.yml)\n",
+			"    containerRegistry: ghcr.io/openslides/openslides # defaults.containerRegistry (default)\n",
+		} {
+			if !strings.Contains(got, exp) {
+				t.Fatalf("got output\n%s\nexpected it to contain %q", got, exp)
+			}
+		}
+	})
+
+	t.Run("running config.Show() with JSON format and provenance", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		if err := config.Show(buf, c, names, "json", true); err != nil {
+			t.Fatalf("running config.Show() failed with error: %v", err)
+		}
+		var got struct {
+			Config struct {
+				Port     string `json:"port"`
+				Services map[string]struct {
+					Tag string `json:"tag"`
+				} `json:"services"`
+			} `json:"config"`
+			Provenance map[string]string `json:"provenance"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("unmarshalling output %q: %v", buf.String(), err)
+		}
+		if got.Config.Port != "9001" {
+			t.Fatalf("got port %q, expected %q", got.Config.Port, "9001")
+		}
+		if got.Config.Services["vote"].Tag != "4.0.0" {
+			t.Fatalf("got tag %q for service vote, expected %q", got.Config.Services["vote"].Tag, "4.0.0")
+		}
+		if got.Provenance["port"] != "b.yml" {
+			t.Fatalf("got provenance %q for port, expected %q", got.Provenance["port"], "b.yml")
+		}
+		if got.Provenance["defaultEnvironment.ACTION_HOST"] != "default" {
+			t.Fatalf("got provenance %q for defaultEnvironment.ACTION_HOST, expected %q", got.Provenance["defaultEnvironment.ACTION_HOST"], "default")
+		}
+	})
+
+	t.Run("running config.Show() with provenance and a service given twice", func(t *testing.T) {
+		customConfig3 := "---\nservices:\n  proxy:\n    tag: 4.0.2\n"
+		buf := new(bytes.Buffer)
+		if err := config.Show(buf, append(c, []byte(customConfig3)), append(names, "c.yml"), "yaml", true); err != nil {
+			t.Fatalf("running config.Show() failed with error: %v", err)
+		}
+		got := buf.String()
+		if strings.Contains(got, "EXTERNAL_ADDRESS") {
+			t.Fatalf("got output\n%s\nexpected service proxy to be replaced", got)
+		}
+		if !strings.Contains(got, "  proxy:\n    containerRegistry: ghcr.io/openslides/openslides # defaults.containerRegistry (default)\n    tag: 4.0.2 # c.yml\n") {
+			t.Fatalf("got output\n%s\nexpected service proxy from c.yml", got)
+		}
+	})
+
+	t.Run("running config.Show() with invalid format", func(t *testing.T) {
+		if err := config.Show(new(bytes.Buffer), c, names, "toml", false); err == nil {
+			t.Fatalf("running config.Show() with invalid format should fail")
+		}
+	})
+}
+
+func TestShowCmd(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	customConfigFileName := path.Join(testDir, "custom-config.yml")
+	if err := os.WriteFile(customConfigFileName, []byte("---\nport: 8001\n"), 0666); err != nil {
+		t.Fatalf("writing custom config file: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	cmd := config.Cmd()
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"show", "--config", customConfigFileName, "--provenance", "--target", "kubernetes"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("executing config show subcommand: %v", err)
+	}
+	for _, exp := range []string{
+		"port: \"8001\" # " + customConfigFileName + "\n",
+		"target: kubernetes # --target flag\n",
+		"filename: kubernetes.yml # default for target kubernetes\n",
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Fatalf("got output\n%s\nexpected it to contain %q", buf.String(), exp)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// StateFileName is the name of the file in the setup directory which
+	// records what the setup and config commands generated.
+	StateFileName = ".openslides-state.json"
+
+	// StateFormat is the current format of setup directories. Directories of
+	// an older format are brought to this one by the config upgrade command.
+	StateFormat = 1
+
+	// ConfigUpgradeHelp contains the short help text for the command.
+	ConfigUpgradeHelp = "Upgrades a setup directory created by an older version of this tool"
+
+	// ConfigUpgradeHelpExtra contains the long help text for the command without the headline.
+	ConfigUpgradeHelpExtra = `This command runs all upgrade steps which are required to bring the given setup
+directory to the format of this version of the tool. Directories without state
+file (created before the state file was introduced) get one which records the
+current container configuration YAML files as generated.`
+)
+
+// ToolVersion is the version of this tool which is recorded in the state file.
+// It can be set at build time with
+// -ldflags "-X github.com/OpenSlides/openslides-manage-service/pkg/config.ToolVersion=v1.2.3".
+var ToolVersion = "dev"
+
+// ErrManualEdit is returned if a generated file was changed after it was
+// generated.
+var ErrManualEdit = errors.New("file was changed manually")
+
+// State contains everything the setup and config commands generated in a
+// setup directory. It is stored as JSON in the state file.
+type State struct {
+	// Format is the format of the setup directory, see StateFormat.
+	Format int `json:"format"`
+
+	// ToolVersion is the version of the tool which wrote the state file.
+	ToolVersion string `json:"toolVersion"`
+
+	// ConfigFiles contains the hashes of the setup configuration YAML files
+	// used for the last generated file.
+	ConfigFiles []string `json:"configFiles"`
+
+	// Template contains the hash of the custom template used for the last
+	// generated file or an empty string for the default template.
+	Template string `json:"template,omitempty"`
+
+	// Files maps the names of the generated files to their hashes.
+	Files map[string]string `json:"files"`
+}
+
+// ReadState reads the state file in the given directory. It returns nil
+// without error if there is no state file.
+func ReadState(dir string) (*State, error) {
+	p := path.Join(dir, StateFileName)
+	content, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading file %q: %w", p, err)
+	}
+	state := new(State)
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("unmarshaling state file %q: %w", p, err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]string)
+	}
+	return state, nil
+}
+
+// WriteState writes the state file to the given directory.
+func WriteState(dir string, state *State) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling state: %w", err)
+	}
+	if err := shared.CreateFile(dir, true, StateFileName, append(content, '\n')); err != nil {
+		return fmt.Errorf("creating state file: %w", err)
+	}
+	return nil
+}
+
+// checkFormat returns an error if the state has another format than this
+// version of the tool.
+func (s *State) checkFormat() error {
+	if s.Format > StateFormat {
+		return fmt.Errorf("setup directory was created by the newer version %s of this tool, please update it", s.ToolVersion)
+	}
+	if s.Format < StateFormat {
+		return fmt.Errorf("setup directory was created by the older version %s of this tool, run the config upgrade command first", s.ToolVersion)
+	}
+	return nil
+}
+
+// checkUnchanged returns ErrManualEdit if the file with the given name in the
+// given directory differs from the file recorded in the state. Files which are
+// not recorded or do not exist are not checked.
+func (s *State) checkUnchanged(dir, name string) error {
+	recorded, ok := s.Files[name]
+	if !ok {
+		return nil
+	}
+	p := path.Join(dir, name)
+	content, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("reading file %q: %w", p, err)
+	}
+	if hash(content) != recorded {
+		return fmt.Errorf("%q: %w after it was generated, use the force flag to overwrite it", p, ErrManualEdit)
+	}
+	return nil
+}
+
+// loadState reads the state file in the given directory and checks its format.
+// It returns an empty state if there is no state file.
+func loadState(dir string) (*State, error) {
+	state, err := ReadState(dir)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return &State{Format: StateFormat, Files: make(map[string]string)}, nil
+	}
+	if err := state.checkFormat(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// record records the generated file together with the custom template and the
+// setup configuration YAML files used for it.
+func (s *State) record(tplFile []byte, configFiles [][]byte, name string, content []byte) {
+	s.Format = StateFormat
+	s.ToolVersion = ToolVersion
+	s.ConfigFiles = make([]string, len(configFiles))
+	for i, c := range configFiles {
+		s.ConfigFiles[i] = hash(c)
+	}
+	s.Template = ""
+	if tplFile != nil {
+		s.Template = hash(tplFile)
+	}
+	s.Files[name] = hash(content)
+}
+
+func hash(content []byte) string {
+	h := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+// upgrade is one step to bring a setup directory from one format to the next
+// one.
+type upgrade struct {
+	description string
+	run         func(dir string, state *State) error
+}
+
+// upgrades contains the upgrade steps. The step at index i upgrades a setup
+// directory from format i to format i+1. A directory without state file has
+// format 0.
+var upgrades = []upgrade{
+	{
+		description: "record the existing container configuration YAML files in the state file",
+		run: func(dir string, state *State) error {
+			for _, name := range defaultFilenames {
+				content, err := os.ReadFile(path.Join(dir, name))
+				if err != nil {
+					if errors.Is(err, fs.ErrNotExist) {
+						continue
+					}
+					return fmt.Errorf("reading file %q: %w", name, err)
+				}
+				state.Files[name] = hash(content)
+			}
+			return nil
+		},
+	},
+}
+
+// Upgrade runs all upgrade steps required to bring the given setup directory
+// to the current format. Every applied step is written to w.
+func Upgrade(w io.Writer, dir string) error {
+	state, err := ReadState(dir)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &State{Files: make(map[string]string)}
+	}
+	if state.Format > StateFormat {
+		return state.checkFormat()
+	}
+	if state.Format == StateFormat {
+		fmt.Fprintf(w, "Setup directory %q is up to date.\n", dir)
+		return nil
+	}
+
+	for i := state.Format; i < StateFormat; i++ {
+		u := upgrades[i]
+		if err := u.run(dir, state); err != nil {
+			return fmt.Errorf("upgrading from format %d to %d: %w", i, i+1, err)
+		}
+		state.Format = i + 1
+		fmt.Fprintf(w, "Upgraded to format %d: %s.\n", state.Format, u.description)
+	}
+	state.ToolVersion = ToolVersion
+	return WriteState(dir, state)
+}
+
+// cmdUpgrade returns the config upgrade subcommand.
+func cmdUpgrade() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upgrade directory",
+		Short: ConfigUpgradeHelp,
+		Long:  ConfigUpgradeHelp + "\n\n" + ConfigUpgradeHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if err := Upgrade(cmd.OutOrStdout(), args[0]); err != nil {
+			return fmt.Errorf("running Upgrade(): %w", err)
+		}
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,151 @@
+package config_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+func TestState(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	customConfig := []byte("---\nport: 8001\n")
+	ymlFile := path.Join(testDir, "docker-compose.yml")
+
+	t.Run("running config.Config() writes the state file", func(t *testing.T) {
+		if err := config.Config(testDir, false, nil, [][]byte{customConfig}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		state, err := config.ReadState(testDir)
+		if err != nil {
+			t.Fatalf("reading state failed with error: %v", err)
+		}
+		if state == nil {
+			t.Fatalf("state file %q is missing", config.StateFileName)
+		}
+		if state.Format != config.StateFormat {
+			t.Fatalf("wrong format, expected %d, got %d", config.StateFormat, state.Format)
+		}
+		if state.ToolVersion != config.ToolVersion {
+			t.Fatalf("wrong tool version, expected %q, got %q", config.ToolVersion, state.ToolVersion)
+		}
+		if len(state.ConfigFiles) != 1 || !strings.HasPrefix(state.ConfigFiles[0], "sha256:") {
+			t.Fatalf("wrong config file hashes, got %v", state.ConfigFiles)
+		}
+		if state.Template != "" {
+			t.Fatalf("template hash should be empty for default template, got %q", state.Template)
+		}
+		if _, ok := state.Files["docker-compose.yml"]; !ok {
+			t.Fatalf("hash of docker-compose.yml is missing, got %v", state.Files)
+		}
+	})
+
+	t.Run("running config.Config() again without changes", func(t *testing.T) {
+		if err := config.Config(testDir, false, nil, nil); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+	})
+
+	edited := []byte("---\n# my manual change\n")
+	if err := os.WriteFile(ymlFile, edited, 0666); err != nil {
+		t.Fatalf("editing file failed: %v", err)
+	}
+
+	t.Run("running config.Config() with manually edited file", func(t *testing.T) {
+		err := config.Config(testDir, false, nil, nil)
+		if !errors.Is(err, config.ErrManualEdit) {
+			t.Fatalf("running config.Config() should fail with ErrManualEdit, got %v", err)
+		}
+		got, err := os.ReadFile(ymlFile)
+		if err != nil {
+			t.Fatalf("reading file failed: %v", err)
+		}
+		if !bytes.Equal(got, edited) {
+			t.Fatalf("manually edited file was overwritten")
+		}
+	})
+
+	t.Run("running config.Config() with manually edited file and force", func(t *testing.T) {
+		if err := config.Config(testDir, true, nil, nil); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		got, err := os.ReadFile(ymlFile)
+		if err != nil {
+			t.Fatalf("reading file failed: %v", err)
+		}
+		if bytes.Equal(got, edited) {
+			t.Fatalf("manually edited file was not overwritten")
+		}
+		if err := config.Config(testDir, false, nil, nil); err != nil {
+			t.Fatalf("running config.Config() after forced run failed with error: %v", err)
+		}
+	})
+
+	t.Run("running config.Config() with state of a newer tool", func(t *testing.T) {
+		state := &config.State{Format: config.StateFormat + 1, ToolVersion: "v99.0.0"}
+		if err := config.WriteState(testDir, state); err != nil {
+			t.Fatalf("writing state failed with error: %v", err)
+		}
+		err := config.Config(testDir, true, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "v99.0.0") {
+			t.Fatalf("running config.Config() should fail with hint to newer version, got %v", err)
+		}
+	})
+}
+
+func TestUpgrade(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	// Simulate a setup directory of an old tool without state file.
+	edited := []byte("---\n# my manual change\n")
+	ymlFile := path.Join(testDir, "docker-compose.yml")
+	if err := os.WriteFile(ymlFile, edited, 0666); err != nil {
+		t.Fatalf("writing file failed: %v", err)
+	}
+
+	t.Run("running config.Upgrade() in directory without state file", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		if err := config.Upgrade(buf, testDir); err != nil {
+			t.Fatalf("running config.Upgrade() failed with error: %v", err)
+		}
+		if !strings.Contains(buf.String(), "Upgraded to format 1") {
+			t.Fatalf("got output %q, expected applied upgrade step", buf.String())
+		}
+		state, err := config.ReadState(testDir)
+		if err != nil {
+			t.Fatalf("reading state failed with error: %v", err)
+		}
+		if state == nil || state.Format != config.StateFormat {
+			t.Fatalf("state file was not upgraded, got %v", state)
+		}
+	})
+
+	t.Run("running config.Upgrade() in up to date directory", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		if err := config.Upgrade(buf, testDir); err != nil {
+			t.Fatalf("running config.Upgrade() failed with error: %v", err)
+		}
+		if !strings.Contains(buf.String(), "up to date") {
+			t.Fatalf("got output %q, expected hint for up to date directory", buf.String())
+		}
+	})
+
+	t.Run("running config.Config() after upgrade overwrites the adopted file", func(t *testing.T) {
+		if err := config.Config(testDir, false, nil, nil); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"encoding/json"
+)
+
+// deploy contains the options of a service for Docker Swarm. They are rendered
+// to the deploy section of the service in the stack file.
+type deploy struct {
+	Replicas      *int           `yaml:"replicas" json:"replicas,omitempty"`
+	Placement     *placement     `yaml:"placement" json:"placement,omitempty"`
+	RestartPolicy *restartPolicy `yaml:"restartPolicy" json:"restartPolicy,omitempty"`
+	UpdateConfig  *updateConfig  `yaml:"updateConfig" json:"updateConfig,omitempty"`
+}
+
+type placement struct {
+	Constraints []string `yaml:"constraints" json:"constraints,omitempty"`
+}
+
+type restartPolicy struct {
+	Condition   string `yaml:"condition" json:"condition,omitempty"`
+	Delay       string `yaml:"delay" json:"delay,omitempty"`
+	MaxAttempts *int   `yaml:"maxAttempts" json:"maxAttempts,omitempty"`
+	Window      string `yaml:"window" json:"window,omitempty"`
+}
+
+type updateConfig struct {
+	Parallelism   *int   `yaml:"parallelism" json:"parallelism,omitempty"`
+	Delay         string `yaml:"delay" json:"delay,omitempty"`
+	FailureAction string `yaml:"failureAction" json:"failureAction,omitempty"`
+	Monitor       string `yaml:"monitor" json:"monitor,omitempty"`
+	Order         string `yaml:"order" json:"order,omitempty"`
+}
+
+// stackDeploy returns the deploy section in the format of the Compose file
+// specification. A service gets one replica if nothing else is configured.
+// The resources and the restart key of the service are added because Docker
+// Swarm only reads them from the deploy section.
+func (d *deploy) stackDeploy(res *resources, restart string) map[string]interface{} {
+	result := map[string]interface{}{"replicas": 1}
+	if r := res.composeResources(); r != nil {
+		result["resources"] = r
+	}
+	if restart != "" {
+		result["restart_policy"] = map[string]interface{}{"condition": swarmRestartConditions[restart]}
+	}
+	if d == nil {
+		return result
+	}
+
+	if d.Replicas != nil {
+		result["replicas"] = *d.Replicas
+	}
+	if d.Placement != nil && len(d.Placement.Constraints) > 0 {
+		result["placement"] = map[string]interface{}{"constraints": d.Placement.Constraints}
+	}
+	if rp := d.RestartPolicy; rp != nil {
+		m := make(map[string]interface{})
+		addNonEmpty(m, "condition", rp.Condition)
+		addNonEmpty(m, "delay", rp.Delay)
+		if rp.MaxAttempts != nil {
+			m["max_attempts"] = *rp.MaxAttempts
+		}
+		addNonEmpty(m, "window", rp.Window)
+		result["restart_policy"] = m
+	}
+	if uc := d.UpdateConfig; uc != nil {
+		m := make(map[string]interface{})
+		if uc.Parallelism != nil {
+			m["parallelism"] = *uc.Parallelism
+		}
+		addNonEmpty(m, "delay", uc.Delay)
+		addNonEmpty(m, "failure_action", uc.FailureAction)
+		addNonEmpty(m, "monitor", uc.Monitor)
+		addNonEmpty(m, "order", uc.Order)
+		result["update_config"] = m
+	}
+	return result
+}
+
+func addNonEmpty(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// swarmService contains everything to render one service of the stack file.
+type swarmService struct {
+	workload
+	Deploy            map[string]interface{}
+	Healthcheck       map[string]interface{}
+	AdditionalContent json.RawMessage
+}
+
+// swarmServices returns all services of the stack file for the given config.
+// The environment of the services only contains the variables which are not
+// already in the default environment because the template merges it.
+func swarmServices(cfg *YmlConfig) []swarmService {
+	var result []swarmService
+	for _, w := range append(workloads(cfg), extraWorkloads(cfg)...) {
+		var d *deploy
+		var hc *healthcheck
+		var res *resources
+		var restart string
+		var additionalContent json.RawMessage
+		if s, ok := cfg.Services[w.Name]; ok {
+			d, additionalContent = s.Deploy, s.AdditionalContent
+			hc, res, restart = s.Healthcheck, s.Resources, s.Restart
+		} else {
+			s := cfg.ExtraServices[w.Name]
+			d, additionalContent = s.Deploy, s.AdditionalContent
+			hc, res, restart = s.Healthcheck, s.Resources, s.Restart
+		}
+
+		var env []envVar
+		for _, e := range w.Environment {
+			if v, ok := cfg.DefaultEnvironment[e.Name]; !ok || v != e.Value {
+				env = append(env, e)
+			}
+		}
+		w.Environment = env
+		result = append(result, swarmService{
+			workload:          w,
+			Deploy:            d.stackDeploy(res, restart),
+			Healthcheck:       hc.composeHealthcheck(),
+			AdditionalContent: additionalContent,
+		})
+	}
+	return result
+}
+
+// swarmSecrets returns the names of all secrets used by the given services.
+func swarmSecrets(services []swarmService) []string {
+	ws := make([]workload, len(services))
+	for i, s := range services {
+		ws[i] = s.workload
+	}
+	return workloadSecrets(ws)
+}
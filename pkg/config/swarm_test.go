@@ -0,0 +1,79 @@
+package config_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+func TestSwarmTarget(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	t.Run("running config.Config() with target swarm", func(t *testing.T) {
+		// The user is given because the detected one depends on the test environment.
+		c := [][]byte{[]byte("---\npostgresContainerUser: \"1000:1000\"\n"), config.TargetConfig(config.TargetSwarm)}
+		if err := config.Config(testDir, false, nil, c); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testGoldenFile(t, path.Join(testDir, "docker-stack.yml"), "docker-stack.yml")
+	})
+
+	t.Run("running config.Config() with target swarm and deploy options", func(t *testing.T) {
+		customConfig := `---
+target: swarm
+filename: my-stack.yml
+port: 443
+enableLocalHTTPS: false
+postgresContainerUser: "1000:1000"
+services:
+  autoupdate:
+    deploy:
+      replicas: 4
+      restartPolicy:
+        condition: on-failure
+        maxAttempts: 3
+      updateConfig:
+        parallelism: 2
+        delay: 10s
+        order: start-first
+  postgres:
+    deploy:
+      placement:
+        constraints:
+          - node.labels.openslides-db == true
+    additionalContent:
+      stop_grace_period: 1m
+`
+		if err := config.Validate("custom.yml", []byte(customConfig)); err != nil {
+			t.Fatalf("validating custom config: %v", err)
+		}
+		c := [][]byte{[]byte(customConfig)}
+		if err := config.Config(testDir, false, nil, c); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		testGoldenFile(t, path.Join(testDir, "my-stack.yml"), "docker-stack-custom.yml")
+	})
+
+	t.Run("validating config with invalid deploy options", func(t *testing.T) {
+		customConfig := "---\nservices:\n  vote:\n    deploy:\n      replicas: many\n      updateConfig:\n        order: random\n"
+		err := config.Validate("custom.yml", []byte(customConfig))
+		if err == nil {
+			t.Fatalf("validating config with invalid deploy options should fail")
+		}
+		for _, exp := range []string{
+			`custom.yml:5:17: value of "services.vote.deploy.replicas" must be an integer`,
+			`custom.yml:7:16: value of "services.vote.deploy.updateConfig.order": "random" is not one of`,
+		} {
+			if !strings.Contains(err.Error(), exp) {
+				t.Fatalf("got error message %q, expected %q", err.Error(), exp)
+			}
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// HasService reports whether the given OpenSlides or extra service is part of
+// the deployment. Disabled services are dropped, the postgres service also if
+// disablePostgres is set and the redis service if an external Redis is used.
+func (c *YmlConfig) HasService(name string) bool {
+	if _, ok := c.ExtraServices[name]; ok {
+		return true
+	}
+	s, ok := c.Services[name]
+	if !ok || isDisabled(s) {
+		return false
+	}
+	switch name {
+	case "postgres":
+		return !*c.DisablePostgres
+	case "redis":
+		return !c.UsesExternalRedis()
+	}
+	return true
+}
+
+// indentFunc prefixes every non empty line of the given string with the given
+// number of spaces.
+func indentFunc(ws int, s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = strings.Repeat(" ", ws) + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// toYamlFunc returns the given value as YAML without trailing newline. Use it
+// together with indentFunc to embed values in custom templates.
+func toYamlFunc(v interface{}) (string, error) {
+	y, err := yaml.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("marshalling value to YAML: %w", err)
+	}
+	return strings.TrimRight(string(y), "\n"), nil
+}
+
+// defaultFunc returns the given value or the default if the value is empty,
+// e. g. {{ .Environment.FOO | default "bar" }}.
+func defaultFunc(def interface{}, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return def
+		}
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.String:
+		if rv.Len() == 0 {
+			return def
+		}
+	default:
+		if rv.IsZero() {
+			return def
+		}
+	}
+	return v
+}
+
+// envFunc returns the value of the given environment variable. Without
+// service it is taken from the default environment. With a service the
+// environment of this service takes precedence.
+func envFunc(cfg *YmlConfig, name string, service ...string) (string, error) {
+	if len(service) > 1 {
+		return "", fmt.Errorf("env takes at most one service, got %d", len(service))
+	}
+	if len(service) == 1 {
+		s, ok := cfg.Services[service[0]]
+		if !ok {
+			return "", fmt.Errorf("unknown service %q", service[0])
+		}
+		if v, ok := s.Environment[name]; ok {
+			return v, nil
+		}
+	}
+	return cfg.DefaultEnvironment[name], nil
+}
@@ -0,0 +1,89 @@
+package config_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+const partialTemplate = `{{- define "service.proxy" }}
+  proxy:
+    image: my-registry/my-proxy:{{ .Services.proxy.Tag | default "latest" }}
+    environment:
+      SYSTEM_URL: {{ env "SYSTEM_URL" "proxy" | default "example.com" }}
+    ports:
+      - {{ .Host }}:{{ .Port }}:8000
+    labels:
+{{ toYaml .Services.proxy.Environment | indent 6 }}
+{{- end }}
+`
+
+func TestTemplateLibrary(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	t.Run("running config.Config() with partial template", func(t *testing.T) {
+		customConfig := `---
+services:
+  proxy:
+    environment:
+      SYSTEM_URL: openslides.example.com
+`
+		if err := config.Config(testDir, false, []byte(partialTemplate), [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		got := string(content)
+		for _, expected := range []string{
+			"\n  proxy:\n    image: my-registry/my-proxy:latest\n",
+			"\n      SYSTEM_URL: openslides.example.com\n",
+			"\n    labels:\n      SYSTEM_URL: openslides.example.com\n",
+			"\n  client:\n    image: ghcr.io/openslides/openslides/openslides-client:latest\n",
+			"\nnetworks:\n",
+			"\nsecrets:\n",
+		} {
+			if !strings.Contains(got, expected) {
+				t.Fatalf("compose file does not contain %q, got\n%s", expected, got)
+			}
+		}
+		if strings.Contains(got, "openslides-proxy") {
+			t.Fatalf("compose file should not contain the default proxy, got\n%s", got)
+		}
+	})
+
+	t.Run("running config.Config() with full template", func(t *testing.T) {
+		tpl := `---
+{{- range list "postgres" "redis" "proxy" }}
+{{ . }}: {{ hasService . }}
+{{- end }}
+`
+		customConfig := "---\ndisablePostgres: true\n"
+		if err := config.Config(testDir, false, []byte(tpl), [][]byte{[]byte(customConfig)}); err != nil {
+			t.Fatalf("running config.Config() failed with error: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading compose file: %v", err)
+		}
+		expected := "---\npostgres: false\nredis: true\nproxy: true\n"
+		if string(content) != expected {
+			t.Fatalf("wrong content, expected %q, got %q", expected, content)
+		}
+	})
+
+	t.Run("running config.Config() with invalid template", func(t *testing.T) {
+		tpl := `{{ env "A" "unknown_service" }}`
+		if err := config.Config(testDir, false, []byte(tpl), nil); err == nil {
+			t.Fatalf("running config.Config() with unknown service in env should fail")
+		}
+	})
+}
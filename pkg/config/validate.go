@@ -0,0 +1,494 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigValidateHelp contains the short help text for the command.
+	ConfigValidateHelp = "Validates setup configuration YAML files"
+
+	// ConfigValidateHelpExtra contains the long help text for the command without the headline.
+	ConfigValidateHelpExtra = `This command checks the given setup configuration YAML files for unknown keys,
+wrong types, unknown service names and invalid values. The setup and config
+commands run the same checks automatically.`
+)
+
+// cmdValidate returns the config validate subcommand.
+func cmdValidate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: ConfigValidateHelp,
+		Long:  ConfigValidateHelp + "\n\n" + ConfigValidateHelpExtra,
+		Args:  cobra.NoArgs,
+	}
+
+	configFileNames := FlagConfig(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(*configFileNames) == 0 {
+			return fmt.Errorf("at least one config file must be given")
+		}
+		if _, err := ReadConfigFiles(*configFileNames); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "Config files are valid.")
+		return nil
+	}
+	return cmd
+}
+
+// schema is a small JSON-Schema-like description of a YAML node.
+type schema struct {
+	// typ is one of the types below.
+	typ string
+
+	// properties contains all allowed keys of an object.
+	properties map[string]*schema
+
+	// additionalProperties is the schema for all values of a map. Only used if
+	// typ is typeMap.
+	additionalProperties *schema
+
+	// items is the schema for all entries of a list. Only used if typ is
+	// typeList.
+	items *schema
+
+	// keys is an optional check for the keys of a map.
+	keys func(string) error
+
+	// check is an optional check for the value of a scalar.
+	check func(string) error
+}
+
+const (
+	typeObject = "object" // Mapping with a fixed set of keys.
+	typeMap    = "map"    // Mapping with arbitrary keys.
+	typeString = "string" // Every scalar is accepted and used as string.
+	typeBool   = "boolean"
+	typeInt    = "integer"
+	typeList   = "list"
+	typeAny    = "any"
+)
+
+// configSchema describes the setup configuration YAML file. It must be kept
+// in sync with YmlConfig and service.
+var configSchema = &schema{
+	typ: typeObject,
+	properties: map[string]*schema{
+		"filename":              {typ: typeString},
+		"target":                {typ: typeString, check: checkEnum(TargetCompose, TargetSwarm, TargetKubernetes)},
+		"host":                  {typ: typeString},
+		"port":                  {typ: typeString, check: checkPort},
+		"disablePostgres":       {typ: typeBool},
+		"disableDependsOn":      {typ: typeBool},
+		"enableLocalHTTPS":      {typ: typeBool},
+		"enableManageTLS":       {typ: typeBool},
+		"enableAutoHTTPS":       {typ: typeBool},
+		"postgresContainerUser": {typ: typeString, check: checkPostgresContainerUser},
+		"profile":               {typ: typeString, check: checkProfile},
+		"certificate": {
+			typ: typeObject,
+			properties: map[string]*schema{
+				"dnsNames":       {typ: typeList, items: &schema{typ: typeString}},
+				"ipAddresses":    {typ: typeList, items: &schema{typ: typeString, check: checkIP}},
+				"validityDays":   {typ: typeInt},
+				"keyType":        {typ: typeString, check: checkEnum(KeyTypeECDSA, KeyTypeRSA, KeyTypeEd25519)},
+				"createCA":       {typ: typeBool},
+				"caValidityDays": {typ: typeInt},
+			},
+		},
+		"externalDatabase": {
+			typ: typeObject,
+			properties: map[string]*schema{
+				"host":         {typ: typeString},
+				"port":         {typ: typeString, check: checkPort},
+				"name":         {typ: typeString},
+				"user":         {typ: typeString},
+				"passwordFile": {typ: typeString},
+				"sslMode":      {typ: typeString, check: checkSSLMode},
+				"caFile":       {typ: typeString},
+			},
+		},
+		"externalRedis": {
+			typ: typeObject,
+			properties: map[string]*schema{
+				"host": {typ: typeString},
+				"port": {typ: typeString, check: checkPort},
+			},
+		},
+		"manageAuth": {
+			typ: typeObject,
+			properties: map[string]*schema{
+				"clientCertificates": {typ: typeBool},
+				"password":           {typ: typeBool},
+				"operators":          {typ: typeMap, additionalProperties: &schema{typ: typeString}},
+				"policyFile":         {typ: typeString},
+			},
+		},
+		"email": {
+			typ: typeObject,
+			properties: map[string]*schema{
+				"host":                        {typ: typeString},
+				"port":                        {typ: typeString, check: checkPort},
+				"tlsMode":                     {typ: typeString, check: checkEmailTLSMode},
+				"user":                        {typ: typeString},
+				"passwordFile":                {typ: typeString},
+				"from":                        {typ: typeString},
+				"acceptSelfSignedCertificate": {typ: typeBool},
+			},
+		},
+		"defaults": {
+			typ: typeObject,
+			properties: map[string]*schema{
+				"containerRegistry": {typ: typeString},
+				"tag":               {typ: typeString},
+			},
+		},
+		"defaultEnvironment": {typ: typeMap, additionalProperties: &schema{typ: typeString}},
+		"services": {
+			typ:                  typeMap,
+			keys:                 checkServiceName,
+			additionalProperties: serviceSchema,
+		},
+		"digests": {
+			typ:                  typeMap,
+			keys:                 checkServiceName,
+			additionalProperties: &schema{typ: typeString, check: checkDigest},
+		},
+		"extraServices": {
+			typ:                  typeMap,
+			keys:                 checkExtraServiceName,
+			additionalProperties: extraServiceSchema,
+		},
+	},
+}
+
+var serviceSchema = &schema{
+	typ: typeObject,
+	properties: map[string]*schema{
+		"disabled":          {typ: typeBool},
+		"containerRegistry": {typ: typeString},
+		"tag":               {typ: typeString},
+		"environment":       {typ: typeMap, additionalProperties: &schema{typ: typeString}},
+		"resources":         resourcesSchema,
+		"healthcheck":       healthcheckSchema,
+		"restart":           {typ: typeString, check: checkEnum(restartPolicies...)},
+		"deploy":            deploySchema,
+		"additionalContent": {typ: typeAny},
+	},
+}
+
+var resourceSpecSchema = &schema{
+	typ: typeObject,
+	properties: map[string]*schema{
+		"cpus":   {typ: typeString, check: checkCPUs},
+		"memory": {typ: typeString, check: checkMemory},
+	},
+}
+
+var resourcesSchema = &schema{
+	typ: typeObject,
+	properties: map[string]*schema{
+		"limits":       resourceSpecSchema,
+		"reservations": resourceSpecSchema,
+	},
+}
+
+var healthcheckSchema = &schema{
+	typ: typeObject,
+	properties: map[string]*schema{
+		"test":        {typ: typeList, items: &schema{typ: typeString}},
+		"interval":    {typ: typeString, check: checkDuration},
+		"timeout":     {typ: typeString, check: checkDuration},
+		"startPeriod": {typ: typeString, check: checkDuration},
+		"retries":     {typ: typeInt},
+		"disable":     {typ: typeBool},
+	},
+}
+
+var extraServiceSchema = &schema{
+	typ: typeObject,
+	properties: map[string]*schema{
+		"image":             {typ: typeString},
+		"command":           {typ: typeList, items: &schema{typ: typeString}},
+		"port":              {typ: typeInt},
+		"environment":       {typ: typeMap, additionalProperties: &schema{typ: typeString}},
+		"networks":          {typ: typeList, items: &schema{typ: typeString, check: checkEnum(networkNames...)}},
+		"volumes":           {typ: typeList, items: &schema{typ: typeString}},
+		"secrets":           {typ: typeList, items: &schema{typ: typeString, check: checkSecretName}},
+		"resources":         resourcesSchema,
+		"healthcheck":       healthcheckSchema,
+		"restart":           {typ: typeString, check: checkEnum(restartPolicies...)},
+		"deploy":            deploySchema,
+		"additionalContent": {typ: typeAny},
+	},
+}
+
+var deploySchema = &schema{
+	typ: typeObject,
+	properties: map[string]*schema{
+		"replicas": {typ: typeInt},
+		"placement": {
+			typ: typeObject,
+			properties: map[string]*schema{
+				"constraints": {typ: typeList, items: &schema{typ: typeString}},
+			},
+		},
+		"restartPolicy": {
+			typ: typeObject,
+			properties: map[string]*schema{
+				"condition":   {typ: typeString, check: checkEnum("none", "on-failure", "any")},
+				"delay":       {typ: typeString, check: checkDuration},
+				"maxAttempts": {typ: typeInt},
+				"window":      {typ: typeString, check: checkDuration},
+			},
+		},
+		"updateConfig": {
+			typ: typeObject,
+			properties: map[string]*schema{
+				"parallelism":   {typ: typeInt},
+				"delay":         {typ: typeString, check: checkDuration},
+				"failureAction": {typ: typeString, check: checkEnum("continue", "rollback", "pause")},
+				"monitor":       {typ: typeString, check: checkDuration},
+				"order":         {typ: typeString, check: checkEnum("stop-first", "start-first")},
+			},
+		},
+	},
+}
+
+// ValidationError contains all problems found in a setup configuration YAML
+// file.
+type ValidationError struct {
+	Filename string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config file %q:\n  %s", e.Filename, strings.Join(e.Problems, "\n  "))
+}
+
+// Validate checks the given setup configuration YAML file against the schema.
+// The name is only used in error messages. It returns a *ValidationError if
+// the file is invalid.
+func Validate(name string, content []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return &ValidationError{Filename: name, Problems: []string{fmt.Sprintf("%s: %v", name, err)}}
+	}
+	if len(doc.Content) == 0 {
+		// Empty file
+		return nil
+	}
+
+	var problems []string
+	validateNode(doc.Content[0], configSchema, "", func(n *yaml.Node, format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s:%d:%d: %s", name, n.Line, n.Column, fmt.Sprintf(format, a...)))
+	})
+	if len(problems) > 0 {
+		return &ValidationError{Filename: name, Problems: problems}
+	}
+	return nil
+}
+
+type reportFunc func(n *yaml.Node, format string, a ...interface{})
+
+func validateNode(n *yaml.Node, s *schema, p string, report reportFunc) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		// Null values are treated as not given.
+		return
+	}
+
+	switch s.typ {
+	case typeAny:
+		return
+
+	case typeObject, typeMap:
+		if n.Kind != yaml.MappingNode {
+			report(n, "%s must be a mapping", describe(p))
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			childPath := k.Value
+			if p != "" {
+				childPath = p + "." + k.Value
+			}
+			if s.typ == typeMap {
+				if s.keys != nil {
+					if err := s.keys(k.Value); err != nil {
+						report(k, "%s: %v", describe(childPath), err)
+						continue
+					}
+				}
+				validateNode(v, s.additionalProperties, childPath, report)
+				continue
+			}
+			child, ok := s.properties[k.Value]
+			if !ok {
+				report(k, "unknown key %q%s", k.Value, suggestion(k.Value, s.properties))
+				continue
+			}
+			validateNode(v, child, childPath, report)
+		}
+
+	case typeString:
+		if n.Kind != yaml.ScalarNode {
+			report(n, "%s must be a scalar value", describe(p))
+			return
+		}
+		if err := checkInterpolation(n.Value); err != nil {
+			report(n, "%s: %v", describe(p), err)
+			return
+		}
+		if s.check != nil && !hasInterpolation(n.Value) {
+			// Values with references are checked after interpolation.
+			if err := s.check(n.Value); err != nil {
+				report(n, "%s: %v", describe(p), err)
+			}
+		}
+
+	case typeBool:
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!bool" {
+			report(n, "%s must be true or false", describe(p))
+		}
+
+	case typeInt:
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!int" {
+			report(n, "%s must be an integer", describe(p))
+		}
+
+	case typeList:
+		if n.Kind != yaml.SequenceNode {
+			report(n, "%s must be a list", describe(p))
+			return
+		}
+		for i, item := range n.Content {
+			validateNode(item, s.items, fmt.Sprintf("%s[%d]", p, i), report)
+		}
+	}
+}
+
+func describe(p string) string {
+	if p == "" {
+		return "document"
+	}
+	return fmt.Sprintf("value of %q", p)
+}
+
+// suggestion returns a hint if the unknown key only differs in case from a
+// known key.
+func suggestion(key string, properties map[string]*schema) string {
+	for known := range properties {
+		if strings.EqualFold(key, known) {
+			return fmt.Sprintf(", did you mean %q?", known)
+		}
+	}
+	return ""
+}
+
+func checkEnum(values ...string) func(string) error {
+	return func(v string) error {
+		for _, allowed := range values {
+			if v == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %q", v, values)
+	}
+}
+
+func checkPort(v string) error {
+	port, err := strconv.Atoi(v)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("%q is not a valid port number", v)
+	}
+	return nil
+}
+
+func checkSSLMode(v string) error {
+	if v == "" {
+		return nil
+	}
+	return checkEnum(sslModes...)(v)
+}
+
+func checkDigest(v string) error {
+	if v == "" {
+		return nil
+	}
+	if !digestRegexp.MatchString(v) {
+		return fmt.Errorf("invalid digest, use sha256: followed by 64 hexadecimal digits")
+	}
+	return nil
+}
+
+func checkIP(v string) error {
+	if net.ParseIP(v) == nil {
+		return fmt.Errorf("%q is not a valid IP address", v)
+	}
+	return nil
+}
+
+func checkDuration(v string) error {
+	if _, err := time.ParseDuration(v); err != nil {
+		return fmt.Errorf("%q is not a valid duration like 10s or 1m30s", v)
+	}
+	return nil
+}
+
+var postgresContainerUserRegexp = regexp.MustCompile(`^(\d+:\d+)?$`)
+
+func checkPostgresContainerUser(v string) error {
+	if !postgresContainerUserRegexp.MatchString(v) {
+		return fmt.Errorf("%q must be of form <uid>:<gid>", v)
+	}
+	return nil
+}
+
+// checkCertificate checks the values of the merged certificate config which
+// are used by the setup command.
+func checkCertificate(c certificate) error {
+	if len(c.DNSNames) == 0 && len(c.IPAddresses) == 0 {
+		return fmt.Errorf("at least one DNS name or IP address is required")
+	}
+	for _, ip := range c.IPAddresses {
+		if err := checkIP(ip); err != nil {
+			return err
+		}
+	}
+	if c.ValidityDays < 1 {
+		return fmt.Errorf("validityDays must be positive, got %d", c.ValidityDays)
+	}
+	if err := checkEnum(KeyTypeECDSA, KeyTypeRSA, KeyTypeEd25519)(c.KeyType); err != nil {
+		return fmt.Errorf("keyType: %w", err)
+	}
+	if c.CreateCA != nil && *c.CreateCA && c.CAValidityDays <= c.ValidityDays {
+		// Certificates signed by the CA become invalid when the CA expires.
+		return fmt.Errorf("caValidityDays must be greater than validityDays (%d), got %d", c.ValidityDays, c.CAValidityDays)
+	}
+	return nil
+}
+
+func checkServiceName(name string) error {
+	for _, known := range allServices() {
+		if name == known {
+			return nil
+		}
+	}
+	names := allServices()
+	sort.Strings(names)
+	return fmt.Errorf("unknown service, use one of %s", strings.Join(names, ", "))
+}
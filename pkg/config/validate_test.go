@@ -0,0 +1,178 @@
+package config_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+)
+
+func TestValidate(t *testing.T) {
+	t.Run("validating the default config", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+
+		cmd := config.CmdCreateDefault()
+		cmd.SetArgs([]string{testDir})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing config-create-default subcommand: %v", err)
+		}
+		content, err := os.ReadFile(path.Join(testDir, "config.yml"))
+		if err != nil {
+			t.Fatalf("reading default config: %v", err)
+		}
+		if err := config.Validate("config.yml", content); err != nil {
+			t.Fatalf("validating default config: %v", err)
+		}
+	})
+
+	for _, tt := range []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{
+			name:    "unknown key",
+			content: "---\nservces:\n  proxy:\n    tag: 4.0.0\n",
+			errMsg:  `custom.yml:2:1: unknown key "servces"`,
+		},
+		{
+			name:    "key with wrong case",
+			content: "---\nenableLocalHttps: false\n",
+			errMsg:  `custom.yml:2:1: unknown key "enableLocalHttps", did you mean "enableLocalHTTPS"?`,
+		},
+		{
+			name:    "unknown key in service",
+			content: "---\nservices:\n  proxy:\n    tags: 4.0.0\n",
+			errMsg:  `custom.yml:4:5: unknown key "tags"`,
+		},
+		{
+			name:    "wrong type for boolean",
+			content: "---\ndisablePostgres: \"yes\"\n",
+			errMsg:  `custom.yml:2:18: value of "disablePostgres" must be true or false`,
+		},
+		{
+			name:    "wrong type for environment",
+			content: "---\ndefaultEnvironment:\n  - FOO\n",
+			errMsg:  `custom.yml:3:3: value of "defaultEnvironment" must be a mapping`,
+		},
+		{
+			name:    "unknown service",
+			content: "---\nservices:\n  proxxy:\n    tag: 4.0.0\n",
+			errMsg:  `custom.yml:3:3: value of "services.proxxy": unknown service`,
+		},
+		{
+			name:    "malformed postgresContainerUser",
+			content: "---\npostgresContainerUser: root\n",
+			errMsg:  `custom.yml:2:24: value of "postgresContainerUser": "root" must be of form <uid>:<gid>`,
+		},
+		{
+			name:    "invalid port",
+			content: "---\nport: 80000\n",
+			errMsg:  `custom.yml:2:7: value of "port": "80000" is not a valid port number`,
+		},
+		{
+			name:    "invalid target",
+			content: "---\ntarget: swarmm\n",
+			errMsg:  `custom.yml:2:9: value of "target": "swarmm" is not one of`,
+		},
+		{
+			name:    "invalid YAML",
+			content: "---\nport: [8000\n",
+			errMsg:  `custom.yml: yaml: line`,
+		},
+	} {
+		t.Run("validating config with "+tt.name, func(t *testing.T) {
+			err := config.Validate("custom.yml", []byte(tt.content))
+			if err == nil {
+				t.Fatalf("validating config should fail")
+			}
+			var vErr *config.ValidationError
+			if !errors.As(err, &vErr) {
+				t.Fatalf("validating config should return a *config.ValidationError, got %T", err)
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("validating config, got error message %q, expected %q", err.Error(), tt.errMsg)
+			}
+		})
+	}
+
+	t.Run("validating config with several problems", func(t *testing.T) {
+		content := "---\nport: 0\nservices:\n  proxxy: {}\n"
+		err := config.Validate("custom.yml", []byte(content))
+		var vErr *config.ValidationError
+		if !errors.As(err, &vErr) {
+			t.Fatalf("validating config should return a *config.ValidationError, got %v", err)
+		}
+		if len(vErr.Problems) != 2 {
+			t.Fatalf("validating config, got %d problems, expected 2: %v", len(vErr.Problems), vErr.Problems)
+		}
+	})
+
+	t.Run("validating config with null values", func(t *testing.T) {
+		content := "---\nservices:\n  proxy:\ndefaultEnvironment:\n"
+		if err := config.Validate("custom.yml", []byte(content)); err != nil {
+			t.Fatalf("validating config: %v", err)
+		}
+	})
+}
+
+func TestValidateCmd(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	valid := path.Join(testDir, "valid.yml")
+	if err := os.WriteFile(valid, []byte("---\nport: 8001\n"), 0666); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	invalid := path.Join(testDir, "invalid.yml")
+	if err := os.WriteFile(invalid, []byte("---\nservces: {}\n"), 0666); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	t.Run("executing config validate with valid files", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		cmd := config.Cmd()
+		cmd.SetOut(buf)
+		cmd.SetArgs([]string{"validate", "-c", valid, "-c", valid})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing config validate subcommand: %v", err)
+		}
+		if got := buf.String(); got != "Config files are valid.\n" {
+			t.Fatalf("got output %q, expected %q", got, "Config files are valid.\n")
+		}
+	})
+
+	t.Run("executing config validate with invalid file", func(t *testing.T) {
+		cmd := config.Cmd()
+		cmd.SetArgs([]string{"validate", "-c", valid, "-c", invalid})
+		err := cmd.Execute()
+		if err == nil {
+			t.Fatalf("executing config validate subcommand with invalid file should fail")
+		}
+		if !strings.Contains(err.Error(), invalid+":2:1") {
+			t.Fatalf("got error message %q, expected file name and line number", err.Error())
+		}
+	})
+
+	t.Run("executing config with invalid file", func(t *testing.T) {
+		cmd := config.Cmd()
+		cmd.SetArgs([]string{testDir, "-c", invalid})
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("executing config subcommand with invalid file should fail")
+		}
+		if _, err := os.Stat(path.Join(testDir, "docker-compose.yml")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("file docker-compose.yml exists, expected non existance")
+		}
+	})
+}
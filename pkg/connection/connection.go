@@ -1,11 +1,16 @@
 package connection
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
@@ -30,51 +35,200 @@ type Params struct {
 	PasswordFile *string
 	Timeout      *time.Duration
 	NoSSL        *bool
+	CAFile       *string
+	Fingerprint  *string
+	Insecure     *bool
+	ClientCert   *string
+	ClientKey    *string
 }
 
-// Dial creates a gRPC connection to the server.
-func Dial(ctx context.Context, address, passwordFile string, ssl bool) (proto.ManageClient, func() error, error) {
-	pw, err := shared.AuthSecret(passwordFile, os.Getenv("OPENSLIDES_DEVELOPMENT"))
-	if err != nil {
-		return nil, nil, fmt.Errorf("getting server auth secret: %w", err)
+// TLSOptions returns the options for the encryption of the connection given
+// by the flags. The default CA file is the certificate for local HTTPS. It is
+// only used if it exists and neither a fingerprint nor the insecure flag is
+// given.
+func (p Params) TLSOptions() TLSOptions {
+	caFile := *p.CAFile
+	if caFile == defaultCAFile() {
+		if _, err := os.Stat(caFile); err != nil || *p.Fingerprint != "" || *p.Insecure {
+			caFile = ""
+		}
 	}
-	creds := shared.BasicAuth{
-		Password: pw,
+	return TLSOptions{
+		Disabled:       *p.NoSSL,
+		CAFile:         caFile,
+		Fingerprint:    *p.Fingerprint,
+		Insecure:       *p.Insecure,
+		ClientCertFile: *p.ClientCert,
+		ClientKeyFile:  *p.ClientKey,
 	}
+}
 
-	transportOption := grpc.WithInsecure() // Option for unencrypted HTTP connection
-	if ssl {
-		// TODO: Have a look at https://itnext.io/practical-guide-to-securing-grpc-connections-with-go-and-tls-part-1-f63058e9d6d1 and
-		// try not to use InsecureSkipVerify by default.
-		transCreds := credentials.NewTLS(&tls.Config{
-			InsecureSkipVerify: true,
-		})
-		transportOption = grpc.WithTransportCredentials(transCreds)
+// TLSOptions contains the options for the encryption of the connection to the
+// manage server. By default the certificate of the server is verified with the
+// CAs of the system.
+type TLSOptions struct {
+	// Disabled means an unencrypted connection.
+	Disabled bool
+
+	// CAFile is a file with PEM encoded CA certificates which are used instead
+	// of the CAs of the system.
+	CAFile string
+
+	// Fingerprint is the SHA-256 fingerprint of the server certificate in hex.
+	// If it is given without CAFile, only the fingerprint is checked, so it
+	// can be used for self-signed certificates.
+	Fingerprint string
+
+	// Insecure disables all checks of the server certificate.
+	Insecure bool
+
+	// ClientCertFile and ClientKeyFile contain the PEM encoded client
+	// certificate and its key. If they are given, the client authenticates
+	// with the certificate instead of the password.
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// Config returns the TLS config for the options. It returns nil if the
+// encryption is disabled.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if o.Disabled {
+		if o.ClientCertFile != "" {
+			return nil, fmt.Errorf("a client certificate can not be used with an unencrypted connection")
+		}
+		return nil, nil
 	}
 
-	conn, err := grpc.DialContext(ctx, address,
+	c := &tls.Config{}
+	if o.ClientCertFile != "" || o.ClientKeyFile != "" {
+		if o.ClientCertFile == "" || o.ClientKeyFile == "" {
+			return nil, fmt.Errorf("the client certificate and the client key have to be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.ClientCertFile, o.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	if o.Insecure {
+		if o.CAFile != "" || o.Fingerprint != "" {
+			return nil, fmt.Errorf("the insecure flag can not be combined with a CA file or a fingerprint")
+		}
+		c.InsecureSkipVerify = true
+		return c, nil
+	}
+
+	if o.CAFile != "" {
+		content, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file %q: %w", o.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no PEM encoded certificate found in CA file %q", o.CAFile)
+		}
+		c.RootCAs = pool
+	}
+	if o.Fingerprint != "" {
+		expected, err := parseFingerprint(o.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		// Without CA file the chain is not verified, so the fingerprint is the
+		// only check. This is done in VerifyPeerCertificate.
+		c.InsecureSkipVerify = o.CAFile == ""
+		c.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("server did not send a certificate")
+			}
+			got := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(got[:], expected) {
+				return fmt.Errorf("fingerprint of server certificate %s does not match", Fingerprint(rawCerts[0]))
+			}
+			return nil
+		}
+	}
+	return c, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the given DER encoded
+// certificate as uppercase hex with colons.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func parseFingerprint(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.ToLower(s), "sha256:")
+	b, err := hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid fingerprint %q, use the SHA-256 fingerprint in hex", s)
+	}
+	return b, nil
+}
+
+// Dial creates a gRPC connection to the server. The password is only used if
+// no client certificate is given.
+func Dial(ctx context.Context, address, passwordFile string, tlsOptions TLSOptions) (proto.ManageClient, func() error, error) {
+	tlsConfig, err := tlsOptions.Config()
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating TLS config: %w", err)
+	}
+	transportOption := grpc.WithInsecure() // Option for unencrypted HTTP connection
+	if tlsConfig != nil {
+		transportOption = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+	opts := []grpc.DialOption{
 		transportOption,
 		grpc.WithBlock(),
-		grpc.WithPerRPCCredentials(creds),
-	)
+	}
+
+	if tlsOptions.ClientCertFile == "" {
+		pw, err := shared.AuthSecret(passwordFile, os.Getenv("OPENSLIDES_DEVELOPMENT"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("getting server auth secret: %w", err)
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(shared.BasicAuth{Password: pw}))
+	}
+
+	conn, err := grpc.DialContext(ctx, address, opts...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("creating gRPC client connection with grpc.DialContext(): %w", err)
 	}
 	return proto.NewManageClient(conn), conn.Close, nil
 }
 
+func defaultCAFile() string {
+	return path.Join(".", setup.SecretsDirName, setup.CertCertName)
+}
+
 // Unary provides parameters for an unary connection like address, passwordfile,
-// timeout and the noSSL flag to the given cobra command.
+// timeout and the TLS flags to the given cobra command.
 func Unary(cmd *cobra.Command) Params {
 	addr := cmd.Flags().StringP("address", "a", defaultAddr, "address of the OpenSlides manage service")
 	defaultPasswordFile := path.Join(".", setup.SecretsDirName, setup.ManageAuthPasswordFileName)
 	passwordFile := cmd.Flags().String("password-file", defaultPasswordFile, "file with password for authorization to manage service, not usable in development mode")
 	noSSL := cmd.Flags().Bool("no-ssl", false, "use an unencrypted connection to manage service")
+	caFile := cmd.Flags().String("ca-file", defaultCAFile(), "file with PEM encoded CA certificates to verify the manage service instead of the CAs of the system, the default is only used if it exists")
+	fingerprint := cmd.Flags().String("fingerprint", "", "SHA-256 fingerprint of the certificate of the manage service, e. g. for self-signed certificates")
+	insecure := cmd.Flags().Bool("insecure", false, "do not verify the certificate of the manage service")
+	clientCert := cmd.Flags().String("client-cert", "", "file with the client certificate to authenticate at the manage service instead of the password, see certs issue-client")
+	clientKey := cmd.Flags().String("client-key", "", "file with the key of the client certificate")
 	timeout := cmd.Flags().DurationP("timeout", "t", defaultTimeout, "time to wait for the command's response")
 	return Params{
 		Addr:         addr,
 		PasswordFile: passwordFile,
 		NoSSL:        noSSL,
+		CAFile:       caFile,
+		Fingerprint:  fingerprint,
+		Insecure:     insecure,
+		ClientCert:   clientCert,
+		ClientKey:    clientKey,
 		Timeout:      timeout,
 	}
 }
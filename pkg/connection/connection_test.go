@@ -1,7 +1,157 @@
 package connection_test
 
-import "testing"
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/spf13/cobra"
+)
 
 func TestDial(t *testing.T) {
 	t.Skip("test is missing here")
 }
+
+func TestTLSOptions(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	// The self-signed certificate for local HTTPS is valid for localhost.
+	if err := setup.Setup(testDir, false, nil, nil, nil); err != nil {
+		t.Fatalf("running Setup() failed with error: %v", err)
+	}
+	certFile := path.Join(testDir, setup.SecretsDirName, setup.CertCertName)
+	keyFile := path.Join(testDir, setup.SecretsDirName, setup.CertKeyName)
+	addr := tlsServer(t, certFile, keyFile)
+
+	content, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatalf("reading certificate: %v", err)
+	}
+	block, _ := pem.Decode(content)
+	fingerprint := connection.Fingerprint(block.Bytes)
+	otherFingerprint := strings.Repeat("00", 32)
+
+	for _, tt := range []struct {
+		name    string
+		options connection.TLSOptions
+		ok      bool
+	}{
+		{"default options and self-signed certificate", connection.TLSOptions{}, false},
+		{"CA file", connection.TLSOptions{CAFile: certFile}, true},
+		{"fingerprint", connection.TLSOptions{Fingerprint: fingerprint}, true},
+		{"lowercase fingerprint without colons", connection.TLSOptions{Fingerprint: strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))}, true},
+		{"wrong fingerprint", connection.TLSOptions{Fingerprint: otherFingerprint}, false},
+		{"CA file and wrong fingerprint", connection.TLSOptions{CAFile: certFile, Fingerprint: otherFingerprint}, false},
+		{"insecure", connection.TLSOptions{Insecure: true}, true},
+	} {
+		t.Run("connecting with "+tt.name, func(t *testing.T) {
+			cfg, err := tt.options.Config()
+			if err != nil {
+				t.Fatalf("creating TLS config: %v", err)
+			}
+			conn, err := tls.Dial("tcp", addr, cfg)
+			if err == nil {
+				conn.Close()
+			}
+			if tt.ok && err != nil {
+				t.Fatalf("connecting failed: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatalf("connecting should fail, but it did not")
+			}
+		})
+	}
+
+	t.Run("disabled TLS", func(t *testing.T) {
+		cfg, err := connection.TLSOptions{Disabled: true, Insecure: true}.Config()
+		if err != nil {
+			t.Fatalf("creating TLS config: %v", err)
+		}
+		if cfg != nil {
+			t.Fatalf("TLS config should be nil if TLS is disabled")
+		}
+	})
+
+	for _, tt := range []struct {
+		name    string
+		options connection.TLSOptions
+	}{
+		{"insecure and CA file", connection.TLSOptions{Insecure: true, CAFile: certFile}},
+		{"insecure and fingerprint", connection.TLSOptions{Insecure: true, Fingerprint: fingerprint}},
+		{"invalid fingerprint", connection.TLSOptions{Fingerprint: "AB:CD"}},
+		{"missing CA file", connection.TLSOptions{CAFile: path.Join(testDir, "missing")}},
+		{"CA file without certificate", connection.TLSOptions{CAFile: path.Join(testDir, setup.SecretsDirName, "auth_token_key")}},
+		{"client certificate without key", connection.TLSOptions{ClientCertFile: certFile}},
+		{"client certificate and unencrypted connection", connection.TLSOptions{Disabled: true, ClientCertFile: certFile, ClientKeyFile: keyFile}},
+	} {
+		t.Run("creating TLS config with "+tt.name, func(t *testing.T) {
+			if _, err := tt.options.Config(); err == nil {
+				t.Fatalf("creating TLS config should fail, but it did not")
+			}
+		})
+	}
+}
+
+func TestUnaryTLSOptions(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		expected connection.TLSOptions
+	}{
+		// The default CA file secrets/cert_crt does not exist in the test directory.
+		{"default flags", nil, connection.TLSOptions{}},
+		{"CA file", []string{"--ca-file", "ca.pem"}, connection.TLSOptions{CAFile: "ca.pem"}},
+		{"fingerprint", []string{"--fingerprint", "AB:CD"}, connection.TLSOptions{Fingerprint: "AB:CD"}},
+		{"insecure", []string{"--insecure"}, connection.TLSOptions{Insecure: true}},
+		{"no SSL", []string{"--no-ssl"}, connection.TLSOptions{Disabled: true}},
+	} {
+		t.Run("parsing flags with "+tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cp := connection.Unary(cmd)
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatalf("parsing flags: %v", err)
+			}
+			if got := cp.TLSOptions(); got != tt.expected {
+				t.Fatalf("got TLS options %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// tlsServer starts a TLS server with the given certificate which completes the
+// handshake with every client. It returns the address to connect to.
+func tlsServer(t *testing.T, certFile, keyFile string) string {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("loading key pair: %v", err)
+	}
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("listening for TLS server: %v", err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return fmt.Sprintf("localhost:%d", lis.Addr().(*net.TCPAddr).Port)
+}
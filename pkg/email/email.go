@@ -0,0 +1,247 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// EmailHelp contains the short help text for the command.
+	EmailHelp = "Contains subcommands for the email server of OpenSlides"
+
+	// EmailHelpExtra contains the long help text for the command without the
+	// headline.
+	EmailHelpExtra = `The email server is configured in the email section of the setup
+configuration.`
+
+	// TestHelp contains the short help text for the test subcommand.
+	TestHelp = "Sends a test email using the email server of OpenSlides"
+
+	// TestHelpExtra contains the long help text for the test subcommand without
+	// the headline.
+	TestHelpExtra = `This command lets the manage service send a test email to the given
+address. It uses the same email settings as the backend, so it can be used to
+check the email section of the setup configuration.`
+)
+
+// Security modes as used in the environment variable EMAIL_CONNECTION_SECURITY.
+const (
+	SecuritySSLTLS   = "SSL/TLS"
+	SecurityStartTLS = "STARTTLS"
+	SecurityNone     = "NONE"
+)
+
+// Cmd returns the subcommand.
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "email",
+		Short: EmailHelp,
+		Long:  EmailHelp + "\n\n" + EmailHelpExtra,
+	}
+
+	cmd.AddCommand(
+		testCmd(),
+	)
+
+	return cmd
+}
+
+func testCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: TestHelp,
+		Long:  TestHelp + "\n\n" + TestHelpExtra,
+		Args:  cobra.NoArgs,
+	}
+	cp := connection.Unary(cmd)
+
+	to := cmd.Flags().String("to", "", "address of the recipient of the test email")
+	cmd.MarkFlagRequired("to")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
+		defer cancel()
+
+		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, cp.TLSOptions())
+		if err != nil {
+			return fmt.Errorf("connecting to gRPC server: %w", err)
+		}
+		defer close()
+
+		if err := Run(ctx, cl, *to); err != nil {
+			return fmt.Errorf("sending test email: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Test email sent to %s\n", *to)
+		return nil
+	}
+	return cmd
+}
+
+// Client
+
+type gRPCClient interface {
+	SendTestEmail(ctx context.Context, in *proto.SendTestEmailRequest, opts ...grpc.CallOption) (*proto.SendTestEmailResponse, error)
+}
+
+// Run calls respective procedure to send a test email to the given address.
+func Run(ctx context.Context, gc gRPCClient, to string) error {
+	in := &proto.SendTestEmailRequest{
+		To: to,
+	}
+	if _, err := gc.SendTestEmail(ctx, in); err != nil {
+		s, _ := status.FromError(err) // The ok value does not matter here.
+		return fmt.Errorf("calling manage service (sending test email to %q): %s", to, s.Message())
+	}
+	return nil
+}
+
+// Server
+
+// Settings contains the options of the email server. They are the same as
+// for the backend.
+type Settings struct {
+	Host                        string
+	Port                        string
+	Security                    string
+	User                        string
+	PasswordFile                string
+	From                        string
+	AcceptSelfSignedCertificate bool
+}
+
+// SendTestEmail sends a test email to the address given in the request. This
+// function is the server side entrypoint for this package.
+func SendTestEmail(ctx context.Context, in *proto.SendTestEmailRequest, s Settings) (*proto.SendTestEmailResponse, error) {
+	if err := Send(ctx, s, in.To, "OpenSlides test email", "This is a test email sent by OpenSlides.\r\n"); err != nil {
+		return nil, fmt.Errorf("sending test email to %q: %w", in.To, err)
+	}
+	return &proto.SendTestEmailResponse{}, nil
+}
+
+// Send sends an email with the given subject and body using the given
+// settings.
+func Send(ctx context.Context, s Settings, to string, subject string, body string) error {
+	if s.Host == "" {
+		return fmt.Errorf("no email server configured")
+	}
+	if to == "" || strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", to)
+	}
+
+	c, err := dial(ctx, s)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if s.User != "" {
+		password, err := readPassword(s.PasswordFile)
+		if err != nil {
+			return err
+		}
+		if err := c.Auth(smtp.PlainAuth("", s.User, password, s.Host)); err != nil {
+			return fmt.Errorf("authenticating at email server: %w", err)
+		}
+	}
+
+	if err := c.Mail(s.From); err != nil {
+		return fmt.Errorf("sending sender %q: %w", s.From, err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("sending recipient %q: %w", to, err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("starting data: %w", err)
+	}
+	if _, err := w.Write(message(s.From, to, subject, body)); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("finishing data: %w", err)
+	}
+	if err := c.Quit(); err != nil {
+		return fmt.Errorf("quitting connection: %w", err)
+	}
+	return nil
+}
+
+// dial connects to the email server and starts TLS according to the security
+// mode of the settings.
+func dial(ctx context.Context, s Settings) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.Host, s.Port)
+	tlsConfig := &tls.Config{
+		ServerName:         s.Host,
+		InsecureSkipVerify: s.AcceptSelfSignedCertificate,
+	}
+
+	dialer := new(net.Dialer)
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to email server at %q: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	switch s.Security {
+	case SecuritySSLTLS:
+		conn = tls.Client(conn, tlsConfig)
+	case SecurityStartTLS, SecurityNone:
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("unknown connection security %q", s.Security)
+	}
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("starting SMTP session with %q: %w", addr, err)
+	}
+	if s.Security == SecurityStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("starting TLS: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func readPassword(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	pw, err := shared.ReadSecretFile(file)
+	if err != nil {
+		return "", fmt.Errorf("reading email password file %q: %w", file, err)
+	}
+	return string(bytes.TrimRight(pw, "\r\n")), nil
+}
+
+func message(from, to, subject, body string) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", to)
+	fmt.Fprintf(buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(body)
+	return buf.Bytes()
+}
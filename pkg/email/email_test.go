@@ -0,0 +1,244 @@
+package email_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/OpenSlides/openslides-manage-service/pkg/email"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"google.golang.org/grpc"
+)
+
+// Client tests.
+
+type mockEmailClient struct {
+	givenTo string
+	err     error
+}
+
+func (m *mockEmailClient) SendTestEmail(ctx context.Context, in *proto.SendTestEmailRequest, opts ...grpc.CallOption) (*proto.SendTestEmailResponse, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.givenTo = in.To
+	return &proto.SendTestEmailResponse{}, nil
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("send test email", func(t *testing.T) {
+		mc := new(mockEmailClient)
+		if err := email.Run(ctx, mc, "admin@example.com"); err != nil {
+			t.Fatalf("running email.Run() failed with error: %v", err)
+		}
+		if mc.givenTo != "admin@example.com" {
+			t.Fatalf("gRPC client was called with %q, expected %q", mc.givenTo, "admin@example.com")
+		}
+	})
+
+	t.Run("send test email with error", func(t *testing.T) {
+		mc := new(mockEmailClient)
+		mc.err = errors.New("connection refused")
+		if err := email.Run(ctx, mc, "admin@example.com"); err == nil {
+			t.Fatalf("running email.Run() should fail, but it did not")
+		}
+	})
+}
+
+// Server tests.
+
+// fakeSMTPServer is a local stand-in for an email server. It speaks a minimal
+// SMTP dialogue without TLS and sends every received message to the channel.
+type fakeSMTPServer struct {
+	lis      net.Listener
+	messages chan string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening for fake SMTP server: %v", err)
+	}
+	s := &fakeSMTPServer{
+		lis:      lis,
+		messages: make(chan string, 1),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) port() string {
+	return fmt.Sprint(s.lis.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ESMTP fake")
+	var msg strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH PLAIN "):
+			credentials, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line)[len("AUTH PLAIN "):])
+			if err != nil {
+				reply("501 Invalid credentials")
+				continue
+			}
+			msg.WriteString("AUTH " + strings.ReplaceAll(string(credentials), "\x00", " ") + "\n")
+			reply("235 OK")
+		case strings.HasPrefix(cmd, "MAIL FROM:"), strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.WriteString(strings.TrimSpace(line) + "\n")
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 Go ahead")
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.messages <- msg.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSendTestEmail(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("send test email to fake SMTP server", func(t *testing.T) {
+		srv := newFakeSMTPServer(t)
+		defer srv.lis.Close()
+
+		settings := email.Settings{
+			Host:     "127.0.0.1",
+			Port:     srv.port(),
+			Security: email.SecurityNone,
+			From:     "noreply@example.com",
+		}
+		in := &proto.SendTestEmailRequest{To: "admin@example.com"}
+		if _, err := email.SendTestEmail(ctx, in, settings); err != nil {
+			t.Fatalf("running email.SendTestEmail() failed with error: %v", err)
+		}
+
+		got := <-srv.messages
+		for _, expected := range []string{
+			"MAIL FROM:<noreply@example.com>",
+			"RCPT TO:<admin@example.com>",
+			"Subject: OpenSlides test email",
+			"To: admin@example.com",
+		} {
+			if !strings.Contains(got, expected) {
+				t.Fatalf("received message does not contain %q, got\n%s", expected, got)
+			}
+		}
+	})
+
+	t.Run("send test email with encrypted password file", func(t *testing.T) {
+		srv := newFakeSMTPServer(t)
+		defer srv.lis.Close()
+
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatalf("generating age identity: %v", err)
+		}
+		identityFile := path.Join(testDir, "identity.txt")
+		if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+			t.Fatalf("writing identity file: %v", err)
+		}
+		t.Setenv(shared.IdentityFileEnv, identityFile)
+		encrypted, err := shared.Encrypt([]byte("secret_Eeph3ahx\n"), []age.Recipient{identity.Recipient()})
+		if err != nil {
+			t.Fatalf("encrypting password: %v", err)
+		}
+		if err := os.WriteFile(path.Join(testDir, "email_password"+shared.EncryptedSuffix), encrypted, 0600); err != nil {
+			t.Fatalf("writing password file: %v", err)
+		}
+
+		settings := email.Settings{
+			Host:         "127.0.0.1",
+			Port:         srv.port(),
+			Security:     email.SecurityNone,
+			User:         "openslides",
+			PasswordFile: path.Join(testDir, "email_password"),
+			From:         "noreply@example.com",
+		}
+		in := &proto.SendTestEmailRequest{To: "admin@example.com"}
+		if _, err := email.SendTestEmail(ctx, in, settings); err != nil {
+			t.Fatalf("running email.SendTestEmail() failed with error: %v", err)
+		}
+		if got := <-srv.messages; !strings.Contains(got, "AUTH  openslides secret_Eeph3ahx\n") {
+			t.Fatalf("received message does not contain the decrypted credentials, got\n%s", got)
+		}
+	})
+
+	t.Run("send test email without email server", func(t *testing.T) {
+		in := &proto.SendTestEmailRequest{To: "admin@example.com"}
+		if _, err := email.SendTestEmail(ctx, in, email.Settings{}); err == nil {
+			t.Fatalf("running email.SendTestEmail() without host should fail, but it did not")
+		}
+	})
+
+	t.Run("send test email with unknown connection security", func(t *testing.T) {
+		srv := newFakeSMTPServer(t)
+		defer srv.lis.Close()
+
+		settings := email.Settings{
+			Host:     "127.0.0.1",
+			Port:     srv.port(),
+			Security: "unknown",
+		}
+		in := &proto.SendTestEmailRequest{To: "admin@example.com"}
+		if _, err := email.SendTestEmail(ctx, in, settings); err == nil {
+			t.Fatalf("running email.SendTestEmail() with unknown security should fail, but it did not")
+		}
+	})
+}
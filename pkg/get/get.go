@@ -62,7 +62,7 @@ func Cmd() *cobra.Command {
 		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, cp.TLSOptions())
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -1,6 +1,7 @@
 package initialdata
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -27,7 +28,8 @@ const (
 	// the headline.
 	InitialDataHelpExtra = `This command also sets password of user 1 to the value of the docker secret
 "superadmin" which is "superadmin" by default. It returns an error if the
-datastore is not empty.`
+datastore is not empty. It prints a warning if the default password is used
+outside of development mode.`
 )
 
 // Cmd returns the subcommand.
@@ -56,7 +58,7 @@ func Cmd() *cobra.Command {
 		ctx, cancel := context.WithTimeout(context.Background(), *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := connection.Dial(ctx, *cp.Addr, *cp.PasswordFile, cp.TLSOptions())
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
@@ -91,6 +93,9 @@ func Run(ctx context.Context, gc gRPCClient, data []byte) error {
 		return fehler.ExitCode(2, fmt.Errorf("datastore contains data, initial data were NOT set"))
 	}
 	fmt.Println("Initial data were set successfully.")
+	for _, w := range resp.Warnings {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", w)
+	}
 	return nil
 }
 
@@ -98,12 +103,16 @@ func Run(ctx context.Context, gc gRPCClient, data []byte) error {
 
 const datastoreNotEmptyMsg = "Datastore is not empty"
 
+const defaultPasswordWarning = "The superadmin still uses the default password. Change it immediately, e. g. with the set-password command."
+
 type action interface {
 	Single(ctx context.Context, name string, data json.RawMessage) (json.RawMessage, error)
 }
 
-// InitialData sets initial data in the datastore.
-func InitialData(ctx context.Context, in *proto.InitialDataRequest, runPath string, a action) (*proto.InitialDataResponse, error) {
+// InitialData sets initial data in the datastore. The response contains a
+// warning if the superadmin gets the default password and development mode is
+// off.
+func InitialData(ctx context.Context, in *proto.InitialDataRequest, runPath string, development bool, a action) (*proto.InitialDataResponse, error) {
 	initialData := in.Data
 	if initialData == nil {
 		// The backend expects at least an empty object.
@@ -138,7 +147,28 @@ func InitialData(ctx context.Context, in *proto.InitialDataRequest, runPath stri
 		return nil, fmt.Errorf("setting superadmin password: %w", err)
 	}
 
-	return &proto.InitialDataResponse{Initialized: true}, nil
+	resp := &proto.InitialDataResponse{Initialized: true}
+	if !development {
+		isDefault, err := isDefaultPassword(p)
+		if err != nil {
+			return nil, fmt.Errorf("checking superadmin password: %w", err)
+		}
+		if isDefault {
+			resp.Warnings = append(resp.Warnings, defaultPasswordWarning)
+		}
+	}
+	return resp, nil
+}
+
+// isDefaultPassword reports whether the given superadmin secret file contains
+// the default password. Trailing line breaks are ignored like in the setup
+// command.
+func isDefaultPassword(superadminSecretFile string) (bool, error) {
+	sapw, err := os.ReadFile(superadminSecretFile)
+	if err != nil {
+		return false, fmt.Errorf("reading file %q: %w", superadminSecretFile, err)
+	}
+	return string(bytes.TrimRight(sapw, "\r\n")) == setup.DefaultSuperadminPassword, nil
 }
 
 // SetSuperadminPassword sets the first password for the superadmin according to respective secret.
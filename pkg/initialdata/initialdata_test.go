@@ -114,7 +114,7 @@ func TestInitialDataServerAll(t *testing.T) {
 
 	// Run tests
 	t.Run("running the first time", func(t *testing.T) {
-		resp, err := initialdata.InitialData(ctx, in, testDir, ma)
+		resp, err := initialdata.InitialData(ctx, in, testDir, false, ma)
 		if err != nil {
 			t.Fatalf("running InitialData() failed: %v", err)
 		}
@@ -128,5 +128,59 @@ func TestInitialDataServerAll(t *testing.T) {
 		if !bytes.Equal(expected, got) {
 			t.Fatalf("wrong superadmin password, expected %q, got %q", expected, got)
 		}
+		if len(resp.Warnings) != 0 {
+			t.Fatalf("running InitialData() with custom password should not warn, got %v", resp.Warnings)
+		}
+	})
+}
+
+func TestInitialDataServerDefaultPassword(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-run-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	secDir := path.Join(testDir, setup.SecretsDirName)
+	if err := os.Mkdir(secDir, os.ModePerm); err != nil {
+		t.Fatalf("generating temporary subdirectory failed: %v", err)
+	}
+	if err := os.WriteFile(path.Join(secDir, setup.SuperadminFileName), []byte(setup.DefaultSuperadminPassword), 0600); err != nil {
+		t.Fatalf("creating temporary file for superadmin password: %v", err)
+	}
+
+	t.Run("running with default password", func(t *testing.T) {
+		resp, err := initialdata.InitialData(ctx, &proto.InitialDataRequest{}, testDir, false, newMockAction())
+		if err != nil {
+			t.Fatalf("running InitialData() failed: %v", err)
+		}
+		if len(resp.Warnings) != 1 {
+			t.Fatalf("running InitialData() with default password should return one warning, got %v", resp.Warnings)
+		}
+	})
+
+	t.Run("running with default password in development mode", func(t *testing.T) {
+		resp, err := initialdata.InitialData(ctx, &proto.InitialDataRequest{}, testDir, true, newMockAction())
+		if err != nil {
+			t.Fatalf("running InitialData() failed: %v", err)
+		}
+		if len(resp.Warnings) != 0 {
+			t.Fatalf("running InitialData() in development mode should not warn, got %v", resp.Warnings)
+		}
+	})
+
+	t.Run("running with default password with trailing newline", func(t *testing.T) {
+		if err := os.WriteFile(path.Join(secDir, setup.SuperadminFileName), []byte(setup.DefaultSuperadminPassword+"\n"), 0600); err != nil {
+			t.Fatalf("writing superadmin password file: %v", err)
+		}
+		resp, err := initialdata.InitialData(ctx, &proto.InitialDataRequest{}, testDir, false, newMockAction())
+		if err != nil {
+			t.Fatalf("running InitialData() failed: %v", err)
+		}
+		if len(resp.Warnings) != 1 {
+			t.Fatalf("running InitialData() with default password and trailing newline should return one warning, got %v", resp.Warnings)
+		}
 	})
 }
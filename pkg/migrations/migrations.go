@@ -120,7 +120,7 @@ func setupMigrationCmd(cmd *cobra.Command, withInterval bool) *cobra.Command {
 		dialCtx, cancel := context.WithTimeout(ctx, *cp.Timeout)
 		defer cancel()
 
-		cl, close, err := connection.Dial(dialCtx, *cp.Addr, *cp.PasswordFile, !*cp.NoSSL)
+		cl, close, err := connection.Dial(dialCtx, *cp.Addr, *cp.PasswordFile, cp.TLSOptions())
 		if err != nil {
 			return fmt.Errorf("connecting to gRPC server: %w", err)
 		}
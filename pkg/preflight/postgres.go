@@ -0,0 +1,68 @@
+package preflight
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+
+	"github.com/jackc/pgconn"
+)
+
+// PostgresLogin contains the options for a login to a PostgreSQL server.
+type PostgresLogin struct {
+	Addr     string
+	User     string
+	Database string
+	Password string
+
+	// SSLMode is the libpq sslmode. An empty value means "prefer".
+	SSLMode string
+
+	// CA contains PEM encoded certificates used to verify the server for the
+	// SSL modes verify-ca and verify-full.
+	CA []byte
+}
+
+// Login connects to the server and authenticates with the given credentials.
+// It returns nil if the server accepts them. No query is sent.
+func (l PostgresLogin) Login(ctx context.Context) error {
+	pgConfig, err := l.config()
+	if err != nil {
+		return err
+	}
+	conn, err := pgconn.ConnectConfig(ctx, pgConfig)
+	if err != nil {
+		return err
+	}
+	conn.Close(ctx) // Errors do not matter anymore.
+	return nil
+}
+
+// config returns the pgconn configuration for the login. The CA is added to
+// the TLS configurations because pgconn only reads it from a file.
+func (l PostgresLogin) config() (*pgconn.Config, error) {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(l.User, l.Password),
+		Host:   l.Addr,
+		Path:   "/" + l.Database,
+	}
+	if l.SSLMode != "" {
+		u.RawQuery = url.Values{"sslmode": {l.SSLMode}}.Encode()
+	}
+	pgConfig, err := pgconn.ParseConfig(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("parsing connection options: %w", err)
+	}
+
+	if l.SSLMode != "verify-ca" && l.SSLMode != "verify-full" {
+		return pgConfig, nil
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(l.CA) {
+		return nil, fmt.Errorf("sslmode %s requires a CA certificate", l.SSLMode)
+	}
+	pgConfig.TLSConfig.RootCAs = roots
+	return pgConfig, nil
+}
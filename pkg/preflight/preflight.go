@@ -0,0 +1,313 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// PreflightHelp contains the short help text for the command.
+	PreflightHelp = "Checks the environment before the containers are started"
+
+	// PreflightHelpExtra contains the long help text for the command without
+	// the headline.
+	PreflightHelpExtra = `This command reads the merged setup configuration and checks the things which
+otherwise only fail after the containers were started:
+
+  - the host port of the proxy service is free,
+  - there is enough free disk space for the db-data directory,
+  - the container registries are reachable,
+  - the external database, Redis and SMTP servers are reachable,
+  - the external database accepts the credentials from the secrets directory.
+
+The given directory is the one used for the setup command. The command prints
+a table with the results and fails if at least one check fails.`
+
+	defaultTimeout      = 5 * time.Second
+	defaultMinDiskSpace = 5 // GiB
+
+	registryPort = "443"
+	smtpPort     = "25"
+)
+
+// Results of the single checks.
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// Cmd returns the subcommand.
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "preflight directory",
+		Short: PreflightHelp,
+		Long:  PreflightHelp + "\n\n" + PreflightHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	configFileNames := config.FlagConfig(cmd)
+	timeout := cmd.Flags().Duration("timeout", defaultTimeout, "timeout for every network check")
+	minDiskSpace := cmd.Flags().Uint64("min-disk-space", defaultMinDiskSpace, "minimal free disk space for the db-data directory in GiB")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		configFiles, err := config.ReadConfigFiles(*configFileNames)
+		if err != nil {
+			return err
+		}
+		cfg, err := config.NewYmlConfig(configFiles)
+		if err != nil {
+			return fmt.Errorf("creating new YML config object: %w", err)
+		}
+
+		opts := Options{
+			Timeout:      *timeout,
+			MinDiskSpace: *minDiskSpace << 30,
+		}
+		results := Run(cmd.Context(), args[0], cfg, opts)
+		PrintResults(cmd.OutOrStdout(), results)
+
+		var failed int
+		for _, r := range results {
+			if r.Status == StatusFail {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(results))
+		}
+		return nil
+	}
+	return cmd
+}
+
+// Options contains the options for Run.
+type Options struct {
+	// Timeout is used for every network check.
+	Timeout time.Duration
+
+	// MinDiskSpace is the minimal free disk space for the db-data directory in
+	// bytes.
+	MinDiskSpace uint64
+}
+
+// Result is the result of a single check.
+type Result struct {
+	Check  string
+	Target string
+	Status string
+	Detail string
+}
+
+// Run runs all checks for the given directory and config.
+func Run(ctx context.Context, dir string, cfg *config.YmlConfig, opts Options) []Result {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var results []Result
+	results = append(results, checkPortFree(cfg))
+	results = append(results, checkDiskSpace(dir, cfg, opts.MinDiskSpace))
+	for _, host := range registryHosts(cfg) {
+		results = append(results, checkTCP(ctx, "registry", host, opts.Timeout))
+	}
+
+	if cfg.UsesExternalDatabase() {
+		db := cfg.ExternalDatabase
+		addr := net.JoinHostPort(db.Host, db.Port)
+		tcp := checkTCP(ctx, "database", addr, opts.Timeout)
+		results = append(results, tcp)
+		if tcp.Status == StatusPass {
+			results = append(results, checkDatabaseLogin(ctx, dir, cfg, opts.Timeout))
+		} else {
+			results = append(results, Result{Check: "database login", Target: addr, Status: StatusSkip, Detail: "server not reachable"})
+		}
+	}
+
+	if cfg.UsesExternalRedis() {
+		addr := net.JoinHostPort(cfg.ExternalRedis.Host, cfg.ExternalRedis.Port)
+		results = append(results, checkTCP(ctx, "redis", addr, opts.Timeout))
+	}
+
+	host, port := cfg.DefaultEnvironment["EMAIL_HOST"], cfg.DefaultEnvironment["EMAIL_PORT"]
+	if cfg.UsesEmail() {
+		host, port = cfg.Email.Host, cfg.Email.Port
+	}
+	if host != "" {
+		if port == "" {
+			port = smtpPort
+		}
+		results = append(results, checkTCP(ctx, "smtp", net.JoinHostPort(host, port), opts.Timeout))
+	}
+
+	return results
+}
+
+// PrintResults writes the results as table to w.
+func PrintResults(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tTARGET\tRESULT\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Check, r.Target, strings.ToUpper(r.Status), r.Detail)
+	}
+	tw.Flush()
+}
+
+func checkPortFree(cfg *config.YmlConfig) Result {
+	addr := net.JoinHostPort(cfg.Host, cfg.Port)
+	r := Result{Check: "port", Target: addr}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		r.Status = StatusFail
+		r.Detail = fmt.Sprintf("port is not free: %v", err)
+		return r
+	}
+	l.Close()
+	r.Status = StatusPass
+	r.Detail = "port is free"
+	return r
+}
+
+func checkDiskSpace(dir string, cfg *config.YmlConfig, minFree uint64) Result {
+	p := path.Join(dir, "db-data")
+	r := Result{Check: "disk space", Target: p}
+	if *cfg.DisablePostgres || cfg.Target == config.TargetKubernetes {
+		r.Status = StatusSkip
+		r.Detail = "no local database"
+		return r
+	}
+
+	// The directory is created by the setup command, so use the nearest
+	// existing parent directory before.
+	existing := p
+	for {
+		_, err := os.Stat(existing)
+		if err == nil {
+			break
+		}
+		parent := path.Dir(existing)
+		if !errors.Is(err, fs.ErrNotExist) || parent == existing {
+			r.Status = StatusFail
+			r.Detail = fmt.Sprintf("checking directory: %v", err)
+			return r
+		}
+		existing = parent
+	}
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(existing, &st); err != nil {
+		r.Status = StatusFail
+		r.Detail = fmt.Sprintf("getting file system statistics: %v", err)
+		return r
+	}
+	free := uint64(st.Bavail) * uint64(st.Bsize)
+	r.Detail = fmt.Sprintf("%.1f GiB free, %.1f GiB required", float64(free)/(1<<30), float64(minFree)/(1<<30))
+	r.Status = StatusPass
+	if free < minFree {
+		r.Status = StatusFail
+	}
+	return r
+}
+
+func checkTCP(ctx context.Context, check, addr string, timeout time.Duration) Result {
+	r := Result{Check: check, Target: addr}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		r.Status = StatusFail
+		r.Detail = err.Error()
+		return r
+	}
+	conn.Close()
+	r.Status = StatusPass
+	r.Detail = "reachable"
+	return r
+}
+
+func checkDatabaseLogin(ctx context.Context, dir string, cfg *config.YmlConfig, timeout time.Duration) Result {
+	db := cfg.ExternalDatabase
+	login := PostgresLogin{
+		Addr:     net.JoinHostPort(db.Host, db.Port),
+		User:     db.User,
+		Database: db.Name,
+		SSLMode:  db.SSLMode,
+	}
+	r := Result{Check: "database login", Target: fmt.Sprintf("%s@%s/%s", db.User, login.Addr, db.Name)}
+
+	secrDir := path.Join(dir, setup.SecretsDirName)
+	password, err := shared.ReadSecretFile(path.Join(secrDir, "postgres_password"))
+	if err != nil {
+		r.Status = StatusFail
+		r.Detail = fmt.Sprintf("reading password (run the setup command first): %v", err)
+		return r
+	}
+	login.Password = strings.TrimSpace(string(password))
+	if db.CAFile != "" {
+		login.CA, err = shared.ReadSecretFile(path.Join(secrDir, config.PostgresCAFileName))
+		if err != nil {
+			r.Status = StatusFail
+			r.Detail = fmt.Sprintf("reading CA (run the setup command first): %v", err)
+			return r
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := login.Login(ctx); err != nil {
+		r.Status = StatusFail
+		r.Detail = err.Error()
+		return r
+	}
+	r.Status = StatusPass
+	r.Detail = "login successful"
+	return r
+}
+
+// registryHosts returns the addresses of all container registries used by the
+// enabled services.
+func registryHosts(cfg *config.YmlConfig) []string {
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		if cfg.HasService(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		registry := cfg.Services[name].ContainerRegistry
+		if registry == "" {
+			continue
+		}
+		host := strings.SplitN(registry, "/", 2)[0]
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, registryPort)
+		}
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,361 @@
+package preflight_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/preflight"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestPostgresLogin(t *testing.T) {
+	for _, method := range []string{"cleartext", "md5", "scram"} {
+		t.Run("login with "+method, func(t *testing.T) {
+			addr := fakePostgres(t, method, "openslides", "secret")
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			login := preflight.PostgresLogin{Addr: addr, User: "openslides", Database: "openslides", Password: "secret"}
+			if err := login.Login(ctx); err != nil {
+				t.Fatalf("login failed: %v", err)
+			}
+
+			login.Password = "wrong"
+			err := login.Login(ctx)
+			if err == nil || !strings.Contains(err.Error(), "password authentication failed") {
+				t.Fatalf("login with wrong password should fail with authentication error, got %v", err)
+			}
+		})
+	}
+
+	t.Run("sslmode require without SSL support", func(t *testing.T) {
+		addr := fakePostgres(t, "cleartext", "openslides", "secret")
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		login := preflight.PostgresLogin{Addr: addr, User: "openslides", Password: "secret", SSLMode: "require"}
+		if err := login.Login(ctx); err == nil || !strings.Contains(err.Error(), "refused TLS") {
+			t.Fatalf("expected SSL error, got %v", err)
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	dbAddr := fakePostgres(t, "md5", "os4", "db-password")
+	redisAddr := listen(t)
+	smtpAddr := listen(t)
+	registryAddr := listen(t)
+	busyAddr := listen(t)
+
+	passwordFile := path.Join(testDir, "db-password")
+	if err := os.WriteFile(passwordFile, []byte("db-password\n"), 0600); err != nil {
+		t.Fatalf("writing password file: %v", err)
+	}
+	dbHost, dbPort, _ := net.SplitHostPort(dbAddr)
+	redisHost, redisPort, _ := net.SplitHostPort(redisAddr)
+	smtpHost, smtpPort, _ := net.SplitHostPort(smtpAddr)
+	busyHost, busyPort, _ := net.SplitHostPort(busyAddr)
+	externalConfig := []byte(fmt.Sprintf(`---
+defaults:
+  containerRegistry: %s/openslides
+externalDatabase:
+  host: %s
+  port: %s
+  name: os4
+  user: os4
+  passwordFile: %s
+  sslMode: prefer
+externalRedis:
+  host: %s
+  port: %s
+defaultEnvironment:
+  EMAIL_HOST: %s
+  EMAIL_PORT: %s
+`, registryAddr, dbHost, dbPort, passwordFile, redisHost, redisPort, smtpHost, smtpPort))
+
+	dir := path.Join(testDir, "setup")
+	if err := setup.Setup(dir, false, nil, [][]byte{externalConfig}, nil); err != nil {
+		t.Fatalf("running Setup() failed with error: %v", err)
+	}
+	opts := preflight.Options{Timeout: time.Second}
+
+	t.Run("all checks pass with external services", func(t *testing.T) {
+		freePort := []byte(fmt.Sprintf("host: %s\nport: %s\n", "127.0.0.1", freePort(t)))
+		cfg, err := config.NewYmlConfig([][]byte{externalConfig, freePort})
+		if err != nil {
+			t.Fatalf("creating config: %v", err)
+		}
+		results := preflight.Run(context.Background(), dir, cfg, opts)
+		expected := map[string]string{
+			"port":           preflight.StatusPass,
+			"disk space":     preflight.StatusSkip,
+			"registry":       preflight.StatusPass,
+			"database":       preflight.StatusPass,
+			"database login": preflight.StatusPass,
+			"redis":          preflight.StatusPass,
+			"smtp":           preflight.StatusPass,
+		}
+		testResults(t, results, expected)
+
+		buf := new(bytes.Buffer)
+		preflight.PrintResults(buf, results)
+		if !strings.HasPrefix(buf.String(), "CHECK") || !strings.Contains(buf.String(), "login successful") {
+			t.Fatalf("wrong table, got\n%s", buf.String())
+		}
+	})
+
+	t.Run("failing checks", func(t *testing.T) {
+		// The proxy port is used and the database password is wrong.
+		if err := os.WriteFile(path.Join(dir, setup.SecretsDirName, "postgres_password"), []byte("wrong"), 0600); err != nil {
+			t.Fatalf("writing password: %v", err)
+		}
+		busyPort := []byte(fmt.Sprintf("host: %s\nport: %s\n", busyHost, busyPort))
+		cfg, err := config.NewYmlConfig([][]byte{externalConfig, busyPort, []byte("externalRedis:\n  port: 1\n")})
+		if err != nil {
+			t.Fatalf("creating config: %v", err)
+		}
+		results := preflight.Run(context.Background(), dir, cfg, opts)
+		testResults(t, results, map[string]string{
+			"port":           preflight.StatusFail,
+			"database":       preflight.StatusPass,
+			"database login": preflight.StatusFail,
+			"redis":          preflight.StatusFail,
+		})
+	})
+
+	t.Run("disk space for local database", func(t *testing.T) {
+		cfg, err := config.NewYmlConfig([][]byte{[]byte(fmt.Sprintf("defaults:\n  containerRegistry: %s\nport: %s\n", registryAddr, freePort(t)))})
+		if err != nil {
+			t.Fatalf("creating config: %v", err)
+		}
+		results := preflight.Run(context.Background(), path.Join(testDir, "not-yet-created"), cfg, preflight.Options{Timeout: time.Second})
+		testResults(t, results, map[string]string{"disk space": preflight.StatusPass})
+
+		opts := preflight.Options{Timeout: time.Second, MinDiskSpace: 1 << 62}
+		results = preflight.Run(context.Background(), testDir, cfg, opts)
+		testResults(t, results, map[string]string{"disk space": preflight.StatusFail})
+	})
+}
+
+func testResults(t testing.TB, results []preflight.Result, expected map[string]string) {
+	t.Helper()
+	got := make(map[string]string)
+	for _, r := range results {
+		got[r.Check] = r.Status
+	}
+	for check, status := range expected {
+		if got[check] != status {
+			t.Fatalf("wrong result for check %q, expected %q, got %q (all results: %v)", check, status, got[check], results)
+		}
+	}
+}
+
+// listen returns the address of a local listener which accepts and closes all
+// connections.
+func listen(t testing.TB) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func freePort(t testing.TB) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+// fakePostgres starts a server which speaks enough of the PostgreSQL wire
+// protocol to authenticate one user with the given method. It does not
+// support SSL.
+func fakePostgres(t testing.TB, method, user, password string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(2 * time.Second))
+				servePostgres(conn, method, user, password)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func servePostgres(conn net.Conn, method, user, password string) {
+	r := bufio.NewReader(conn)
+
+	var params map[string]string
+	for params == nil {
+		msg, err := readStartup(r)
+		if err != nil {
+			return
+		}
+		if binary.BigEndian.Uint32(msg[:4]) == 80877103 {
+			conn.Write([]byte("N")) // No SSL
+			continue
+		}
+		params = make(map[string]string)
+		fields := strings.Split(string(msg[4:]), "\x00")
+		for i := 0; i+1 < len(fields); i += 2 {
+			params[fields[i]] = fields[i+1]
+		}
+	}
+
+	ok := false
+	switch method {
+	case "cleartext":
+		writeAuth(conn, 3, nil)
+		body := readPassword(r)
+		ok = params["user"] == user && string(body) == password+"\x00"
+
+	case "md5":
+		salt := []byte{1, 2, 3, 4}
+		writeAuth(conn, 5, salt)
+		inner := md5.Sum([]byte(password + user))
+		outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+		body := readPassword(r)
+		ok = string(body) == "md5"+hex.EncodeToString(outer[:])+"\x00"
+
+	case "scram":
+		ok = serveScram(conn, r, password)
+	}
+
+	if !ok {
+		writeMsg(conn, 'E', []byte("SFATAL\x00Mpassword authentication failed for user \""+params["user"]+"\"\x00\x00"))
+		return
+	}
+	writeAuth(conn, 0, nil)
+	writeMsg(conn, 'Z', []byte("I")) // ReadyForQuery
+	readPassword(r)                  // Terminate
+}
+
+func serveScram(conn net.Conn, r *bufio.Reader, password string) bool {
+	writeAuth(conn, 10, []byte("SCRAM-SHA-256\x00\x00"))
+	initial := readPassword(r)
+	i := bytes.IndexByte(initial, 0)
+	if i < 0 || len(initial) < i+5 {
+		return false
+	}
+	clientFirst := string(initial[i+5:])
+	clientFirstBare := strings.TrimPrefix(clientFirst, "n,,")
+	clientNonce := strings.TrimPrefix(clientFirstBare[strings.Index(clientFirstBare, "r="):], "r=")
+
+	salt := []byte("fake-salt")
+	serverFirst := fmt.Sprintf("r=%sserver,s=%s,i=4096", clientNonce, base64.StdEncoding.EncodeToString(salt))
+	writeAuth(conn, 11, []byte(serverFirst))
+
+	clientFinal := string(readPassword(r))
+	j := strings.LastIndex(clientFinal, ",p=")
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[j+3:])
+	if err != nil {
+		return false
+	}
+	authMessage := clientFirstBare + "," + serverFirst + "," + clientFinal[:j]
+
+	saltedPassword := pbkdf2.Key([]byte(password), salt, 4096, sha256.Size, sha256.New)
+	mac := hmac.New(sha256.New, saltedPassword)
+	mac.Write([]byte("Client Key"))
+	storedKey := sha256.Sum256(mac.Sum(nil))
+	mac = hmac.New(sha256.New, storedKey[:])
+	mac.Write([]byte(authMessage))
+	clientSignature := mac.Sum(nil)
+	clientKey := make([]byte, len(proof))
+	for k := range proof {
+		if k < len(clientSignature) {
+			clientKey[k] = proof[k] ^ clientSignature[k]
+		}
+	}
+	if got := sha256.Sum256(clientKey); !hmac.Equal(got[:], storedKey[:]) {
+		return false
+	}
+
+	mac = hmac.New(sha256.New, saltedPassword)
+	mac.Write([]byte("Server Key"))
+	mac = hmac.New(sha256.New, mac.Sum(nil))
+	mac.Write([]byte(authMessage))
+	writeAuth(conn, 12, []byte("v="+base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+	return true
+}
+
+func readStartup(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(header)-4)
+	_, err := io.ReadFull(r, msg)
+	return msg, err
+}
+
+func readPassword(r io.Reader) []byte {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+	io.ReadFull(r, body)
+	return body
+}
+
+func writeAuth(w io.Writer, code uint32, data []byte) {
+	body := make([]byte, 4)
+	binary.BigEndian.PutUint32(body, code)
+	writeMsg(w, 'R', append(body, data...))
+}
+
+func writeMsg(w io.Writer, typ byte, body []byte) {
+	msg := make([]byte, 5)
+	msg[0] = typ
+	binary.BigEndian.PutUint32(msg[1:], uint32(4+len(body)))
+	w.Write(append(msg, body...))
+}
@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// EncryptHelp contains the short help text for the command.
+	EncryptHelp = "Encrypts the secrets in the secrets directory"
+
+	// EncryptHelpExtra contains the long help text for the command without the
+	// headline.
+	EncryptHelpExtra = `This command encrypts all plaintext files in the secrets directory in the
+given directory in the age format. Use age public keys (age1...) or a
+passphrase given in the environment variable OPENSLIDES_SECRETS_PASSPHRASE. The
+encrypted files get the suffix .age and the plaintext files are removed.`
+
+	// DecryptHelp contains the short help text for the command.
+	DecryptHelp = "Decrypts the secrets in the secrets directory"
+
+	// DecryptHelpExtra contains the long help text for the command without the
+	// headline.
+	DecryptHelpExtra = `This command writes the plaintext files for all encrypted files in the secrets
+directory in the given directory, e. g. at deploy time before the containers
+are started. The key is an age identity file given with the identity flag or
+the environment variable OPENSLIDES_SECRETS_IDENTITY_FILE or the passphrase in
+the environment variable OPENSLIDES_SECRETS_PASSPHRASE. The encrypted files are
+kept.`
+)
+
+func encryptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "encrypt directory",
+		Short: EncryptHelp,
+		Long:  EncryptHelp + "\n\n" + EncryptHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	recipients := setup.FlagEncryption(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		rcpts, err := recipients()
+		if err != nil {
+			return fmt.Errorf("parsing encryption flags: %w", err)
+		}
+		if rcpts == nil {
+			return fmt.Errorf("at least one public key or a passphrase must be given")
+		}
+
+		names, err := setup.EncryptSecrets(path.Join(args[0], setup.SecretsDirName), rcpts)
+		if err != nil {
+			return fmt.Errorf("encrypting secrets: %w", err)
+		}
+		for _, name := range names {
+			fmt.Fprintf(cmd.OutOrStdout(), "Secret %q written.\n", name)
+		}
+		return nil
+	}
+	return cmd
+}
+
+func decryptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "decrypt directory",
+		Short: DecryptHelp,
+		Long:  DecryptHelp + "\n\n" + DecryptHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	identityFile := cmd.Flags().StringP("identity", "i", "", fmt.Sprintf("age identity file, defaults to the value of the environment variable %s", shared.IdentityFileEnv))
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if *identityFile == "" {
+			*identityFile = os.Getenv(shared.IdentityFileEnv)
+		}
+		identities, err := shared.Identities(*identityFile, os.Getenv(shared.PassphraseEnv))
+		if err != nil {
+			return fmt.Errorf("reading keys: %w", err)
+		}
+
+		names, err := setup.DecryptSecrets(path.Join(args[0], setup.SecretsDirName), identities)
+		if err != nil {
+			return fmt.Errorf("decrypting secrets: %w", err)
+		}
+		for _, name := range names {
+			fmt.Fprintf(cmd.OutOrStdout(), "Secret %q written.\n", name)
+		}
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,91 @@
+package secrets_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	if err := setup.Setup(testDir, false, nil, nil, nil); err != nil {
+		t.Fatalf("running setup.Setup() failed with error: %v", err)
+	}
+	secDir := path.Join(testDir, "secrets")
+	oldPassword, err := os.ReadFile(path.Join(secDir, "postgres_password"))
+	if err != nil {
+		t.Fatalf("reading secret: %v", err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generating identity: %v", err)
+	}
+	identityFile := path.Join(testDir, "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("writing identity file: %v", err)
+	}
+
+	t.Run("executing secrets encrypt", func(t *testing.T) {
+		cmd := secrets.Cmd()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetArgs([]string{"encrypt", testDir, "--encrypt-to", identity.Recipient().String()})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing secrets encrypt subcommand: %v", err)
+		}
+		if _, err := os.Stat(path.Join(secDir, "postgres_password")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("plaintext secret file exists, expected non existance")
+		}
+	})
+
+	t.Run("rotating encrypted secret without encryption flags", func(t *testing.T) {
+		if _, err := secrets.Rotate(testDir, []string{"postgres_password"}, time.Now(), nil); err == nil {
+			t.Fatalf("rotating encrypted secret without recipients should fail")
+		}
+	})
+
+	t.Run("rotating encrypted secret", func(t *testing.T) {
+		rotated, err := secrets.Rotate(testDir, []string{"postgres_password"}, time.Now(), []age.Recipient{identity.Recipient()})
+		if err != nil {
+			t.Fatalf("rotating secret: %v", err)
+		}
+		if !strings.HasSuffix(rotated[0].Backup, ".age") {
+			t.Fatalf("got backup %q, expected encrypted backup", rotated[0].Backup)
+		}
+		if _, err := os.Stat(path.Join(secDir, "postgres_password")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("plaintext secret file exists, expected non existance")
+		}
+	})
+
+	t.Run("executing secrets decrypt", func(t *testing.T) {
+		cmd := secrets.Cmd()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetArgs([]string{"decrypt", testDir, "--identity", identityFile})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing secrets decrypt subcommand: %v", err)
+		}
+		password, err := os.ReadFile(path.Join(secDir, "postgres_password"))
+		if err != nil {
+			t.Fatalf("reading decrypted secret: %v", err)
+		}
+		if len(password) == 0 || bytes.Equal(password, oldPassword) {
+			t.Fatalf("got password %q, expected the new rotated password", password)
+		}
+		if _, err := os.Stat(path.Join(secDir, "postgres_password.age")); err != nil {
+			t.Fatalf("encrypted secret file should be kept: %v", err)
+		}
+	})
+}
@@ -0,0 +1,264 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// RotateHelp contains the short help text for the command.
+	RotateHelp = "Replaces secrets in the secrets directory with new random values"
+
+	// RotateHelpExtra contains the long help text for the command without the
+	// headline.
+	RotateHelpExtra = `This command replaces the given secrets in the secrets directory in the given
+directory with new random values. Without any names all random secrets are
+rotated. The old values are kept in the subdirectory "backups" of the secrets
+directory. The command prints which services have to be restarted for each
+rotated secret. Encrypted secrets stay encrypted, so the encryption flags are
+required for them. The flags can also be used to encrypt plaintext secrets
+during rotation.
+
+With the target "kubernetes" the manifests contain the secrets, so render them
+again with the config command and apply them. With the target "swarm" push the
+secrets again with the push-swarm command and the force flag.
+
+Rotating postgres_password does not change the password of the database role.
+Use the sql flag to get the SQL statement for this and run it before you restart
+the services.`
+
+	// BackupsDirName is the name of the directory for old secrets inside the
+	// secrets directory.
+	BackupsDirName = "backups"
+
+	backupTimeFormat = "20060102T150405Z"
+
+	postgresPasswordFileName = "postgres_password"
+)
+
+func rotateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "rotate directory [name...]",
+		Short:     RotateHelp,
+		Long:      RotateHelp + "\n\n" + RotateHelpExtra,
+		Args:      cobra.MinimumNArgs(1),
+		ValidArgs: setup.RandomSecretFileNames(),
+	}
+
+	sql := cmd.Flags().Bool("sql", false, "print the SQL statement to change the password of the database role if postgres_password is rotated")
+	dbUser := cmd.Flags().String("db-user", "openslides", "name of the database role used in the SQL statement")
+	recipients := setup.FlagEncryption(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		dir := args[0]
+
+		rcpts, err := recipients()
+		if err != nil {
+			return fmt.Errorf("parsing encryption flags: %w", err)
+		}
+
+		rotated, err := Rotate(dir, args[1:], time.Now(), rcpts)
+		if err != nil {
+			return fmt.Errorf("rotating secrets: %w", err)
+		}
+
+		w := cmd.OutOrStdout()
+		for _, r := range rotated {
+			fmt.Fprintf(w, "Secret %q rotated, old value saved to %q.\n", r.Name, r.Backup)
+			if len(r.Services) > 0 {
+				fmt.Fprintf(w, "  Restart services: %s\n", strings.Join(r.Services, ", "))
+			}
+			if r.Name == postgresPasswordFileName && *sql {
+				fmt.Fprintln(w, "  Run this SQL statement before restarting the services:")
+				fmt.Fprintf(w, "  %s\n", AlterRoleSQL(*dbUser, string(r.Value)))
+			}
+		}
+		if len(rotated) > 0 {
+			fmt.Fprintln(w, "The new values are only used by the services after further steps:")
+			fmt.Fprintln(w, "  Kubernetes: render the manifests again with the config command and apply them.")
+			fmt.Fprintln(w, "  Docker Swarm: push the secrets again with the secrets push-swarm command and the force flag.")
+		}
+		return nil
+	}
+	return cmd
+}
+
+// RotatedSecret describes one secret replaced by Rotate.
+type RotatedSecret struct {
+	Name     string
+	Backup   string   // Path of the file with the old value.
+	Services []string // Services which have to be restarted.
+	Value    []byte   // The new value.
+}
+
+// Rotate replaces the secrets with the given names in the secrets directory
+// of the given directory with new random values. If no names are given, all
+// random secrets are rotated. The old values are copied to the backups
+// directory with the given time in their filenames. If recipients are given,
+// the new values are encrypted for them. Encrypted secrets can only be rotated
+// with recipients.
+func Rotate(dir string, names []string, now time.Time, recipients []age.Recipient) ([]RotatedSecret, error) {
+	if len(names) == 0 {
+		names = setup.RandomSecretFileNames()
+	}
+	names, err := checkRotateNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	secrDir := path.Join(dir, setup.SecretsDirName)
+	backupDir := path.Join(secrDir, BackupsDirName)
+
+	// All secrets are read and checked before anything is written, so that an
+	// error does not leave the directory half-rotated.
+	olds := make([][]byte, len(names))
+	backups := make([]string, len(names))
+	for i, name := range names {
+		// The old value is saved as it is, so encrypted secrets stay encrypted
+		// in the backups directory.
+		filename := name
+		old, err := os.ReadFile(path.Join(secrDir, filename))
+		if errors.Is(err, fs.ErrNotExist) {
+			filename = name + shared.EncryptedSuffix
+			old, err = os.ReadFile(path.Join(secrDir, filename))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading secret %q (secrets are created by the setup command): %w", name, err)
+		}
+		encrypted := shared.IsEncrypted(old)
+		if encrypted && recipients == nil {
+			return nil, fmt.Errorf("secret %q is encrypted, use the encryption flags to encrypt the new value", name)
+		}
+
+		backup := path.Join(backupDir, name+"."+now.UTC().Format(backupTimeFormat))
+		if encrypted {
+			backup += shared.EncryptedSuffix
+		}
+		if _, err := os.Stat(backup); err == nil {
+			return nil, fmt.Errorf("backup file %q already exists, try again later", backup)
+		}
+		olds[i] = old
+		backups[i] = backup
+	}
+
+	if err := os.MkdirAll(backupDir, 0770); err != nil {
+		return nil, fmt.Errorf("creating backups directory at %q: %w", backupDir, err)
+	}
+
+	var rotated []RotatedSecret
+	for i, name := range names {
+		if err := writeBackup(backups[i], olds[i]); err != nil {
+			return nil, fmt.Errorf("saving old value of secret %q: %w", name, err)
+		}
+
+		secret, err := setup.RandomSecret()
+		if err != nil {
+			return nil, fmt.Errorf("creating random secret %q: %w", name, err)
+		}
+		if err := writeSecret(secrDir, name, secret, recipients); err != nil {
+			return nil, fmt.Errorf("writing secret %q: %w", name, err)
+		}
+
+		rotated = append(rotated, RotatedSecret{
+			Name:     name,
+			Backup:   backups[i],
+			Services: servicesToRestart(name),
+			Value:    secret,
+		})
+	}
+	return rotated, nil
+}
+
+// checkRotateNames checks that all names are random secrets and removes
+// duplicates.
+func checkRotateNames(names []string) ([]string, error) {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !isRandomSecret(name) {
+			return nil, fmt.Errorf("secret %q can not be rotated, use one of %s", name, strings.Join(setup.RandomSecretFileNames(), ", "))
+		}
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique, nil
+}
+
+// writeSecret writes the secret to the secrets directory. If recipients are
+// given, the secret is encrypted and the plaintext file is removed.
+func writeSecret(secrDir, name string, secret []byte, recipients []age.Recipient) error {
+	if recipients == nil {
+		return shared.CreateSecretFile(secrDir, true, name, secret)
+	}
+
+	encrypted, err := shared.Encrypt(secret, recipients)
+	if err != nil {
+		return fmt.Errorf("encrypting secret: %w", err)
+	}
+	if err := shared.CreateSecretFile(secrDir, true, name+shared.EncryptedSuffix, encrypted); err != nil {
+		return err
+	}
+	if err := os.Remove(path.Join(secrDir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing plaintext secret file: %w", err)
+	}
+	return nil
+}
+
+func isRandomSecret(name string) bool {
+	for _, n := range setup.RandomSecretFileNames() {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBackup writes the backup file. It fails if the file already exists so
+// that an older backup is never overwritten.
+func writeBackup(p string, content []byte) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("backup file %q already exists, try again later", p)
+		}
+		return fmt.Errorf("creating backup file: %w", err)
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return fmt.Errorf("writing backup file: %w", err)
+	}
+	return f.Close()
+}
+
+// servicesToRestart returns the services which read the given secret. The
+// postgres service only reads its password on the first start, so it does not
+// need a restart.
+func servicesToRestart(name string) []string {
+	var result []string
+	for _, s := range config.ServicesUsingSecret(name) {
+		if name == postgresPasswordFileName && s == "postgres" {
+			continue
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// AlterRoleSQL returns the SQL statement to set the password of the given
+// database role.
+func AlterRoleSQL(role, password string) string {
+	return fmt.Sprintf(`ALTER ROLE "%s" WITH PASSWORD '%s';`, strings.ReplaceAll(role, `"`, `""`), strings.ReplaceAll(password, "'", "''"))
+}
@@ -0,0 +1,163 @@
+package secrets_test
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+)
+
+func TestRotate(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	if err := setup.Setup(testDir, false, nil, nil, nil); err != nil {
+		t.Fatalf("running setup.Setup() failed with error: %v", err)
+	}
+	secDir := path.Join(testDir, "secrets")
+	oldTokenKey, err := os.ReadFile(path.Join(secDir, "auth_token_key"))
+	if err != nil {
+		t.Fatalf("reading secret: %v", err)
+	}
+	oldCookieKey, err := os.ReadFile(path.Join(secDir, "auth_cookie_key"))
+	if err != nil {
+		t.Fatalf("reading secret: %v", err)
+	}
+	now := time.Date(2022, 3, 24, 13, 14, 15, 0, time.UTC)
+
+	t.Run("rotating a single secret", func(t *testing.T) {
+		rotated, err := secrets.Rotate(testDir, []string{"auth_token_key"}, now, nil)
+		if err != nil {
+			t.Fatalf("rotating secret: %v", err)
+		}
+		if len(rotated) != 1 {
+			t.Fatalf("got %d rotated secrets, expected 1", len(rotated))
+		}
+		expBackup := path.Join(secDir, "backups", "auth_token_key.20220324T131415Z")
+		if rotated[0].Backup != expBackup {
+			t.Fatalf("got backup %q, expected %q", rotated[0].Backup, expBackup)
+		}
+		if !strings.Contains(strings.Join(rotated[0].Services, ","), "autoupdate") {
+			t.Fatalf("got services %v, expected autoupdate", rotated[0].Services)
+		}
+
+		backup, err := os.ReadFile(expBackup)
+		if err != nil {
+			t.Fatalf("reading backup: %v", err)
+		}
+		if !bytes.Equal(backup, oldTokenKey) {
+			t.Fatalf("got backup %q, expected old value %q", backup, oldTokenKey)
+		}
+		newTokenKey, err := os.ReadFile(path.Join(secDir, "auth_token_key"))
+		if err != nil {
+			t.Fatalf("reading secret: %v", err)
+		}
+		if bytes.Equal(newTokenKey, oldTokenKey) {
+			t.Fatalf("secret auth_token_key was not changed")
+		}
+		if len(newTokenKey) != 44 {
+			t.Fatalf("wrong length of new secret auth_token_key, got %d, expected 44", len(newTokenKey))
+		}
+		cookieKey, err := os.ReadFile(path.Join(secDir, "auth_cookie_key"))
+		if err != nil {
+			t.Fatalf("reading secret: %v", err)
+		}
+		if !bytes.Equal(cookieKey, oldCookieKey) {
+			t.Fatalf("secret auth_cookie_key was changed")
+		}
+	})
+
+	t.Run("rotating the same secret again at the same time", func(t *testing.T) {
+		if _, err := secrets.Rotate(testDir, []string{"auth_token_key"}, now, nil); err == nil {
+			t.Fatalf("rotating secret should fail if backup exists")
+		}
+	})
+
+	t.Run("rotating secrets with an existing backup of one of them", func(t *testing.T) {
+		if _, err := secrets.Rotate(testDir, []string{"auth_cookie_key", "auth_token_key"}, now, nil); err == nil {
+			t.Fatalf("rotating secrets should fail if a backup exists")
+		}
+		cookieKey, err := os.ReadFile(path.Join(secDir, "auth_cookie_key"))
+		if err != nil {
+			t.Fatalf("reading secret: %v", err)
+		}
+		if !bytes.Equal(cookieKey, oldCookieKey) {
+			t.Fatalf("secret auth_cookie_key was changed")
+		}
+		if _, err := os.Stat(path.Join(secDir, "backups", "auth_cookie_key.20220324T131415Z")); err == nil {
+			t.Fatalf("backup of auth_cookie_key was written")
+		}
+	})
+
+	t.Run("rotating the same secret twice in one call", func(t *testing.T) {
+		rotated, err := secrets.Rotate(testDir, []string{"auth_cookie_key", "auth_cookie_key"}, now, nil)
+		if err != nil {
+			t.Fatalf("rotating secret: %v", err)
+		}
+		if len(rotated) != 1 {
+			t.Fatalf("got %d rotated secrets, expected 1", len(rotated))
+		}
+	})
+
+	t.Run("rotating all secrets", func(t *testing.T) {
+		rotated, err := secrets.Rotate(testDir, nil, now.Add(time.Second), nil)
+		if err != nil {
+			t.Fatalf("rotating secrets: %v", err)
+		}
+		if len(rotated) != 5 {
+			t.Fatalf("got %d rotated secrets, expected 5", len(rotated))
+		}
+		for _, r := range rotated {
+			if r.Name == "postgres_password" && strings.Contains(strings.Join(r.Services, ","), "postgres,") {
+				t.Fatalf("got services %v for postgres_password, expected no postgres service", r.Services)
+			}
+		}
+	})
+
+	t.Run("rotating unknown secret", func(t *testing.T) {
+		if _, err := secrets.Rotate(testDir, []string{"superadmin"}, now, nil); err == nil {
+			t.Fatalf("rotating secret superadmin should fail")
+		}
+	})
+
+	t.Run("executing secrets rotate with sql flag", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		cmd := secrets.Cmd()
+		cmd.SetOut(buf)
+		cmd.SetArgs([]string{"rotate", testDir, "postgres_password", "--sql"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing secrets rotate subcommand: %v", err)
+		}
+		password, err := os.ReadFile(path.Join(secDir, "postgres_password"))
+		if err != nil {
+			t.Fatalf("reading secret: %v", err)
+		}
+		for _, exp := range []string{
+			`Secret "postgres_password" rotated`,
+			"Restart services: backendAction, backendPresenter, backendManage, datastoreReader, datastoreWriter, vote, media\n",
+			`ALTER ROLE "openslides" WITH PASSWORD '` + string(password) + `';`,
+			"Kubernetes: render the manifests again",
+			"Docker Swarm: push the secrets again",
+		} {
+			if !strings.Contains(buf.String(), exp) {
+				t.Fatalf("got output\n%s\nexpected it to contain %q", buf.String(), exp)
+			}
+		}
+	})
+}
+
+func TestAlterRoleSQL(t *testing.T) {
+	got := secrets.AlterRoleSQL(`open"slides`, "pass'word")
+	expected := `ALTER ROLE "open""slides" WITH PASSWORD 'pass''word';`
+	if got != expected {
+		t.Fatalf("got %q, expected %q", got, expected)
+	}
+}
@@ -0,0 +1,32 @@
+package secrets
+
+import (
+	"github.com/spf13/cobra"
+)
+
+const (
+	// SecretsHelp contains the short help text for the command.
+	SecretsHelp = "Manages the secrets created by the setup command"
+
+	// SecretsHelpExtra contains the long help text for the command without
+	// the headline.
+	SecretsHelpExtra = `See help text for the respective commands for more information.`
+)
+
+// Cmd returns the subcommand.
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: SecretsHelp,
+		Long:  SecretsHelp + "\n\n" + SecretsHelpExtra,
+	}
+
+	cmd.AddCommand(
+		rotateCmd(),
+		encryptCmd(),
+		decryptCmd(),
+		pushSwarmCmd(),
+	)
+
+	return cmd
+}
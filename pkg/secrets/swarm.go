@@ -0,0 +1,260 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// PushSwarmHelp contains the short help text for the command.
+	PushSwarmHelp = "Creates Docker Swarm secrets from the secrets directory"
+
+	// PushSwarmHelpExtra contains the long help text for the command without
+	// the headline.
+	PushSwarmHelpExtra = `This command creates a Docker Swarm secret for every file in the secrets
+directory in the given directory. Encrypted secrets are decrypted with the
+key given in the environment, see the decrypt command. The stack file created with the target
+"swarm" expects these secrets to exist. The command uses the Docker Engine API
+at the address given by the environment variable DOCKER_HOST or the local
+socket /var/run/docker.sock. Existing secrets are skipped. Docker Swarm secrets
+can not be updated, so with the force flag existing secrets are removed and
+created again. This fails if the secret is used by a running service.`
+
+	defaultDockerHost = "unix:///var/run/docker.sock"
+)
+
+func pushSwarmCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "push-swarm directory",
+		Short: PushSwarmHelp,
+		Long:  PushSwarmHelp + "\n\n" + PushSwarmHelpExtra,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	force := cmd.Flags().BoolP("force", "f", false, "remove and recreate existing secrets")
+	timeout := cmd.Flags().Duration("timeout", 30*time.Second, "time to wait for the Docker Engine API")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		host := os.Getenv("DOCKER_HOST")
+		if host == "" {
+			host = defaultDockerHost
+		}
+		dc, err := NewDockerClient(host)
+		if err != nil {
+			return fmt.Errorf("creating Docker client: %w", err)
+		}
+
+		if err := PushSwarm(ctx, cmd.OutOrStdout(), dc, args[0], *force); err != nil {
+			return fmt.Errorf("pushing secrets to Docker Swarm: %w", err)
+		}
+		return nil
+	}
+	return cmd
+}
+
+// Client
+
+// SwarmClient contains the methods of the Docker Engine API used by
+// PushSwarm. It is implemented by DockerClient.
+type SwarmClient interface {
+	// Secrets returns the IDs of all existing secrets by name.
+	Secrets(ctx context.Context) (map[string]string, error)
+	CreateSecret(ctx context.Context, name string, data []byte) error
+	RemoveSecret(ctx context.Context, id string) error
+}
+
+// PushSwarm creates a Docker Swarm secret for every file in the secrets
+// directory in the given directory. Existing secrets are skipped unless force
+// is true. The key of the local CA is never pushed because no service needs it.
+func PushSwarm(ctx context.Context, w io.Writer, dc SwarmClient, dir string, force bool) error {
+	secrDir := path.Join(dir, setup.SecretsDirName)
+	entries, err := os.ReadDir(secrDir)
+	if err != nil {
+		return fmt.Errorf("reading secrets directory: %w", err)
+	}
+
+	existing, err := dc.Secrets(ctx)
+	if err != nil {
+		return fmt.Errorf("listing existing secrets: %w", err)
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		// Encrypted secrets are pushed with their plaintext name.
+		name := strings.TrimSuffix(entry.Name(), shared.EncryptedSuffix)
+		if name == setup.CAKeyName {
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		if id, ok := existing[name]; ok {
+			if !force {
+				fmt.Fprintf(w, "Secret %q already exists, skipping it.\n", name)
+				continue
+			}
+			if err := dc.RemoveSecret(ctx, id); err != nil {
+				return fmt.Errorf("removing existing secret %q: %w", name, err)
+			}
+		}
+
+		data, err := shared.ReadSecretFile(path.Join(secrDir, name))
+		if err != nil {
+			return fmt.Errorf("reading secret %q: %w", name, err)
+		}
+		if err := dc.CreateSecret(ctx, name, data); err != nil {
+			return fmt.Errorf("creating secret %q: %w", name, err)
+		}
+		fmt.Fprintf(w, "Secret %q created.\n", name)
+	}
+	return nil
+}
+
+// DockerClient is a minimal client for the secrets endpoints of the Docker
+// Engine API.
+type DockerClient struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewDockerClient returns a client for the Docker Engine API at the given
+// host. The host has the same format as the environment variable DOCKER_HOST,
+// e. g. unix:///var/run/docker.sock or tcp://127.0.0.1:2375.
+func NewDockerClient(host string) (*DockerClient, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Docker host %q: %w", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &DockerClient{
+			httpClient: &http.Client{Transport: transport},
+			baseURL:    "http://docker",
+		}, nil
+
+	case "tcp", "http":
+		return &DockerClient{
+			httpClient: &http.Client{},
+			baseURL:    "http://" + u.Host,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q, only unix and tcp (without TLS) are supported", host)
+	}
+}
+
+// Secrets returns the IDs of all existing secrets by name.
+func (c *DockerClient) Secrets(ctx context.Context) (map[string]string, error) {
+	var secrets []struct {
+		ID   string `json:"ID"`
+		Spec struct {
+			Name string `json:"Name"`
+		} `json:"Spec"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/secrets", nil, &secrets); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(secrets))
+	for _, s := range secrets {
+		result[s.Spec.Name] = s.ID
+	}
+	return result, nil
+}
+
+// CreateSecret creates a new secret with the given name and data.
+func (c *DockerClient) CreateSecret(ctx context.Context, name string, data []byte) error {
+	body := struct {
+		Name   string            `json:"Name"`
+		Data   []byte            `json:"Data"` // Encoded in base64 by the JSON encoder as required by the API.
+		Labels map[string]string `json:"Labels"`
+	}{
+		Name:   name,
+		Data:   data,
+		Labels: map[string]string{"org.openslides.managed-by": "openslides-manage-service"},
+	}
+	return c.do(ctx, http.MethodPost, "/secrets/create", body, nil)
+}
+
+// RemoveSecret removes the secret with the given ID.
+func (c *DockerClient) RemoveSecret(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/secrets/"+url.PathEscape(id), nil, nil)
+}
+
+// do sends a request to the Docker Engine API and decodes the response into
+// result if it is not nil.
+func (c *DockerClient) do(ctx context.Context, method, p string, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshalling request body: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+p, reqBody)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request to Docker Engine API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Message == "" {
+			return fmt.Errorf("got status %s from Docker Engine API", resp.Status)
+		}
+		return fmt.Errorf("got status %s from Docker Engine API: %s", resp.Status, strings.TrimSpace(apiErr.Message))
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
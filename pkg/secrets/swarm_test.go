@@ -0,0 +1,159 @@
+package secrets_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/secrets"
+)
+
+type mockDockerClient struct {
+	existing map[string]string
+	created  map[string]string
+	removed  []string
+}
+
+func (m *mockDockerClient) Secrets(ctx context.Context) (map[string]string, error) {
+	return m.existing, nil
+}
+
+func (m *mockDockerClient) CreateSecret(ctx context.Context, name string, data []byte) error {
+	m.created[name] = string(data)
+	return nil
+}
+
+func (m *mockDockerClient) RemoveSecret(ctx context.Context, id string) error {
+	m.removed = append(m.removed, id)
+	return nil
+}
+
+func TestPushSwarm(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	secDir := path.Join(testDir, "secrets")
+	if err := os.MkdirAll(path.Join(secDir, "some-subdirectory"), os.ModePerm); err != nil {
+		t.Fatalf("creating secrets directory: %v", err)
+	}
+	for _, name := range []string{"auth_token_key", "postgres_password"} {
+		if err := os.WriteFile(path.Join(secDir, name), []byte("secret_"+name), 0600); err != nil {
+			t.Fatalf("writing secret file: %v", err)
+		}
+	}
+
+	t.Run("pushing secrets", func(t *testing.T) {
+		dc := &mockDockerClient{
+			existing: map[string]string{"postgres_password": "id_postgres_password"},
+			created:  make(map[string]string),
+		}
+		buf := new(bytes.Buffer)
+		if err := secrets.PushSwarm(context.Background(), buf, dc, testDir, false); err != nil {
+			t.Fatalf("pushing secrets: %v", err)
+		}
+		if len(dc.created) != 1 || dc.created["auth_token_key"] != "secret_auth_token_key" {
+			t.Fatalf("wrong created secrets, got %v", dc.created)
+		}
+		if len(dc.removed) != 0 {
+			t.Fatalf("existing secrets should not be removed, got %v", dc.removed)
+		}
+		if !strings.Contains(buf.String(), `Secret "postgres_password" already exists, skipping it.`) {
+			t.Fatalf("got output %q, expected hint for skipped secret", buf.String())
+		}
+	})
+
+	t.Run("pushing secrets with force", func(t *testing.T) {
+		dc := &mockDockerClient{
+			existing: map[string]string{"postgres_password": "id_postgres_password"},
+			created:  make(map[string]string),
+		}
+		if err := secrets.PushSwarm(context.Background(), new(bytes.Buffer), dc, testDir, true); err != nil {
+			t.Fatalf("pushing secrets: %v", err)
+		}
+		if len(dc.created) != 2 || dc.created["postgres_password"] != "secret_postgres_password" {
+			t.Fatalf("wrong created secrets, got %v", dc.created)
+		}
+		if len(dc.removed) != 1 || dc.removed[0] != "id_postgres_password" {
+			t.Fatalf("wrong removed secrets, got %v", dc.removed)
+		}
+	})
+
+	t.Run("pushing secrets without secrets directory", func(t *testing.T) {
+		dc := &mockDockerClient{created: make(map[string]string)}
+		if err := secrets.PushSwarm(context.Background(), new(bytes.Buffer), dc, path.Join(testDir, "unknown"), false); err == nil {
+			t.Fatalf("pushing secrets without secrets directory should fail")
+		}
+	})
+}
+
+func TestDockerClient(t *testing.T) {
+	var created struct {
+		Name string
+		Data []byte
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/secrets":
+			w.Write([]byte(`[{"ID":"abc","Spec":{"Name":"superadmin"}}]`))
+		case r.Method == http.MethodPost && r.URL.Path == "/secrets/create":
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Errorf("decoding request body: %v", err)
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ID":"def"}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/secrets/abc":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"not found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	dc, err := secrets.NewDockerClient(strings.Replace(ts.URL, "http://", "tcp://", 1))
+	if err != nil {
+		t.Fatalf("creating Docker client: %v", err)
+	}
+	ctx := context.Background()
+
+	t.Run("listing secrets", func(t *testing.T) {
+		got, err := dc.Secrets(ctx)
+		if err != nil {
+			t.Fatalf("listing secrets: %v", err)
+		}
+		if got["superadmin"] != "abc" {
+			t.Fatalf("got secrets %v, expected superadmin with ID abc", got)
+		}
+	})
+
+	t.Run("creating secret", func(t *testing.T) {
+		if err := dc.CreateSecret(ctx, "postgres_password", []byte("my_password")); err != nil {
+			t.Fatalf("creating secret: %v", err)
+		}
+		if created.Name != "postgres_password" || string(created.Data) != "my_password" {
+			t.Fatalf("got secret %q with data %q, expected postgres_password", created.Name, created.Data)
+		}
+	})
+
+	t.Run("removing secret", func(t *testing.T) {
+		if err := dc.RemoveSecret(ctx, "abc"); err != nil {
+			t.Fatalf("removing secret: %v", err)
+		}
+	})
+
+	t.Run("removing unknown secret", func(t *testing.T) {
+		err := dc.RemoveSecret(ctx, "unknown")
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Fatalf("got error %v, expected error with message from API", err)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Roles of the policy. Every role includes the permissions of the roles
+// before it.
+const (
+	RoleReadOnly = "read-only"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleLevels = map[string]int{
+	RoleReadOnly: 1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// methodRoles contains the role required for each RPC. RPCs which are not
+// listed here require the admin role.
+var methodRoles = map[string]string{
+	"Health":        RoleReadOnly,
+	"Version":       RoleReadOnly,
+	"Get":           RoleReadOnly,
+	"CheckServer":   RoleReadOnly,
+	"Set":           RoleOperator,
+	"CreateUser":    RoleOperator,
+	"SetPassword":   RoleOperator,
+	"SendTestEmail": RoleOperator,
+	"InitialData":   RoleAdmin,
+	"Migrations":    RoleAdmin,
+}
+
+// RequiredRole returns the role required to call the given RPC. The method
+// can be given with or without service prefix.
+func RequiredRole(method string) string {
+	name := method[strings.LastIndex(method, "/")+1:]
+	if role, ok := methodRoles[name]; ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// Policy contains the roles of the credentials of the manage service.
+type Policy struct {
+	// Password is the role of the shared password. An empty role means the
+	// password is not allowed to call any RPC except Health.
+	Password string `json:"password"`
+
+	// Operators maps operator names of client certificates to roles.
+	Operators map[string]string `json:"operators"`
+
+	// Tokens contains named tokens. Clients give them like the password.
+	Tokens map[string]Token `json:"tokens"`
+}
+
+// Token is a named credential. Only the SHA-256 hash of the token is stored.
+type Token struct {
+	Role   string `json:"role"`
+	SHA256 string `json:"sha256"`
+
+	hash []byte
+}
+
+// ReadPolicy reads and checks the policy file at the given path.
+func ReadPolicy(p string) (*Policy, error) {
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+	var policy Policy
+	if err := yaml.Unmarshal(content, &policy); err != nil {
+		return nil, fmt.Errorf("parsing policy file %q: %w", p, err)
+	}
+
+	if err := checkRole(policy.Password, true); err != nil {
+		return nil, fmt.Errorf("password: %w", err)
+	}
+	for name, role := range policy.Operators {
+		if err := checkRole(role, false); err != nil {
+			return nil, fmt.Errorf("operator %q: %w", name, err)
+		}
+	}
+	for name, t := range policy.Tokens {
+		if err := checkRole(t.Role, false); err != nil {
+			return nil, fmt.Errorf("token %q: %w", name, err)
+		}
+		hash, err := hex.DecodeString(t.SHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("token %q: invalid sha256 %q, use the SHA-256 hash of the token in hex", name, t.SHA256)
+		}
+		t.hash = hash
+		policy.Tokens[name] = t
+	}
+	return &policy, nil
+}
+
+func checkRole(role string, emptyAllowed bool) error {
+	if role == "" && emptyAllowed {
+		return nil
+	}
+	if _, ok := roleLevels[role]; !ok {
+		return fmt.Errorf("unknown role %q, use one of %q, %q and %q", role, RoleReadOnly, RoleOperator, RoleAdmin)
+	}
+	return nil
+}
+
+// token returns the name of the token with the given value.
+func (p *Policy) token(value []byte) (string, bool) {
+	hash := sha256.Sum256(value)
+	for name, t := range p.Tokens {
+		if subtle.ConstantTimeCompare(hash[:], t.hash) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// role returns the role of the given identity. It returns an empty string if
+// the identity has no role.
+func (p *Policy) role(id identity) string {
+	switch id.kind {
+	case kindPassword:
+		return p.Password
+	case kindCertificate:
+		return p.Operators[id.name]
+	case kindToken:
+		return p.Tokens[id.name].Role
+	}
+	return ""
+}
+
+// allowed reports whether the given identity may call the given RPC. Health
+// is always allowed because the health check inside the container may not
+// have a role.
+func (p *Policy) allowed(id identity, method string) bool {
+	if method == healthMethod {
+		return true
+	}
+	role := p.role(id)
+	return role != "" && roleLevels[role] >= roleLevels[RequiredRole(method)]
+}
@@ -0,0 +1,66 @@
+package server_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/server"
+)
+
+func TestReadPolicy(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	hash := strings.Repeat("ab", 32)
+	for _, tt := range []struct {
+		name   string
+		policy string
+		ok     bool
+	}{
+		{"empty policy", "", true},
+		{"all roles", "password: read-only\noperators:\n  alice: admin\ntokens:\n  ci:\n    role: operator\n    sha256: " + hash + "\n", true},
+		{"unknown password role", "password: superuser\n", false},
+		{"operator without role", "operators:\n  alice: \"\"\n", false},
+		{"token with invalid hash", "tokens:\n  ci:\n    role: operator\n    sha256: abcd\n", false},
+		{"token without role", "tokens:\n  ci:\n    sha256: " + hash + "\n", false},
+		{"invalid YAML", "password: [\n", false},
+	} {
+		t.Run("reading policy with "+tt.name, func(t *testing.T) {
+			p := path.Join(testDir, "policy.yml")
+			if err := os.WriteFile(p, []byte(tt.policy), 0600); err != nil {
+				t.Fatalf("writing policy file: %v", err)
+			}
+			_, err := server.ReadPolicy(p)
+			if tt.ok && err != nil {
+				t.Fatalf("reading policy failed: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatalf("reading policy should fail, but it did not")
+			}
+		})
+	}
+}
+
+func TestRequiredRole(t *testing.T) {
+	for _, tt := range []struct {
+		method string
+		role   string
+	}{
+		{"/Manage/Health", server.RoleReadOnly},
+		{"/Manage/CheckServer", server.RoleReadOnly},
+		{"/Manage/SetPassword", server.RoleOperator},
+		{"/Manage/InitialData", server.RoleAdmin},
+		{"/Manage/Unknown", server.RoleAdmin},
+	} {
+		t.Run("getting role of "+tt.method, func(t *testing.T) {
+			if got := server.RequiredRole(tt.method); got != tt.role {
+				t.Fatalf("got role %q, expected %q", got, tt.role)
+			}
+		})
+	}
+}
@@ -3,19 +3,24 @@ package server
 import (
 	"context"
 	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
 	"os/signal"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/action"
 	"github.com/OpenSlides/openslides-manage-service/pkg/checkserver"
 	"github.com/OpenSlides/openslides-manage-service/pkg/createuser"
 	"github.com/OpenSlides/openslides-manage-service/pkg/datastorereader"
+	"github.com/OpenSlides/openslides-manage-service/pkg/email"
 	"github.com/OpenSlides/openslides-manage-service/pkg/get"
 	"github.com/OpenSlides/openslides-manage-service/pkg/initialdata"
 	"github.com/OpenSlides/openslides-manage-service/pkg/migrations"
@@ -26,7 +31,11 @@ import (
 	"github.com/OpenSlides/openslides-manage-service/proto"
 	"golang.org/x/sys/unix"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 const runDir = "/run"
@@ -44,24 +53,18 @@ func Run(cfg *Config) error {
 		return fmt.Errorf("listen on address %q: %w", addr, err)
 	}
 
-	grpcSrv := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			grpc.UnaryServerInterceptor(logUnaryInterceptor),
-			grpc.UnaryServerInterceptor(authUnaryInterceptor),
-		),
-	)
-	manageSrv, err := newServer(cfg, logger)
+	grpcSrv, err := NewGRPCServer(cfg, logger)
 	if err != nil {
-		return fmt.Errorf("creating server object: %w", err)
+		return err
 	}
-	proto.RegisterManageServer(grpcSrv, manageSrv)
+	tlsEnabled, _ := cfg.TLSEnabled() // The error is already checked by NewGRPCServer().
 
 	go func() {
 		waitForShutdown()
 		grpcSrv.GracefulStop()
 	}()
 
-	logger.Infof("Manage service is listening on %s\n", addr)
+	logger.Infof("Manage service is listening on %s (TLS: %t)\n", addr, tlsEnabled)
 	if err := grpcSrv.Serve(lis); err != nil {
 		return fmt.Errorf("running manage service: %w", err)
 	}
@@ -69,22 +72,95 @@ func Run(cfg *Config) error {
 	return nil
 }
 
+// NewGRPCServer returns a gRPC server with the registered manage service. It
+// terminates TLS and accepts client certificates if the config says so.
+func NewGRPCServer(cfg *Config, logger shared.Logger) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			grpc.UnaryServerInterceptor(logUnaryInterceptor),
+			grpc.UnaryServerInterceptor(authUnaryInterceptor),
+		),
+	}
+	tlsEnabled, err := cfg.TLSEnabled()
+	if err != nil {
+		return nil, err
+	}
+	if tlsEnabled {
+		tlsConfig, err := cfg.serverTLSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("creating TLS config: %w", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else if cfg.ManageClientCAFile != "" {
+		return nil, fmt.Errorf("MANAGE_CLIENT_CA_FILE requires MANAGE_ENABLE_TLS")
+	}
+
+	grpcSrv := grpc.NewServer(opts...)
+	manageSrv, err := newServer(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("creating server object: %w", err)
+	}
+	proto.RegisterManageServer(grpcSrv, manageSrv)
+	return grpcSrv, nil
+}
+
 // srv implements the manage methods on server side.
 type srv struct {
 	config *Config
 	pw     []byte
 	logger shared.Logger
+
+	// passwordAuth is true if clients can authenticate with the password.
+	passwordAuth bool
+
+	// operators maps certificate subjects to operator names. It is nil if
+	// every client certificate signed by the client CA is accepted. Then the
+	// common name is the operator name.
+	operators map[string]string
+
+	// policy contains the roles of the credentials. It is nil if every
+	// authenticated client may call every RPC.
+	policy *Policy
 }
 
 func newServer(cfg *Config, logger shared.Logger) (*srv, error) {
-	pw, err := shared.AuthSecret(cfg.ManageAuthPasswordFile, cfg.OpenSlidesDevelopment)
+	passwordAuth, err := strconv.ParseBool(cfg.ManagePasswordAuth)
 	if err != nil {
-		return nil, fmt.Errorf("getting server auth secret: %w", err)
+		return nil, fmt.Errorf("parsing MANAGE_PASSWORD_AUTH %q: %w", cfg.ManagePasswordAuth, err)
 	}
+
+	var policy *Policy
+	if cfg.ManagePolicyFile != "" {
+		policy, err = ReadPolicy(cfg.ManagePolicyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !passwordAuth && cfg.ManageClientCAFile == "" && (policy == nil || len(policy.Tokens) == 0) {
+		return nil, fmt.Errorf("MANAGE_PASSWORD_AUTH can only be disabled together with MANAGE_CLIENT_CA_FILE or tokens in MANAGE_POLICY_FILE")
+	}
+
+	var pw []byte
+	if passwordAuth {
+		pw, err = shared.AuthSecret(cfg.ManageAuthPasswordFile, cfg.OpenSlidesDevelopment)
+		if err != nil {
+			return nil, fmt.Errorf("getting server auth secret: %w", err)
+		}
+	}
+
+	operators, err := cfg.operators()
+	if err != nil {
+		return nil, err
+	}
+
 	s := &srv{
-		config: cfg,
-		pw:     pw,
-		logger: logger,
+		config:       cfg,
+		pw:           pw,
+		logger:       logger,
+		passwordAuth: passwordAuth,
+		operators:    operators,
+		policy:       policy,
 	}
 	return s, nil
 }
@@ -105,7 +181,8 @@ func (s *srv) InitialData(ctx context.Context, in *proto.InitialDataRequest) (*p
 		return nil, fmt.Errorf("getting internal auth password from file: %w", err)
 	}
 	a := action.New(s.config.manageBackendActionURL(), pw, action.ActionRoute)
-	return initialdata.InitialData(ctx, in, runDir, a)
+	dev, _ := strconv.ParseBool(s.config.OpenSlidesDevelopment) // An invalid value means no development mode.
+	return initialdata.InitialData(ctx, in, runDir, dev, a)
 
 }
 
@@ -161,19 +238,39 @@ func (s *srv) Health(ctx context.Context, in *proto.HealthRequest) (*proto.Healt
 	return &proto.HealthResponse{Healthy: true}, nil
 }
 
+func (s *srv) SendTestEmail(ctx context.Context, in *proto.SendTestEmailRequest) (*proto.SendTestEmailResponse, error) {
+	return email.SendTestEmail(ctx, in, s.config.emailSettings())
+}
+
 func logUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	info.Server.(*srv).logger.Debugf("Incomming unary RPC for %s: %v", info.FullMethod, req)
 	resp, err := handler(ctx, req)
 	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			// Do not wrap status errors, so the client gets their code.
+			return nil, err
+		}
 		return nil, fmt.Errorf("calling handler: %w", err)
 	}
 	return resp, nil
 }
 
 func authUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	if err := info.Server.(*srv).serverAuth(ctx); err != nil {
+	s := info.Server.(*srv)
+	id, err := s.serverAuth(ctx, info.FullMethod)
+	if err != nil {
 		return nil, fmt.Errorf("server authentication: %w", err)
 	}
+	if s.policy != nil && !s.policy.allowed(id, info.FullMethod) {
+		s.logger.Infof("RPC %s denied for %s", info.FullMethod, id)
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not allowed to call %s, role %q is required", id, info.FullMethod, RequiredRole(info.FullMethod))
+	}
+	if info.FullMethod == healthMethod {
+		// The health check runs very often, so it is only logged in debug mode.
+		s.logger.Debugf("RPC %s called by %s", info.FullMethod, id)
+	} else {
+		s.logger.Infof("RPC %s called by %s", info.FullMethod, id)
+	}
 	resp, err := handler(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("calling handler: %w", err)
@@ -181,25 +278,115 @@ func authUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.Unary
 	return resp, nil
 }
 
-func (s *srv) serverAuth(ctx context.Context) error {
+// Kinds of identities of authenticated requests.
+const (
+	kindCertificate = "certificate"
+	kindToken       = "token"
+	kindPassword    = "password"
+	kindAnonymous   = "anonymous"
+)
+
+// identity is the authenticated sender of a request. The name is the operator
+// name of a client certificate or the name of a token.
+type identity struct {
+	kind string
+	name string
+}
+
+func (id identity) String() string {
+	switch id.kind {
+	case kindCertificate:
+		return fmt.Sprintf("operator %q", id.name)
+	case kindToken:
+		return fmt.Sprintf("token %q", id.name)
+	}
+	return id.kind
+}
+
+// healthMethod is the full method name of the health RPC. It does not need
+// authentication if the password authentication is disabled because the
+// health check inside the container has no client certificate.
+const healthMethod = "/Manage/Health"
+
+// serverAuth authenticates the request with the client certificate, a token
+// of the policy or the password. It returns the identity of the sender.
+func (s *srv) serverAuth(ctx context.Context, method string) (identity, error) {
+	operator, ok, err := s.certOperator(ctx)
+	if err != nil {
+		return identity{}, err
+	}
+	if ok {
+		return identity{kind: kindCertificate, name: operator}, nil
+	}
+
+	password, err := authorization(ctx)
+	if err == nil && s.policy != nil {
+		if name, ok := s.policy.token(password); ok {
+			return identity{kind: kindToken, name: name}, nil
+		}
+	}
+
+	if !s.passwordAuth {
+		if method == healthMethod {
+			return identity{kind: kindAnonymous}, nil
+		}
+		return identity{}, fmt.Errorf("no valid client certificate or token found")
+	}
+
+	if err != nil {
+		return identity{}, err
+	}
+	if subtle.ConstantTimeCompare(password, s.pw) != 1 {
+		return identity{}, fmt.Errorf("password does not match")
+	}
+
+	return identity{kind: kindPassword}, nil
+}
+
+// authorization returns the decoded password or token of the authorization
+// header of the request.
+func authorization(ctx context.Context) ([]byte, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return fmt.Errorf("getting metadata from context: failed")
+		return nil, fmt.Errorf("getting metadata from context: failed")
 	}
 	a := md.Get("authorization")
 	if len(a) == 0 {
-		return fmt.Errorf("no authorization header found")
+		return nil, fmt.Errorf("no authorization header found")
 	}
 	password, err := base64.StdEncoding.DecodeString(a[0])
 	if err != nil {
-		return fmt.Errorf("decoding password (base64): %w", err)
+		return nil, fmt.Errorf("decoding password (base64): %w", err)
 	}
+	return password, nil
+}
 
-	if subtle.ConstantTimeCompare(password, s.pw) != 1 {
-		return fmt.Errorf("password does not match")
+// certOperator returns the operator of the verified client certificate of the
+// request. The returned bool is false if the client did not send a
+// certificate.
+func (s *srv) certOperator(ctx context.Context) (string, bool, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false, nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+		return "", false, nil
 	}
+	cert := tlsInfo.State.VerifiedChains[0][0]
 
-	return nil
+	if s.operators == nil {
+		if cert.Subject.CommonName == "" {
+			return "", false, fmt.Errorf("client certificate has no common name")
+		}
+		return cert.Subject.CommonName, true, nil
+	}
+	subject := cert.Subject.String()
+	operator, ok := s.operators[subject]
+	if !ok {
+		return "", false, fmt.Errorf("client certificate with subject %q does not belong to an operator", subject)
+	}
+	return operator, true, nil
 }
 
 // Config holds config data for the server.
@@ -211,6 +398,25 @@ type Config struct {
 	Port                   string `env:"MANAGE_PORT,9008"`
 	ManageAuthPasswordFile string `env:"MANAGE_AUTH_PASSWORD_FILE,/run/secrets/manage_auth_password"`
 
+	// If TLS is enabled, the server terminates TLS itself instead of relying
+	// on the proxy. The defaults are the secrets for local HTTPS.
+	ManageEnableTLS   string `env:"MANAGE_ENABLE_TLS,0"`
+	ManageTLSCertFile string `env:"MANAGE_TLS_CERT_FILE,/run/secrets/cert_crt"`
+	ManageTLSKeyFile  string `env:"MANAGE_TLS_KEY_FILE,/run/secrets/cert_key"`
+
+	// Clients can authenticate with certificates signed by the client CA if
+	// TLS is enabled. The operators are a JSON object which maps operator
+	// names to certificate subjects. If it is empty, all certificates signed by
+	// the CA are accepted.
+	ManageClientCAFile string `env:"MANAGE_CLIENT_CA_FILE"`
+	ManageOperators    string `env:"MANAGE_OPERATORS"`
+	ManagePasswordAuth string `env:"MANAGE_PASSWORD_AUTH,1"`
+
+	// The policy file contains the roles of the password, the operators and
+	// named tokens. If it is empty, every authenticated client may call every
+	// RPC.
+	ManagePolicyFile string `env:"MANAGE_POLICY_FILE"`
+
 	// Hint: The env var for the host is MANAGE_ACTION_HOST but the env vars for
 	// protocol and port don't have the MANAGE_ prefix because the backend
 	// itself does not distiguish between an common backend container and a
@@ -225,6 +431,15 @@ type Config struct {
 
 	InternalAuthPasswordFile string `env:"INTERNAL_AUTH_PASSWORD_FILE,/run/secrets/internal_auth_password"`
 
+	// The email settings are the same as for the backend.
+	EmailHost                        string `env:"EMAIL_HOST"`
+	EmailPort                        string `env:"EMAIL_PORT,465"`
+	EmailConnectionSecurity          string `env:"EMAIL_CONNECTION_SECURITY,SSL/TLS"`
+	EmailHostUser                    string `env:"EMAIL_HOST_USER"`
+	EmailHostPasswordFile            string `env:"EMAIL_HOST_PASSWORD_FILE"`
+	EmailFrom                        string `env:"DEFAULT_FROM_EMAIL,noreply@example.com"`
+	EmailAcceptSelfSignedCertificate string `env:"EMAIL_ACCEPT_SELF_SIGNED_CERTIFICATE,false"`
+
 	OpenSlidesDevelopment string `env:"OPENSLIDES_DEVELOPMENT,0"`
 	OpenSlidesLoglevel    string `env:"OPENSLIDES_LOGLEVEL,info"`
 }
@@ -258,6 +473,60 @@ func ConfigFromEnv(loockup func(string) (string, bool)) *Config {
 	return &c
 }
 
+// TLSEnabled reports whether the server terminates TLS itself.
+func (c *Config) TLSEnabled() (bool, error) {
+	enabled, err := strconv.ParseBool(c.ManageEnableTLS)
+	if err != nil {
+		return false, fmt.Errorf("parsing MANAGE_ENABLE_TLS %q: %w", c.ManageEnableTLS, err)
+	}
+	return enabled, nil
+}
+
+// serverTLSConfig returns the TLS config of the server.
+func (c *Config) serverTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.ManageTLSCertFile, c.ManageTLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if c.ManageClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	content, err := os.ReadFile(c.ManageClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no PEM encoded certificate found in client CA file %q", c.ManageClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	// Clients without certificate can still use the password if it is enabled.
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+// operators returns the map of certificate subjects to operator names or nil
+// if no operators are configured.
+func (c *Config) operators() (map[string]string, error) {
+	if c.ManageOperators == "" {
+		return nil, nil
+	}
+	var byName map[string]string
+	if err := json.Unmarshal([]byte(c.ManageOperators), &byName); err != nil {
+		return nil, fmt.Errorf("parsing MANAGE_OPERATORS: %w", err)
+	}
+	operators := make(map[string]string, len(byName))
+	for name, subject := range byName {
+		if other, ok := operators[subject]; ok {
+			return nil, fmt.Errorf("operators %q and %q have the same certificate subject %q", other, name, subject)
+		}
+		operators[subject] = name
+	}
+	return operators, nil
+}
+
 // manageBackendActionURL returns an URL object to the backend action service
 // with action route.
 func (c *Config) manageBackendActionURL() *url.URL {
@@ -301,6 +570,20 @@ func (c *Config) datastoreReaderURL() *url.URL {
 	return &u
 }
 
+// emailSettings returns the settings of the email server.
+func (c *Config) emailSettings() email.Settings {
+	acceptSelfSigned, _ := strconv.ParseBool(c.EmailAcceptSelfSignedCertificate) // Invalid values mean false.
+	return email.Settings{
+		Host:                        c.EmailHost,
+		Port:                        c.EmailPort,
+		Security:                    c.EmailConnectionSecurity,
+		User:                        c.EmailHostUser,
+		PasswordFile:                c.EmailHostPasswordFile,
+		From:                        c.EmailFrom,
+		AcceptSelfSignedCertificate: acceptSelfSigned,
+	}
+}
+
 // clientVersionURL returns an URL object to the client service.
 func (c *Config) clientVersionURL() *url.URL {
 	u := url.URL{ // TODO: Protocol, host and port should be retrieved from environment variables.
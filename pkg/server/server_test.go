@@ -1,9 +1,308 @@
 package server_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/connection"
+	"github.com/OpenSlides/openslides-manage-service/pkg/server"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/OpenSlides/openslides-manage-service/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestRunServer(t *testing.T) {
 	t.Skip("test is missing here")
 }
+
+func TestTLSEnabled(t *testing.T) {
+	for _, tt := range []struct {
+		env     map[string]string
+		enabled bool
+		err     bool
+	}{
+		{map[string]string{}, false, false},
+		{map[string]string{"MANAGE_ENABLE_TLS": "1"}, true, false},
+		{map[string]string{"MANAGE_ENABLE_TLS": "false"}, false, false},
+		{map[string]string{"MANAGE_ENABLE_TLS": "yes"}, false, true},
+	} {
+		t.Run("parsing MANAGE_ENABLE_TLS="+tt.env["MANAGE_ENABLE_TLS"], func(t *testing.T) {
+			cfg := server.ConfigFromEnv(func(name string) (string, bool) {
+				v, ok := tt.env[name]
+				return v, ok
+			})
+			enabled, err := cfg.TLSEnabled()
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, expected error: %t", err, tt.err)
+			}
+			if enabled != tt.enabled {
+				t.Fatalf("got enabled %t, expected %t", enabled, tt.enabled)
+			}
+			if cfg.ManageTLSCertFile != "/run/secrets/cert_crt" {
+				t.Fatalf("got cert file %q, expected default /run/secrets/cert_crt", cfg.ManageTLSCertFile)
+			}
+		})
+	}
+}
+
+func TestClientCertificates(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	if err := setup.Setup(testDir, false, nil, [][]byte{[]byte("certificate:\n  createCA: true\n")}, nil); err != nil {
+		t.Fatalf("running Setup() failed with error: %v", err)
+	}
+	secrDir := path.Join(testDir, setup.SecretsDirName)
+	clientDir := path.Join(testDir, "clients")
+	for _, name := range []string{"alice", "mallory"} {
+		if _, err := setup.IssueClientCert(secrDir, clientDir, name, false, "", 1); err != nil {
+			t.Fatalf("issuing client certificate for %s: %v", name, err)
+		}
+	}
+
+	logs := new(bytes.Buffer)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	start := func(t *testing.T, env map[string]string) string {
+		t.Helper()
+		env["MANAGE_ENABLE_TLS"] = "1"
+		env["MANAGE_TLS_CERT_FILE"] = path.Join(secrDir, setup.CertCertName)
+		env["MANAGE_TLS_KEY_FILE"] = path.Join(secrDir, setup.CertKeyName)
+		env["MANAGE_CLIENT_CA_FILE"] = path.Join(secrDir, setup.CACertName)
+		env["MANAGE_AUTH_PASSWORD_FILE"] = path.Join(secrDir, setup.ManageAuthPasswordFileName)
+		cfg := server.ConfigFromEnv(func(name string) (string, bool) {
+			v, ok := env[name]
+			return v, ok
+		})
+		logger, err := shared.NewLogger("debug")
+		if err != nil {
+			t.Fatalf("creating logger: %v", err)
+		}
+		grpcSrv, err := server.NewGRPCServer(cfg, logger)
+		if err != nil {
+			t.Fatalf("creating gRPC server: %v", err)
+		}
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listening for gRPC server: %v", err)
+		}
+		go grpcSrv.Serve(lis)
+		t.Cleanup(grpcSrv.Stop)
+		return "localhost:" + strings.Split(lis.Addr().String(), ":")[1]
+	}
+
+	health := func(addr string, passwordFile string, opts connection.TLSOptions) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		opts.CAFile = path.Join(secrDir, setup.CertCertName)
+		cl, close, err := connection.Dial(ctx, addr, passwordFile, opts)
+		if err != nil {
+			return err
+		}
+		defer close()
+		_, err = cl.Health(ctx, &proto.HealthRequest{})
+		return err
+	}
+	clientCert := func(name string) connection.TLSOptions {
+		return connection.TLSOptions{
+			ClientCertFile: path.Join(clientDir, name+".crt"),
+			ClientKeyFile:  path.Join(clientDir, name+".key"),
+		}
+	}
+	passwordFile := path.Join(secrDir, setup.ManageAuthPasswordFileName)
+	noPasswordFile := path.Join(testDir, "does-not-exist")
+
+	t.Run("client certificates with operators", func(t *testing.T) {
+		addr := start(t, map[string]string{"MANAGE_OPERATORS": `{"alice": "CN=alice,O=OpenSlides"}`})
+
+		if err := health(addr, noPasswordFile, clientCert("alice")); err != nil {
+			t.Fatalf("calling health with client certificate of operator failed: %v", err)
+		}
+		if !strings.Contains(logs.String(), `called by operator "alice"`) {
+			t.Fatalf("operator is not logged, got\n%s", logs.String())
+		}
+		if err := health(addr, noPasswordFile, clientCert("mallory")); err == nil {
+			t.Fatalf("calling health with client certificate of unknown operator should fail")
+		}
+		if err := health(addr, passwordFile, connection.TLSOptions{}); err != nil {
+			t.Fatalf("calling health with password failed: %v", err)
+		}
+	})
+
+	t.Run("client certificates without operators", func(t *testing.T) {
+		addr := start(t, map[string]string{})
+
+		if err := health(addr, noPasswordFile, clientCert("mallory")); err != nil {
+			t.Fatalf("calling health with client certificate failed: %v", err)
+		}
+		if !strings.Contains(logs.String(), `called by operator "mallory"`) {
+			t.Fatalf("operator is not logged, got\n%s", logs.String())
+		}
+	})
+
+	t.Run("client certificates without password authentication", func(t *testing.T) {
+		addr := start(t, map[string]string{"MANAGE_PASSWORD_AUTH": "0"})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		cl, close, err := connection.Dial(ctx, addr, passwordFile, connection.TLSOptions{CAFile: path.Join(secrDir, setup.CertCertName)})
+		if err != nil {
+			t.Fatalf("connecting to gRPC server: %v", err)
+		}
+		defer close()
+		if _, err := cl.Version(ctx, &proto.VersionRequest{}); err == nil {
+			t.Fatalf("calling version with password should fail")
+		}
+		if _, err := cl.Health(ctx, &proto.HealthRequest{}); err != nil {
+			t.Fatalf("calling health without client certificate failed: %v", err)
+		}
+	})
+
+	t.Run("disabled password authentication without client CA", func(t *testing.T) {
+		cfg := server.ConfigFromEnv(func(name string) (string, bool) {
+			v, ok := map[string]string{"MANAGE_PASSWORD_AUTH": "0"}[name]
+			return v, ok
+		})
+		logger, _ := shared.NewLogger("info")
+		if _, err := server.NewGRPCServer(cfg, logger); err == nil {
+			t.Fatalf("creating gRPC server should fail")
+		}
+	})
+}
+
+func TestPolicy(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	if err := setup.Setup(testDir, false, nil, nil, nil); err != nil {
+		t.Fatalf("running Setup() failed with error: %v", err)
+	}
+	passwordFile := path.Join(testDir, setup.SecretsDirName, setup.ManageAuthPasswordFileName)
+
+	tokenFile := func(name string) (string, string) {
+		p := path.Join(testDir, name+"_token")
+		token := []byte("token-of-" + name)
+		if err := os.WriteFile(p, token, 0600); err != nil {
+			t.Fatalf("writing token file: %v", err)
+		}
+		hash := sha256.Sum256(token)
+		return p, hex.EncodeToString(hash[:])
+	}
+	ciFile, ciHash := tokenFile("ci")
+	backupFile, backupHash := tokenFile("backup")
+	unknownFile, _ := tokenFile("unknown")
+
+	policyFile := path.Join(testDir, "policy.yml")
+	policy := fmt.Sprintf("password: read-only\ntokens:\n  ci:\n    role: operator\n    sha256: %s\n  backup:\n    role: admin\n    sha256: %s\n", ciHash, backupHash)
+	if err := os.WriteFile(policyFile, []byte(policy), 0600); err != nil {
+		t.Fatalf("writing policy file: %v", err)
+	}
+
+	env := map[string]string{
+		"MANAGE_AUTH_PASSWORD_FILE": passwordFile,
+		"MANAGE_POLICY_FILE":        policyFile,
+		// Allowed calls fail in the handler because there is no backend.
+		"MANAGE_ACTION_HOST":    "127.0.0.1",
+		"ACTION_PORT":           "1",
+		"DATASTORE_READER_HOST": "127.0.0.1",
+		"DATASTORE_READER_PORT": "1",
+	}
+	cfg := server.ConfigFromEnv(func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	logger, err := shared.NewLogger("info")
+	if err != nil {
+		t.Fatalf("creating logger: %v", err)
+	}
+	grpcSrv, err := server.NewGRPCServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("creating gRPC server: %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening for gRPC server: %v", err)
+	}
+	go grpcSrv.Serve(lis)
+	defer grpcSrv.Stop()
+
+	call := func(credentialFile string, method string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		cl, close, err := connection.Dial(ctx, lis.Addr().String(), credentialFile, connection.TLSOptions{Disabled: true})
+		if err != nil {
+			t.Fatalf("connecting to gRPC server: %v", err)
+		}
+		defer close()
+		switch method {
+		case "Health":
+			_, err = cl.Health(ctx, &proto.HealthRequest{})
+		case "Set":
+			_, err = cl.Set(ctx, &proto.SetRequest{Action: "agenda_item"})
+		case "Migrations":
+			_, err = cl.Migrations(ctx, &proto.MigrationsRequest{Command: "stats"})
+		default:
+			t.Fatalf("unknown method %s", method)
+		}
+		return err
+	}
+
+	for _, tt := range []struct {
+		credential string
+		file       string
+		method     string
+		denied     bool
+	}{
+		{"password", passwordFile, "Health", false},
+		{"password", passwordFile, "Set", true},
+		{"password", passwordFile, "Migrations", true},
+		{"operator token", ciFile, "Health", false},
+		{"operator token", ciFile, "Set", false},
+		{"operator token", ciFile, "Migrations", true},
+		{"admin token", backupFile, "Set", false},
+		{"admin token", backupFile, "Migrations", false},
+	} {
+		t.Run(fmt.Sprintf("calling %s with %s", tt.method, tt.credential), func(t *testing.T) {
+			err := call(tt.file, tt.method)
+			denied := status.Code(err) == codes.PermissionDenied
+			if tt.denied && !denied {
+				t.Fatalf("call should be denied, got error %v", err)
+			}
+			if !tt.denied && denied {
+				t.Fatalf("call should be allowed, got error %v", err)
+			}
+			if tt.method == "Health" && err != nil {
+				t.Fatalf("calling health failed: %v", err)
+			}
+		})
+	}
+
+	t.Run("calling Health with unknown token", func(t *testing.T) {
+		err := call(unknownFile, "Health")
+		if err == nil {
+			t.Fatalf("calling health with unknown token should fail")
+		}
+		if status.Code(err) == codes.PermissionDenied {
+			t.Fatalf("unknown token should fail authentication, got %v", err)
+		}
+	})
+}
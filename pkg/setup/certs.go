@@ -0,0 +1,370 @@
+package setup
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// CACertName is the name of the secrets file containing the certificate of
+	// the local CA.
+	CACertName = "ca_crt"
+
+	// CAKeyName is the name of the secrets file containing the key of the
+	// local CA.
+	CAKeyName = "ca_key"
+
+	rsaKeyBits = 3072
+)
+
+// clientNameRegexp matches the names of client certificates. They are used as
+// file names.
+var clientNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// flagCertificate setups the flags for the self-signed certificate to the
+// given cobra command. The returned function returns a YAML config with the
+// values of all given flags or nil if no flag is given.
+func flagCertificate(cmd *cobra.Command) func() []byte {
+	dnsNames := cmd.Flags().StringArray("cert-dns-name", nil, "DNS name for the self-signed certificate, can be used more than once, overrides certificate.dnsNames")
+	ipAddresses := cmd.Flags().StringArray("cert-ip", nil, "IP address for the self-signed certificate, can be used more than once, overrides certificate.ipAddresses")
+	validityDays := cmd.Flags().Int("cert-validity-days", 0, "number of days the self-signed certificate is valid, overrides certificate.validityDays")
+	keyType := cmd.Flags().String("cert-key-type", "", fmt.Sprintf("key type of the self-signed certificate, one of %q, %q and %q, overrides certificate.keyType", config.KeyTypeECDSA, config.KeyTypeRSA, config.KeyTypeEd25519))
+	createCA := cmd.Flags().Bool("cert-ca", false, "create a local CA and sign the certificate with it, overrides certificate.createCA")
+	caValidityDays := cmd.Flags().Int("cert-ca-validity-days", 0, "number of days the local CA is valid, overrides certificate.caValidityDays")
+
+	return func() []byte {
+		c := make(map[string]interface{})
+		if cmd.Flags().Changed("cert-dns-name") {
+			c["dnsNames"] = *dnsNames
+		}
+		if cmd.Flags().Changed("cert-ip") {
+			c["ipAddresses"] = *ipAddresses
+		}
+		if cmd.Flags().Changed("cert-validity-days") {
+			c["validityDays"] = *validityDays
+		}
+		if cmd.Flags().Changed("cert-key-type") {
+			c["keyType"] = *keyType
+		}
+		if cmd.Flags().Changed("cert-ca") {
+			c["createCA"] = *createCA
+		}
+		if cmd.Flags().Changed("cert-ca-validity-days") {
+			c["caValidityDays"] = *caValidityDays
+		}
+		if len(c) == 0 {
+			return nil
+		}
+
+		// JSON is valid YAML, so the result can be used as config file.
+		b, _ := json.Marshal(map[string]interface{}{"certificate": c})
+		return b
+	}
+}
+
+// createCerts creates the key and the certificate for local HTTPS. If the
+// config says so, the certificate is signed by a local CA. An existing CA is
+// reused even with force so that clients which trust it keep working.
+func createCerts(dir string, force bool, cfg *config.YmlConfig) error {
+	c := cfg.Certificate
+	withCA := c.CreateCA != nil && *c.CreateCA
+
+	if withCA && !force {
+		if err := checkCertSignedByCA(dir); err != nil {
+			return err
+		}
+	}
+
+	key, err := generateKey(c.KeyType)
+	if err != nil {
+		return fmt.Errorf("generating key: %w", err)
+	}
+
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return err
+	}
+	var ips []net.IP
+	for _, ip := range c.IPAddresses {
+		ips = append(ips, net.ParseIP(ip))
+	}
+	templ := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"OpenSlides"}},
+		DNSNames:              c.DNSNames,
+		IPAddresses:           ips,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(0, 0, c.ValidityDays),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		templ.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	parent, parentKey := templ, key
+	if withCA {
+		parent, parentKey, err = localCA(dir, c.KeyType, c.CAValidityDays)
+		if err != nil {
+			return fmt.Errorf("getting local CA: %w", err)
+		}
+	}
+
+	certData, err := x509.CreateCertificate(rand.Reader, templ, parent, key.Public(), parentKey)
+	if err != nil {
+		return fmt.Errorf("creating certificate data: %w", err)
+	}
+	return writeCertAndKey(dir, force, CertCertName, CertKeyName, certData, key)
+}
+
+// IssueClientCert creates a key and a client certificate signed by the local
+// CA in the given secrets directory. The name is used as common name. The
+// files NAME.crt and NAME.key are written to outDir, existing files are only
+// overwritten if force is true. It returns the certificate.
+func IssueClientCert(secrDir, outDir, name string, force bool, keyType string, validityDays int) (*x509.Certificate, error) {
+	if !clientNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid name %q, use only letters, digits, dots, underscores and hyphens", name)
+	}
+
+	certPEM, err := shared.ReadSecretFile(path.Join(secrDir, CACertName))
+	if err != nil {
+		return nil, fmt.Errorf("reading CA certificate, create the CA with the setup command and createCA: %w", err)
+	}
+	keyPEM, err := shared.ReadSecretFile(path.Join(secrDir, CAKeyName))
+	if err != nil {
+		return nil, fmt.Errorf("reading CA key: %w", err)
+	}
+	ca, caKey, err := parseCA(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	certName, keyName := name+".crt", name+".key"
+	if !force {
+		for _, n := range []string{certName, keyName} {
+			if _, err := os.Stat(path.Join(outDir, n)); err == nil {
+				return nil, fmt.Errorf("file %q already exists, use the force flag to overwrite it", path.Join(outDir, n))
+			}
+		}
+	}
+
+	key, err := generateKey(keyType)
+	if err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	templ := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"OpenSlides"}, CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(0, 0, validityDays),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	certData, err := x509.CreateCertificate(rand.Reader, templ, ca, key.Public(), caKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate data: %w", err)
+	}
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("creating directory at %q: %w", outDir, err)
+	}
+	if err := writeCertAndKey(outDir, true, certName, keyName, certData, key); err != nil {
+		return nil, err
+	}
+	// The key is not written to the secrets directory, so restrict it.
+	if err := os.Chmod(path.Join(outDir, keyName), 0600); err != nil {
+		return nil, fmt.Errorf("changing permissions of %q: %w", keyName, err)
+	}
+	cert, err := x509.ParseCertificate(certData)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// checkCertSignedByCA returns an error if the certificate in the given secrets
+// directory exists but is not signed by the local CA. Without force the
+// existing certificate is kept, so it would not match the CA.
+func checkCertSignedByCA(dir string) error {
+	certPEM, err := shared.ReadSecretFile(path.Join(dir, CertCertName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading certificate: %w", err)
+	}
+	notSigned := fmt.Errorf("existing certificate %q is not signed by the local CA, use the force flag to create a new one", CertCertName)
+
+	caPEM, err := shared.ReadSecretFile(path.Join(dir, CACertName))
+	if errors.Is(err, os.ErrNotExist) {
+		return notSigned
+	}
+	if err != nil {
+		return fmt.Errorf("reading CA certificate: %w", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	caBlock, _ := pem.Decode(caPEM)
+	if certBlock == nil || caBlock == nil {
+		return notSigned
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return notSigned
+	}
+	ca, err := x509.ParseCertificate(caBlock.Bytes)
+	if err != nil {
+		return notSigned
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return notSigned
+	}
+	return nil
+}
+
+// localCA returns the certificate and key of the local CA. If the CA files
+// do not exist in the given secrets directory, a new CA is created.
+func localCA(dir string, keyType string, validityDays int) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, certErr := shared.ReadSecretFile(path.Join(dir, CACertName))
+	keyPEM, keyErr := shared.ReadSecretFile(path.Join(dir, CAKeyName))
+	if certErr == nil && keyErr == nil {
+		return parseCA(certPEM, keyPEM)
+	}
+	if !errors.Is(certErr, os.ErrNotExist) || !errors.Is(keyErr, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("CA certificate and key must both exist or both be missing, delete the existing file to create a new CA")
+	}
+
+	key, err := generateKey(keyType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating CA key: %w", err)
+	}
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	templ := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"OpenSlides"}, CommonName: "OpenSlides local CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(0, 0, validityDays),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	certData, err := x509.CreateCertificate(rand.Reader, templ, templ, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating CA certificate data: %w", err)
+	}
+	if err := writeCertAndKey(dir, false, CACertName, CAKeyName, certData, key); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(certData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing CA certificate: %w", err)
+	}
+	return cert, key, nil
+}
+
+func parseCA(certPEM, keyPEM []byte) (*x509.Certificate, crypto.Signer, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("CA certificate file %q does not contain PEM data", CACertName)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, nil, fmt.Errorf("certificate in %q is not a CA certificate", CACertName)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("CA key file %q does not contain PEM data", CAKeyName)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing CA key: %w", err)
+	}
+	key, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("CA key of type %T can not sign certificates", k)
+	}
+	return cert, key, nil
+}
+
+// generateKey returns a new private key of the given key type.
+func generateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case config.KeyTypeECDSA, "":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case config.KeyTypeRSA:
+		return rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case config.KeyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unknown key type %q", keyType)
+	}
+}
+
+func randomSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+	return serialNumber, nil
+}
+
+// writeCertAndKey writes the given certificate and key PEM encoded to the
+// secrets files with the given names.
+func writeCertAndKey(dir string, force bool, certName, keyName string, certData []byte, key crypto.Signer) error {
+	buf1 := new(bytes.Buffer)
+	if err := pem.Encode(buf1, &pem.Block{Type: "CERTIFICATE", Bytes: certData}); err != nil {
+		return fmt.Errorf("encoding certificate data: %w", err)
+	}
+	if err := createSecretFile(dir, force, certName, buf1.Bytes()); err != nil {
+		return fmt.Errorf("creating certificate file %q at %q: %w", certName, dir, err)
+	}
+
+	keyData, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("marshalling key: %w", err)
+	}
+	buf2 := new(bytes.Buffer)
+	if err := pem.Encode(buf2, &pem.Block{Type: "PRIVATE KEY", Bytes: keyData}); err != nil {
+		return fmt.Errorf("encoding key data: %w", err)
+	}
+	if err := createSecretFile(dir, force, keyName, buf2.Bytes()); err != nil {
+		return fmt.Errorf("creating key file %q at %q: %w", keyName, dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package setup_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+)
+
+func TestCerts(t *testing.T) {
+	t.Run("executing setup.Cmd() with certificate flags and local CA", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{
+			testDir,
+			"--cert-dns-name", "openslides.example.test",
+			"--cert-dns-name", "localhost",
+			"--cert-ip", "192.168.0.10",
+			"--cert-validity-days", "10",
+			"--cert-key-type", "ed25519",
+			"--cert-ca",
+		})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand: %v", err)
+		}
+
+		secDir := path.Join(testDir, setup.SecretsDirName)
+		cert := readCert(t, secDir, "cert_crt")
+		ca := readCert(t, secDir, setup.CACertName)
+
+		if got := strings.Join(cert.DNSNames, ","); got != "openslides.example.test,localhost" {
+			t.Fatalf("wrong DNS names, expected %q, got %q", "openslides.example.test,localhost", got)
+		}
+		if len(cert.IPAddresses) != 1 || cert.IPAddresses[0].String() != "192.168.0.10" {
+			t.Fatalf("wrong IP addresses, expected [192.168.0.10], got %v", cert.IPAddresses)
+		}
+		if _, ok := cert.PublicKey.(ed25519.PublicKey); !ok {
+			t.Fatalf("wrong key type, expected Ed25519, got %T", cert.PublicKey)
+		}
+		if d := time.Until(cert.NotAfter); d < 9*24*time.Hour || d > 10*24*time.Hour {
+			t.Fatalf("wrong validity, certificate expires at %s", cert.NotAfter)
+		}
+		if !ca.IsCA {
+			t.Fatalf("file %q does not contain a CA certificate", setup.CACertName)
+		}
+		if !ca.NotAfter.After(cert.NotAfter.AddDate(10, 0, 0)) {
+			t.Fatalf("wrong CA validity, CA expires at %s, certificate at %s", ca.NotAfter, cert.NotAfter)
+		}
+		verifyCert(t, cert, ca, "openslides.example.test")
+
+		// Creating the certificate again must reuse the CA.
+		caContent, err := os.ReadFile(path.Join(secDir, setup.CACertName))
+		if err != nil {
+			t.Fatalf("reading CA certificate: %v", err)
+		}
+		cmd = setup.Cmd()
+		cmd.SetArgs([]string{testDir, "--force", "--cert-ca"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand again: %v", err)
+		}
+		testContentFile(t, secDir, setup.CACertName, string(caContent))
+		verifyCert(t, readCert(t, secDir, "cert_crt"), ca, "localhost")
+	})
+
+	t.Run("executing setup.Cmd() with local CA on existing self-signed certificate", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{testDir})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand: %v", err)
+		}
+
+		cmd = setup.Cmd()
+		cmd.SetArgs([]string{testDir, "--cert-ca"})
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "not signed by the local CA") {
+			t.Fatalf("executing setup subcommand with local CA should fail, got %v", err)
+		}
+		secDir := path.Join(testDir, setup.SecretsDirName)
+		if _, err := os.Stat(path.Join(secDir, setup.CACertName)); !os.IsNotExist(err) {
+			t.Fatalf("file %q should not exist after the error, got error %v", setup.CACertName, err)
+		}
+
+		cmd = setup.Cmd()
+		cmd.SetArgs([]string{testDir, "--cert-ca", "--force"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand with force flag: %v", err)
+		}
+		verifyCert(t, readCert(t, secDir, "cert_crt"), readCert(t, secDir, setup.CACertName), "localhost")
+	})
+
+	t.Run("running setup.Setup() with certificate config", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+
+		customConfig := `---
+certificate:
+  dnsNames:
+  - openslides.example.test
+  keyType: rsa
+`
+		if err := setup.Setup(testDir, false, nil, [][]byte{[]byte(customConfig)}, nil); err != nil {
+			t.Fatalf("running Setup() failed with error: %v", err)
+		}
+
+		secDir := path.Join(testDir, setup.SecretsDirName)
+		cert := readCert(t, secDir, "cert_crt")
+		if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+			t.Fatalf("wrong key type, expected RSA, got %T", cert.PublicKey)
+		}
+		verifyCert(t, cert, cert, "openslides.example.test")
+		if _, err := os.Stat(path.Join(secDir, setup.CACertName)); !os.IsNotExist(err) {
+			t.Fatalf("file %q should not exist without createCA, got error %v", setup.CACertName, err)
+		}
+	})
+
+	t.Run("running setup.Setup() with default certificate config", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+
+		if err := setup.Setup(testDir, false, nil, nil, nil); err != nil {
+			t.Fatalf("running Setup() failed with error: %v", err)
+		}
+		cert := readCert(t, path.Join(testDir, setup.SecretsDirName), "cert_crt")
+		if _, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok {
+			t.Fatalf("wrong key type, expected ECDSA, got %T", cert.PublicKey)
+		}
+		verifyCert(t, cert, cert, "localhost")
+	})
+
+	t.Run("running setup.Setup() with invalid certificate config", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+
+		for _, customConfig := range []string{
+			"certificate:\n  keyType: dsa\n",
+			"certificate:\n  validityDays: -1\n",
+			"certificate:\n  ipAddresses: [not-an-ip]\n",
+			"certificate:\n  createCA: true\n  validityDays: 365\n  caValidityDays: 365\n",
+		} {
+			err := setup.Setup(testDir, false, nil, [][]byte{[]byte(customConfig)}, nil)
+			if err == nil || !strings.Contains(err.Error(), "checking certificate") {
+				t.Fatalf("running Setup() with config %q, expected certificate error, got %v", customConfig, err)
+			}
+		}
+	})
+}
+
+func readCert(t testing.TB, dir, name string) *x509.Certificate {
+	t.Helper()
+
+	content, err := os.ReadFile(path.Join(dir, name))
+	if err != nil {
+		t.Fatalf("reading certificate file %q: %v", name, err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		t.Fatalf("file %q does not contain PEM data", name)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("parsing certificate %q: %v", name, err)
+	}
+	return cert
+}
+
+func verifyCert(t testing.TB, cert, root *x509.Certificate, dnsName string) {
+	t.Helper()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: dnsName, Roots: roots}); err != nil {
+		t.Fatalf("verifying certificate for %q: %v", dnsName, err)
+	}
+}
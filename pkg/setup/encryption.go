@@ -0,0 +1,128 @@
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+// FlagEncryption setups the flags for encrypting secrets to the given cobra
+// command. The returned function returns the recipients or nil if no
+// encryption is requested.
+func FlagEncryption(cmd *cobra.Command) func() ([]age.Recipient, error) {
+	publicKeys := cmd.Flags().StringArray("encrypt-to", nil, "encrypt the secrets for the given age public key (age1...), can be used more than once")
+	withPassphrase := cmd.Flags().Bool("encrypt-with-passphrase", false, fmt.Sprintf("encrypt the secrets with the passphrase given in the environment variable %s", shared.PassphraseEnv))
+
+	return func() ([]age.Recipient, error) {
+		var passphrase string
+		if *withPassphrase {
+			passphrase = os.Getenv(shared.PassphraseEnv)
+			if passphrase == "" {
+				return nil, fmt.Errorf("environment variable %s must not be empty", shared.PassphraseEnv)
+			}
+		}
+		if len(*publicKeys) == 0 && passphrase == "" {
+			return nil, nil
+		}
+		return shared.Recipients(*publicKeys, passphrase)
+	}
+}
+
+// EncryptSecrets encrypts all plaintext files in the given secrets directory
+// for the given recipients. The encrypted files get the suffix .age and the
+// plaintext files are removed. It returns the names of the encrypted files.
+func EncryptSecrets(secrDir string, recipients []age.Recipient) ([]string, error) {
+	entries, err := os.ReadDir(secrDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, shared.EncryptedSuffix) {
+			continue
+		}
+		p := path.Join(secrDir, name)
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading secret file %q: %w", p, err)
+		}
+		if shared.IsEncrypted(content) {
+			continue
+		}
+
+		encrypted, err := shared.Encrypt(content, recipients)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting secret %q: %w", name, err)
+		}
+		if err := shared.CreateSecretFile(secrDir, true, name+shared.EncryptedSuffix, encrypted); err != nil {
+			return nil, fmt.Errorf("writing encrypted secret %q: %w", name, err)
+		}
+		if err := os.Remove(p); err != nil {
+			return nil, fmt.Errorf("removing plaintext secret file %q: %w", p, err)
+		}
+		names = append(names, name+shared.EncryptedSuffix)
+	}
+	return names, nil
+}
+
+// DecryptSecrets writes the plaintext files for all encrypted files in the
+// given secrets directory. The encrypted files are kept. It returns the names
+// of the plaintext files.
+func DecryptSecrets(secrDir string, identities []age.Identity) ([]string, error) {
+	entries, err := os.ReadDir(secrDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), shared.EncryptedSuffix) {
+			continue
+		}
+		p := path.Join(secrDir, entry.Name())
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading encrypted secret file %q: %w", p, err)
+		}
+		plain, err := shared.Decrypt(content, identities)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting secret file %q: %w", p, err)
+		}
+		name := strings.TrimSuffix(entry.Name(), shared.EncryptedSuffix)
+		if err := shared.CreateSecretFile(secrDir, true, name, plain); err != nil {
+			return nil, fmt.Errorf("writing secret %q: %w", name, err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// createSecretFile creates a secret file like shared.CreateSecretFile. An
+// existing encrypted version of the file counts as existing file. With force
+// the encrypted version is removed so that no outdated secret remains.
+func createSecretFile(dir string, force bool, name string, content []byte) error {
+	encPath := path.Join(dir, name+shared.EncryptedSuffix)
+	_, err := os.Stat(encPath)
+	encExists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("checking existance of file %q: %w", encPath, err)
+	}
+
+	if encExists {
+		if !force {
+			return nil
+		}
+		if err := os.Remove(encPath); err != nil {
+			return fmt.Errorf("removing encrypted secret file %q: %w", encPath, err)
+		}
+	}
+	return shared.CreateSecretFile(dir, force, name, content)
+}
@@ -2,31 +2,21 @@ package setup
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/base64"
-	"encoding/pem"
 	"fmt"
 	"io"
 	"io/fs"
-	"math/big"
 	"os"
 	"path"
-	"time"
 
 	"github.com/OpenSlides/openslides-manage-service/pkg/config"
-	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
 	"github.com/spf13/cobra"
 )
 
 const (
-	subDirPerms  fs.FileMode = 0770
-	dbDirName                = "db-data"
-	certCertName             = "cert_crt"
-	certKeyName              = "cert_key"
+	subDirPerms fs.FileMode = 0770
+	dbDirName               = "db-data"
 )
 
 const (
@@ -36,11 +26,68 @@ const (
 	// SetupHelpExtra contains the long help text for the command without the headline.
 	SetupHelpExtra = `This command creates a container configuration YAML file. It also creates the
 required secrets and directories for volumes containing persistent database and
-SSL certs. Everything is created in the given directory.`
+SSL certs. Everything is created in the given directory. Use the target
+"swarm" to get a stack file for Docker Swarm and the target "kubernetes" to get
+Kubernetes manifests instead of a Docker Compose YAML file.
+
+Use the encryption flags to store the secrets encrypted in the age format. In
+this case the secrets have to be decrypted with the command "secrets decrypt"
+before the containers are started.
+
+Use the inventory flag instead of the directory to set up several instances at
+once. The inventory file looks like this:
+
+  basePort: 8000
+  instances:
+    - name: org-a
+      directory: ./org-a
+      port: 8001
+      domain: openslides.org-a.example.com
+      config:
+        services:
+          backendAction:
+            environment:
+              OPENSLIDES_LOGLEVEL: debug
+    - name: org-b
+
+Relative directories are relative to the inventory file, the default is the
+name. Instances without port get the lowest free port starting at the base port.
+The port is stored in the file instance.yml in the directory of the instance, so
+it does not change on later runs. The config files given with the config flag
+are used for all instances before the overrides of the instance. A summary
+table is printed at the end.
+
+Use the interactive flag to get asked for the most important settings like
+domain, port, HTTPS mode, email, external database and superadmin password.
+The answers are written to the commented setup configuration YAML file
+config.yml in the given directory which is used after the files given with the
+config flag. Use the answers flag to give some or all answers in a YAML file
+like this:
+
+  domain: openslides.example.com
+  port: 443
+  https: auto
+  emailHost: mail.example.com
+
+Without the interactive flag, questions not answered in this file take their
+defaults.
+
+The superadmin secret contains the password "superadmin" by default. Use the
+flag generate-superadmin-password to get a random password instead. It is
+printed once at the end. You can also give the password in a file or via stdin
+with the flag superadmin-password-file.`
 
 	// SecretsDirName is the name of the directory for Docker Secrets.
 	SecretsDirName = "secrets"
 
+	// CertCertName is the name of the secrets file containing the certificate
+	// for local HTTPS.
+	CertCertName = "cert_crt"
+
+	// CertKeyName is the name of the secrets file containing the key for local
+	// HTTPS.
+	CertKeyName = "cert_key"
+
 	// SuperadminFileName is the name of the secrets file containing the superadmin password.
 	SuperadminFileName = "superadmin"
 
@@ -58,40 +105,110 @@ func Cmd() *cobra.Command {
 		Use:   "setup directory",
 		Short: SetupHelp,
 		Long:  SetupHelp + "\n\n" + SetupHelpExtra,
-		Args:  cobra.ExactArgs(1),
 	}
 
 	force := cmd.Flags().BoolP("force", "f", false, "do not skip existing files but overwrite them")
 	tplFileName := config.FlagTpl(cmd)
 	configFileNames := config.FlagConfig(cmd)
+	target := config.FlagTarget(cmd)
+	recipients := FlagEncryption(cmd)
+	certConfig := flagCertificate(cmd)
+	inventory := config.FlagInventory(cmd)
+	cmd.Args = config.ArgsDirectoryOrInventory(inventory)
+	interactive := cmd.Flags().BoolP("interactive", "i", false, "ask for the most important settings and write them to "+WizardConfigFileName)
+	answersFileName := cmd.Flags().String("answers", "", "answers file for the setup wizard, questions not answered there are only asked together with the interactive flag")
+	superadminPasswordFlags := flagSuperadminPassword(cmd)
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		dir := args[0]
+		rcpts, err := recipients()
+		if err != nil {
+			return fmt.Errorf("parsing encryption flags: %w", err)
+		}
+
+		tplFile, err := config.ReadTplFile(*tplFileName)
+		if err != nil {
+			return err
+		}
+
+		configFiles, err := config.ReadConfigFiles(*configFileNames)
+		if err != nil {
+			return err
+		}
+		var flagConfigFiles [][]byte
+		if *target != "" {
+			flagConfigFiles = append(flagConfigFiles, config.TargetConfig(*target))
+		}
+		if c := certConfig(); c != nil {
+			flagConfigFiles = append(flagConfigFiles, c)
+		}
+
+		superadmin, err := superadminPasswordFlags(*interactive)
+		if err != nil {
+			return err
+		}
 
-		var tplFile []byte
-		if *tplFileName != "" {
-			fc, err := os.ReadFile(*tplFileName)
+		setup := func(dir string, configFiles [][]byte) error {
+			pw, err := superadmin.get()
 			if err != nil {
-				return fmt.Errorf("reading file %q: %w", *tplFileName, err)
+				return err
+			}
+			if err := Setup(dir, *force, tplFile, configFiles, pw); err != nil {
+				return fmt.Errorf("running Setup(): %w", err)
 			}
-			tplFile = fc
+			if superadmin.generate {
+				if err := printGeneratedPassword(cmd.OutOrStdout(), dir, pw); err != nil {
+					return err
+				}
+			}
+			if rcpts != nil {
+				if _, err := EncryptSecrets(path.Join(dir, SecretsDirName), rcpts); err != nil {
+					return fmt.Errorf("encrypting secrets: %w", err)
+				}
+			}
+			return nil
+		}
+
+		if *inventory != "" {
+			if *interactive || *answersFileName != "" {
+				return fmt.Errorf("the setup wizard can not be used together with the inventory flag")
+			}
+			inv, err := config.ReadInventory(*inventory)
+			if err != nil {
+				return err
+			}
+			return config.RunInventory(cmd.OutOrStdout(), inv, func(instance config.Instance) error {
+				c := append(append([][]byte{}, configFiles...), instance.ConfigFiles()...)
+				return setup(instance.Directory, append(c, flagConfigFiles...))
+			})
 		}
 
-		var configFiles [][]byte
-		if len(*configFileNames) > 0 {
-			for _, configFileName := range *configFileNames {
-				fc, err := os.ReadFile(configFileName)
+		dir := args[0]
+		if *interactive || *answersFileName != "" {
+			var given map[string]string
+			if *answersFileName != "" {
+				given, err = ReadWizardAnswers(*answersFileName)
 				if err != nil {
-					return fmt.Errorf("reading file %q: %w", configFileName, err)
+					return err
 				}
-				configFiles = append(configFiles, fc)
+			}
+			answers, err := AskWizard(cmd.InOrStdin(), cmd.OutOrStdout(), given, *interactive)
+			if err != nil {
+				return fmt.Errorf("running setup wizard: %w", err)
+			}
+			wizardConfig, err := Wizard(dir, *force, answers)
+			if err != nil {
+				return fmt.Errorf("running Wizard(): %w", err)
+			}
+			configFiles = append(configFiles, wizardConfig)
+			if answers.SuperadminPassword != "" {
+				if superadmin.generate || superadmin.password != nil {
+					return fmt.Errorf("the superadmin password is given to the setup wizard and with a flag")
+				}
+				superadmin.password = []byte(answers.SuperadminPassword)
 			}
 		}
 
-		if err := Setup(dir, *force, tplFile, configFiles); err != nil {
-			return fmt.Errorf("running Setup(): %w", err)
-		}
-		return nil
+		return setup(dir, append(configFiles, flagConfigFiles...))
 	}
 	return cmd
 }
@@ -100,23 +217,19 @@ func Cmd() *cobra.Command {
 // directories for database and SSL certs volumes.
 //
 // Existing files are skipped unless force is true. A custom template for the YAML file
-// and YAML configs can be provided.
-func Setup(dir string, force bool, tplFile []byte, configFiles [][]byte) error {
+// and YAML configs can be provided. The superadmin secret gets the given password or
+// DefaultSuperadminPassword if it is nil.
+func Setup(dir string, force bool, tplFile []byte, configFiles [][]byte, superadminPassword []byte) error {
 	// Create directory
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return fmt.Errorf("creating directory at %q: %w", dir, err)
 	}
 
-	// Create YAML file
 	cfg, err := config.NewYmlConfig(configFiles)
 	if err != nil {
 		return fmt.Errorf("creating new YML config object: %w", err)
 	}
 
-	if err := config.CreateYmlFile(dir, force, tplFile, cfg); err != nil {
-		return fmt.Errorf("creating YAML file at %q: %w", dir, err)
-	}
-
 	// Create secrets directory
 	secrDir := path.Join(dir, SecretsDirName)
 	if err := os.MkdirAll(secrDir, subDirPerms); err != nil {
@@ -128,21 +241,35 @@ func Setup(dir string, force bool, tplFile []byte, configFiles [][]byte) error {
 		return fmt.Errorf("creating random secrets: %w", err)
 	}
 
+	// Copy secrets of external database, email server and manage policy
+	if err := copyExternalSecrets(secrDir, cfg); err != nil {
+		return fmt.Errorf("copying external secrets: %w", err)
+	}
+
 	// Create certificates
 	if *cfg.EnableLocalHTTPS {
-		if err := createCerts(secrDir, force); err != nil {
+		if err := createCerts(secrDir, force, cfg); err != nil {
 			return fmt.Errorf("creating certificates: %w", err)
 		}
 	}
 
 	// Create superadmin file
-	if err := shared.CreateFile(secrDir, force, SuperadminFileName, []byte(DefaultSuperadminPassword)); err != nil {
+	if superadminPassword == nil {
+		superadminPassword = []byte(DefaultSuperadminPassword)
+	}
+	if err := createSecretFile(secrDir, force, SuperadminFileName, superadminPassword); err != nil {
 		return fmt.Errorf("creating admin file at %q: %w", dir, err)
 	}
 
+	// Create YAML file
+	// This is done after creating the secrets because some targets embed them.
+	if err := config.CreateYmlFile(dir, force, tplFile, configFiles, cfg); err != nil {
+		return fmt.Errorf("creating YAML file at %q: %w", dir, err)
+	}
+
 	// Create database directory
 	// Attention: For unknown reason it is not possible to use perms 0770 here. Docker Compose does not like it ...
-	if !*cfg.DisablePostgres {
+	if !*cfg.DisablePostgres && cfg.Target != config.TargetKubernetes {
 		if err := os.MkdirAll(path.Join(dir, dbDirName), 0777); err != nil {
 			return fmt.Errorf("creating database directory at %q: %w", dir, err)
 		}
@@ -151,85 +278,73 @@ func Setup(dir string, force bool, tplFile []byte, configFiles [][]byte) error {
 	return nil
 }
 
+// RandomSecretFileNames returns the names of all secrets files which contain
+// random secrets.
+func RandomSecretFileNames() []string {
+	return []string{
+		"auth_token_key",
+		"auth_cookie_key",
+		ManageAuthPasswordFileName,
+		"internal_auth_password",
+		"postgres_password",
+	}
+}
+
 func createRandomSecrets(dir string, force bool) error {
-	secs := []struct {
-		filename string
+	for _, filename := range RandomSecretFileNames() {
+		secrToken, err := RandomSecret()
+		if err != nil {
+			return fmt.Errorf("creating random secret %q: %w", filename, err)
+		}
+		if err := createSecretFile(dir, force, filename, secrToken); err != nil {
+			return fmt.Errorf("creating secret file %q at %q: %w", dir, filename, err)
+		}
+	}
+	return nil
+}
+
+// copyExternalSecrets copies the password file and the CA file of the
+// external database, the password file of the email server and the policy of
+// the manage service to the secrets directory. The files are the source of
+// truth, so existing secrets are always overwritten.
+func copyExternalSecrets(dir string, cfg *config.YmlConfig) error {
+	files := []struct {
+		src  string
+		name string
 	}{
-		{"auth_token_key"},
-		{"auth_cookie_key"},
-		{ManageAuthPasswordFileName},
-		{"internal_auth_password"},
-		{"postgres_password"},
-	}
-	for _, s := range secs {
-		secrToken, err := randomSecret()
+		{cfg.ExternalDatabase.PasswordFile, "postgres_password"},
+		{cfg.ExternalDatabase.CAFile, config.PostgresCAFileName},
+		{cfg.Email.PasswordFile, config.EmailPasswordFileName},
+		{cfg.ManageAuth.PolicyFile, config.ManagePolicyFileName},
+	}
+	for _, f := range files {
+		if f.src == "" {
+			continue
+		}
+		content, err := os.ReadFile(f.src)
 		if err != nil {
-			return fmt.Errorf("creating random secret %q: %w", s.filename, err)
+			return fmt.Errorf("reading file %q: %w", f.src, err)
 		}
-		if err := shared.CreateFile(dir, force, s.filename, secrToken); err != nil {
-			return fmt.Errorf("creating secret file %q at %q: %w", dir, s.filename, err)
+		if err := createSecretFile(dir, true, f.name, content); err != nil {
+			return fmt.Errorf("creating secret file %q at %q: %w", f.name, dir, err)
 		}
 	}
 	return nil
 }
 
-func randomSecret() ([]byte, error) {
+// RandomSecret returns 32 cryptographically secure random bytes encoded in
+// base64.
+func RandomSecret() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	b64e := base64.NewEncoder(base64.StdEncoding, buf)
-	defer b64e.Close()
 
 	if _, err := io.Copy(b64e, io.LimitReader(rand.Reader, 32)); err != nil {
 		return nil, fmt.Errorf("writing cryptographically secure random base64 encoded bytes: %w", err)
 	}
-
-	return buf.Bytes(), nil
-}
-
-func createCerts(dir string, force bool) error {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return fmt.Errorf("generating key: %w", err)
-	}
-
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
-	if err != nil {
-		return fmt.Errorf("generating serial number: %w", err)
-	}
-	templ := x509.Certificate{
-		SerialNumber:          serialNumber,
-		Subject:               pkix.Name{Organization: []string{"OpenSlides"}},
-		DNSNames:              []string{"localhost"},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(30, 0, 0),
-		KeyUsage:              x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		BasicConstraintsValid: true,
+	// Close flushes the last partial block of the encoder.
+	if err := b64e.Close(); err != nil {
+		return nil, fmt.Errorf("closing base64 encoder: %w", err)
 	}
 
-	certData, err := x509.CreateCertificate(rand.Reader, &templ, &templ, &key.PublicKey, key)
-	if err != nil {
-		return fmt.Errorf("creating certificate data: %w", err)
-	}
-	buf1 := new(bytes.Buffer)
-	if err := pem.Encode(buf1, &pem.Block{Type: "CERTIFICATE", Bytes: certData}); err != nil {
-		return fmt.Errorf("encoding certificate data: %w", err)
-	}
-	if err := shared.CreateFile(dir, force, certCertName, buf1.Bytes()); err != nil {
-		return fmt.Errorf("creating certificate file %q at %q: %w", certCertName, dir, err)
-	}
-
-	keyData, err := x509.MarshalPKCS8PrivateKey(key)
-	if err != nil {
-		return fmt.Errorf("marshalling key: %w", err)
-	}
-	buf2 := new(bytes.Buffer)
-	if err := pem.Encode(buf2, &pem.Block{Type: "PRIVATE KEY", Bytes: keyData}); err != nil {
-		return fmt.Errorf("encoding key data: %w", err)
-	}
-	if err := shared.CreateFile(dir, force, certKeyName, buf2.Bytes()); err != nil {
-		return fmt.Errorf("creating key file %q at %q: %w", certKeyName, dir, err)
-	}
-
-	return nil
+	return buf.Bytes(), nil
 }
@@ -1,14 +1,19 @@
 package setup_test
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
 	"testing"
 
+	"filippo.io/age"
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
 	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
 )
 
 func TestCmd(t *testing.T) {
@@ -185,6 +190,85 @@ defaults:
 		testDirectory(t, testDir, "db-data")
 	})
 
+	t.Run("executing setup.Cmd() with new directory with --target flag", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{testDir, "--target", "kubernetes"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand: %v", err)
+		}
+
+		secDir := path.Join(testDir, setup.SecretsDirName)
+		testFileContains(t, testDir, "kubernetes.yml", "kind: Deployment")
+		testFileContains(t, testDir, "kubernetes.yml", "image: ghcr.io/openslides/openslides/openslides-proxy:latest")
+		testFileContains(t, testDir, "kubernetes.yml", "superadmin: "+base64.StdEncoding.EncodeToString([]byte(setup.DefaultSuperadminPassword)))
+		testKeyFile(t, secDir, "auth_token_key")
+		testKeyFile(t, secDir, "auth_cookie_key")
+		testKeyFile(t, secDir, "manage_auth_password")
+		testPasswordFile(t, secDir, "postgres_password")
+		testContentFile(t, secDir, setup.SuperadminFileName, setup.DefaultSuperadminPassword)
+		if _, err := os.Stat(path.Join(testDir, "docker-compose.yml")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("file docker-compose.yml exists, expected non existance")
+		}
+	})
+
+	t.Run("executing setup.Cmd() with new directory with --encrypt-to flag", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatalf("generating identity: %v", err)
+		}
+
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{testDir, "--encrypt-to", identity.Recipient().String()})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand: %v", err)
+		}
+
+		secDir := path.Join(testDir, setup.SecretsDirName)
+		for _, name := range []string{"auth_token_key", "postgres_password", "cert_key", setup.SuperadminFileName} {
+			if _, err := os.Stat(path.Join(secDir, name)); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("plaintext secret file %q exists, expected non existance", name)
+			}
+			content, err := os.ReadFile(path.Join(secDir, name+".age"))
+			if err != nil {
+				t.Fatalf("reading encrypted secret file: %v", err)
+			}
+			if !shared.IsEncrypted(content) {
+				t.Fatalf("secret file %q is not encrypted", name+".age")
+			}
+		}
+
+		// Running setup again must not create new plaintext secrets.
+		cmd = setup.Cmd()
+		cmd.SetArgs([]string{testDir})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand: %v", err)
+		}
+		if _, err := os.Stat(path.Join(secDir, "auth_token_key")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("plaintext secret file auth_token_key exists, expected non existance")
+		}
+
+		names, err := setup.DecryptSecrets(secDir, []age.Identity{identity})
+		if err != nil {
+			t.Fatalf("decrypting secrets: %v", err)
+		}
+		if len(names) != 8 {
+			t.Fatalf("got %d decrypted secrets, expected 8: %v", len(names), names)
+		}
+		testKeyFile(t, secDir, "auth_token_key")
+		testContentFile(t, secDir, setup.SuperadminFileName, setup.DefaultSuperadminPassword)
+	})
 }
 
 func TestSetupCommon(t *testing.T) {
@@ -195,7 +279,7 @@ func TestSetupCommon(t *testing.T) {
 	defer os.RemoveAll(testDir)
 
 	t.Run("running setup.Setup() and create all stuff in tmp directory", func(t *testing.T) {
-		if err := setup.Setup(testDir, false, nil, nil); err != nil {
+		if err := setup.Setup(testDir, false, nil, nil, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		secDir := path.Join(testDir, setup.SecretsDirName)
@@ -206,6 +290,22 @@ func TestSetupCommon(t *testing.T) {
 		testPasswordFile(t, secDir, "postgres_password")
 		testContentFile(t, secDir, setup.SuperadminFileName, setup.DefaultSuperadminPassword)
 		testDirectory(t, testDir, "db-data")
+		for _, name := range []string{"auth_token_key", "postgres_password", setup.SuperadminFileName} {
+			fi, err := os.Stat(path.Join(secDir, name))
+			if err != nil {
+				t.Fatalf("getting file info of %q: %v", name, err)
+			}
+			if fi.Mode().Perm() != 0640 {
+				t.Fatalf("wrong mode of secret file %q, got %o, expected %o", name, fi.Mode().Perm(), 0640)
+			}
+		}
+		state, err := config.ReadState(testDir)
+		if err != nil {
+			t.Fatalf("reading state failed with error: %v", err)
+		}
+		if state == nil || state.Files["docker-compose.yml"] == "" {
+			t.Fatalf("state file does not contain docker-compose.yml, got %v", state)
+		}
 	})
 
 	t.Run("running setup.Setup() twice without changing existant files", func(t *testing.T) {
@@ -219,7 +319,7 @@ func TestSetupCommon(t *testing.T) {
 			t.Fatalf("writing to file %q: %v", p, err)
 		}
 
-		if err := setup.Setup(testDir, false, nil, nil); err != nil {
+		if err := setup.Setup(testDir, false, nil, nil, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		secDir := path.Join(testDir, setup.SecretsDirName)
@@ -233,7 +333,7 @@ func TestSetupCommon(t *testing.T) {
 	})
 
 	t.Run("running setup.Setup() with force flag with changing existant files", func(t *testing.T) {
-		if err := setup.Setup(testDir, true, nil, nil); err != nil {
+		if err := setup.Setup(testDir, true, nil, nil, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		secDir := path.Join(testDir, setup.SecretsDirName)
@@ -256,7 +356,7 @@ func TestSetupNonExistingSubdirectory(t *testing.T) {
 
 	t.Run("running setup.Setup() and give a previously not existing subdirectory", func(t *testing.T) {
 		dir := path.Join(testDir, "new_directory")
-		if err := setup.Setup(dir, false, nil, nil); err != nil {
+		if err := setup.Setup(dir, false, nil, nil, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		secDir := path.Join(dir, setup.SecretsDirName)
@@ -279,7 +379,7 @@ func TestSetupExternalTemplate(t *testing.T) {
 
 	t.Run("running setup.Setup() and give an external template", func(t *testing.T) {
 		tplText := "test-from-external-template"
-		if err := setup.Setup(testDir, false, []byte(tplText), nil); err != nil {
+		if err := setup.Setup(testDir, false, []byte(tplText), nil, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		secDir := path.Join(testDir, setup.SecretsDirName)
@@ -314,7 +414,7 @@ services:
 		myFileName := "my-filename-ooph1OhShi.yml"
 		c := make([][]byte, 1)
 		c[0] = []byte(customConfig)
-		if err := setup.Setup(testDir, false, nil, c); err != nil {
+		if err := setup.Setup(testDir, false, nil, c, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		secDir := path.Join(testDir, setup.SecretsDirName)
@@ -339,7 +439,7 @@ disablePostgres: true
 		myFileName := "my-filename-eab7iv8Oom.yml"
 		c := make([][]byte, 1)
 		c[0] = []byte(customConfig)
-		if err := setup.Setup(testDir, false, nil, c); err != nil {
+		if err := setup.Setup(testDir, false, nil, c, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		testFileNotContains(t, testDir, myFileName, "image: postgres:11")
@@ -353,7 +453,7 @@ disableDependsOn: true
 		myFileName := "my-filename-Koo0eidifg.yml"
 		c := make([][]byte, 1)
 		c[0] = []byte(customConfig)
-		if err := setup.Setup(testDir, false, nil, c); err != nil {
+		if err := setup.Setup(testDir, false, nil, c, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		testFileNotContains(t, testDir, myFileName, "depends_on")
@@ -370,7 +470,7 @@ defaultEnvironment:
 		myFileName := "my-filename-ieGh8ox0do.yml"
 		c := make([][]byte, 1)
 		c[0] = []byte(customConfig)
-		if err := setup.Setup(testDir, false, nil, c); err != nil {
+		if err := setup.Setup(testDir, false, nil, c, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		testFileContains(t, testDir, myFileName, `FOOOO: "1234567890"`)
@@ -387,7 +487,7 @@ services:
 		myFileName := "my-filename-shoPhie9Ax.yml"
 		c := make([][]byte, 1)
 		c[0] = []byte(customConfig)
-		if err := setup.Setup(testDir, false, nil, c); err != nil {
+		if err := setup.Setup(testDir, false, nil, c, nil); err != nil {
 			t.Fatalf("running Setup() failed with error: %v", err)
 		}
 		testFileContains(t, testDir, myFileName, `KEY_SKRIVESLDIERUFJ: test_iyoe8bahGh`)
@@ -458,7 +558,7 @@ func testKeyFile(t testing.TB, dir, name string) {
 	}
 
 	got := string(content)
-	expected := 40 // 32 bytes base64 encoded give 40 characters
+	expected := 44 // 32 bytes base64 encoded give 44 characters
 	if len(got) != expected {
 		t.Fatalf("wrong length of key file %q, got %d, expected %d", p, len(got), expected)
 	}
@@ -800,10 +900,109 @@ secrets:
 `, fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
 }
 
+func TestRandomSecret(t *testing.T) {
+	secret, err := setup.RandomSecret()
+	if err != nil {
+		t.Fatalf("creating random secret: %v", err)
+	}
+	if len(secret) != 44 {
+		t.Fatalf("wrong length of random secret %q, got %d, expected 44", secret, len(secret))
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(secret))
+	if err != nil {
+		t.Fatalf("decoding random secret: %v", err)
+	}
+	if len(decoded) != 32 {
+		t.Fatalf("wrong number of random bytes, got %d, expected 32", len(decoded))
+	}
+}
+
 func TestSetupNoDirectory(t *testing.T) {
 	hasErrMsg := "not a directory"
-	err := setup.Setup("setup_test.go", false, nil, nil)
+	err := setup.Setup("setup_test.go", false, nil, nil, nil)
 	if !strings.Contains(err.Error(), hasErrMsg) {
 		t.Fatalf("running Setup() with invalid directory, got error message %q, expected %q", err.Error(), hasErrMsg)
 	}
 }
+
+func TestSetupExternalDatabase(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	t.Run("running setup.Setup() with external database", func(t *testing.T) {
+		passwordFile := path.Join(testDir, "db-password")
+		caFile := path.Join(testDir, "db-ca.pem")
+		if err := os.WriteFile(passwordFile, []byte("my-db-password"), 0600); err != nil {
+			t.Fatalf("writing password file: %v", err)
+		}
+		if err := os.WriteFile(caFile, []byte("my-db-ca"), 0600); err != nil {
+			t.Fatalf("writing CA file: %v", err)
+		}
+		customConfig := fmt.Sprintf(`---
+externalDatabase:
+  host: db.example.com
+  passwordFile: %s
+  caFile: %s
+`, passwordFile, caFile)
+
+		dir := path.Join(testDir, "setup")
+		if err := setup.Setup(dir, false, nil, [][]byte{[]byte(customConfig)}, nil); err != nil {
+			t.Fatalf("running Setup() failed with error: %v", err)
+		}
+		secDir := path.Join(dir, setup.SecretsDirName)
+		testContentFile(t, secDir, "postgres_password", "my-db-password")
+		testContentFile(t, secDir, "postgres_ca", "my-db-ca")
+		if _, err := os.Stat(path.Join(dir, "db-data")); !os.IsNotExist(err) {
+			t.Fatalf("database directory should not exist for an external database, got error %v", err)
+		}
+	})
+}
+
+func TestSetupInventory(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	invFile := path.Join(testDir, "instances.yml")
+	inventory := "instances:\n  - name: org-a\n  - name: org-b\n"
+	if err := os.WriteFile(invFile, []byte(inventory), 0644); err != nil {
+		t.Fatalf("writing inventory: %v", err)
+	}
+
+	t.Run("executing setup.Cmd() with inventory twice", func(t *testing.T) {
+		var passwords []string
+		for i := 0; i < 2; i++ {
+			cmd := setup.Cmd()
+			cmd.SetOut(io.Discard)
+			cmd.SetArgs([]string{"--inventory", invFile})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("executing setup subcommand: %v", err)
+			}
+			content, err := os.ReadFile(path.Join(testDir, "org-b", setup.SecretsDirName, "postgres_password"))
+			if err != nil {
+				t.Fatalf("reading secret: %v", err)
+			}
+			passwords = append(passwords, string(content))
+		}
+		if passwords[0] != passwords[1] {
+			t.Fatalf("rerunning setup with inventory should not change the secrets")
+		}
+		testDirectory(t, path.Join(testDir, "org-a"), "db-data")
+		testContentFile(t, path.Join(testDir, "org-b"), config.InstanceFileName, "---\n# Written by the setup and config commands from the inventory. Changes are\n# overwritten.\nport: \"8001\"\n")
+	})
+
+	t.Run("executing setup.Cmd() with inventory and directory", func(t *testing.T) {
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{testDir, "--inventory", invFile})
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("executing setup subcommand with inventory and directory should fail")
+		}
+	})
+}
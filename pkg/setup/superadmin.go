@@ -0,0 +1,107 @@
+package setup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/spf13/cobra"
+)
+
+const (
+	superadminPasswordLength = 20
+	superadminPasswordChars  = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// superadminPassword is the password for the superadmin secret chosen with the
+// flags of the setup command.
+type superadminPassword struct {
+	// generate is true if a new random password is generated for every
+	// directory.
+	generate bool
+
+	// password is the password read from a file or stdin. It is nil if the
+	// default password is used.
+	password []byte
+}
+
+// flagSuperadminPassword setups the flags for the superadmin password to the
+// given cobra command. The returned function has to be called after the flags
+// are parsed. Stdin can not be used if it is also used by the interactive setup
+// wizard.
+func flagSuperadminPassword(cmd *cobra.Command) func(interactive bool) (*superadminPassword, error) {
+	generate := cmd.Flags().Bool("generate-superadmin-password", false, "generate a random superadmin password instead of the default one and print it once")
+	file := cmd.Flags().String("superadmin-password-file", "", "file with the superadmin password, you can use - to provide it via stdin")
+
+	return func(interactive bool) (*superadminPassword, error) {
+		if *generate && *file != "" {
+			return nil, fmt.Errorf("do not give the generate-superadmin-password flag together with the superadmin-password-file flag")
+		}
+		if interactive && *file == "-" {
+			return nil, fmt.Errorf("the superadmin password can not be read from stdin together with the interactive flag")
+		}
+		if *file == "" {
+			return &superadminPassword{generate: *generate}, nil
+		}
+		pw, err := shared.ReadFromFileOrStdin(*file)
+		if err != nil {
+			return nil, fmt.Errorf("reading superadmin password: %w", err)
+		}
+		pw = bytes.TrimRight(pw, "\r\n")
+		if len(pw) == 0 {
+			return nil, fmt.Errorf("superadmin password in %q is empty", *file)
+		}
+		return &superadminPassword{password: pw}, nil
+	}
+}
+
+// get returns the password for one setup directory.
+func (s *superadminPassword) get() ([]byte, error) {
+	if !s.generate {
+		return s.password, nil
+	}
+	pw, err := RandomPassword()
+	if err != nil {
+		return nil, fmt.Errorf("generating superadmin password: %w", err)
+	}
+	return pw, nil
+}
+
+// RandomPassword returns a cryptographically secure random password which is
+// easy to type. It does not contain characters like l, 1, O and 0.
+func RandomPassword() ([]byte, error) {
+	max := big.NewInt(int64(len(superadminPasswordChars)))
+	pw := make([]byte, superadminPasswordLength)
+	for i := range pw {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return nil, fmt.Errorf("reading random number: %w", err)
+		}
+		pw[i] = superadminPasswordChars[n.Int64()]
+	}
+	return pw, nil
+}
+
+// printGeneratedPassword writes the generated superadmin password to w if it
+// was written to the superadmin secret of the given directory. An existing
+// secret is kept by Setup without force.
+func printGeneratedPassword(w io.Writer, dir string, pw []byte) error {
+	p := path.Join(dir, SecretsDirName, SuperadminFileName)
+	secret, err := os.ReadFile(p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading file %q: %w", p, err)
+	}
+	if !bytes.Equal(secret, pw) {
+		fmt.Fprintf(w, "The superadmin secret in %q already exists, the generated password was not used. Use the force flag to replace it.\n", dir)
+		return nil
+	}
+	fmt.Fprintf(w, "Generated superadmin password for %q: %s\n", dir, pw)
+	fmt.Fprintln(w, "It is only shown once. Store it in a safe place.")
+	return nil
+}
@@ -0,0 +1,93 @@
+package setup_test
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+)
+
+func TestCmdSuperadminPassword(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	dir := path.Join(testDir, "generated")
+	secretFile := path.Join(dir, setup.SecretsDirName, setup.SuperadminFileName)
+	var generated []byte
+
+	t.Run("executing setup.Cmd() with --generate-superadmin-password flag", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		cmd := setup.Cmd()
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{dir, "--generate-superadmin-password"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand: %v", err)
+		}
+		generated, err = os.ReadFile(secretFile)
+		if err != nil {
+			t.Fatalf("reading superadmin secret failed: %v", err)
+		}
+		if len(generated) != 20 || string(generated) == setup.DefaultSuperadminPassword {
+			t.Fatalf("got superadmin password %q, expected 20 random characters", generated)
+		}
+		if !strings.Contains(out.String(), string(generated)) {
+			t.Fatalf("got output %q, expected the generated password", out.String())
+		}
+	})
+
+	t.Run("executing setup.Cmd() with --generate-superadmin-password flag again", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		cmd := setup.Cmd()
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{dir, "--generate-superadmin-password"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand: %v", err)
+		}
+		testContentFile(t, path.Join(dir, setup.SecretsDirName), setup.SuperadminFileName, string(generated))
+		if !strings.Contains(out.String(), "was not used") {
+			t.Fatalf("got output %q, expected hint that the generated password was not used", out.String())
+		}
+	})
+
+	t.Run("executing setup.Cmd() with --superadmin-password-file flag", func(t *testing.T) {
+		pwFile := path.Join(testDir, "password")
+		if err := os.WriteFile(pwFile, []byte("my-password\n"), 0600); err != nil {
+			t.Fatalf("writing password file failed: %v", err)
+		}
+		dir := path.Join(testDir, "file")
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{dir, "--superadmin-password-file", pwFile})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand: %v", err)
+		}
+		testContentFile(t, path.Join(dir, setup.SecretsDirName), setup.SuperadminFileName, "my-password")
+	})
+
+	t.Run("executing setup.Cmd() with both superadmin password flags", func(t *testing.T) {
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{path.Join(testDir, "both"), "--generate-superadmin-password", "--superadmin-password-file", "-"})
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("executing setup subcommand with both superadmin password flags should fail")
+		}
+	})
+}
+
+func TestRandomPassword(t *testing.T) {
+	pw1, err := setup.RandomPassword()
+	if err != nil {
+		t.Fatalf("running RandomPassword() failed: %v", err)
+	}
+	pw2, err := setup.RandomPassword()
+	if err != nil {
+		t.Fatalf("running RandomPassword() failed: %v", err)
+	}
+	if bytes.Equal(pw1, pw2) {
+		t.Fatalf("running RandomPassword() twice returned the same password %q", pw1)
+	}
+}
@@ -0,0 +1,438 @@
+package setup
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// WizardConfigFileName is the name of the setup configuration YAML file
+	// written by the setup wizard.
+	WizardConfigFileName = "config.yml"
+
+	// HTTPSLocal is the HTTPS mode of the setup wizard for a self-signed
+	// certificate.
+	HTTPSLocal = "local"
+
+	// HTTPSAuto is the HTTPS mode of the setup wizard for a certificate
+	// retrieved via ACME.
+	HTTPSAuto = "auto"
+
+	// HTTPSNone is the HTTPS mode of the setup wizard for running behind an
+	// own reverse proxy which terminates HTTPS.
+	HTTPSNone = "none"
+)
+
+// WizardAnswers contains the answers to the questions of the setup wizard. The
+// JSON tags are the keys of the answers file.
+type WizardAnswers struct {
+	Domain string `json:"domain"`
+	Port   string `json:"port"`
+	HTTPS  string `json:"https"`
+
+	EmailHost         string `json:"emailHost"`
+	EmailPort         string `json:"emailPort"`
+	EmailUser         string `json:"emailUser"`
+	EmailPasswordFile string `json:"emailPasswordFile"`
+	EmailTLSMode      string `json:"emailTLSMode"`
+	EmailFrom         string `json:"emailFrom"`
+
+	DatabaseHost         string `json:"databaseHost"`
+	DatabasePort         string `json:"databasePort"`
+	DatabaseName         string `json:"databaseName"`
+	DatabaseUser         string `json:"databaseUser"`
+	DatabasePasswordFile string `json:"databasePasswordFile"`
+
+	SuperadminPassword string `json:"superadminPassword"`
+}
+
+// question is one question of the setup wizard.
+type question struct {
+	key    string
+	prompt string
+
+	// def returns the default answer. It may depend on earlier answers.
+	def func(a *WizardAnswers) string
+
+	// ask reports whether the question is asked at all. Nil means always.
+	ask func(a *WizardAnswers) bool
+
+	check func(v string) error
+	field func(a *WizardAnswers) *string
+}
+
+func withEmail(a *WizardAnswers) bool    { return a.EmailHost != "" }
+func withDatabase(a *WizardAnswers) bool { return a.DatabaseHost != "" }
+
+func constant(v string) func(a *WizardAnswers) string {
+	return func(a *WizardAnswers) string { return v }
+}
+
+// questions contains all questions of the setup wizard in the order they are
+// asked.
+var questions = []question{
+	{
+		key:    "domain",
+		prompt: "Domain or IP address of your OpenSlides instance",
+		def:    constant("localhost"),
+		check:  checkNotEmpty,
+		field:  func(a *WizardAnswers) *string { return &a.Domain },
+	},
+	{
+		key:    "https",
+		prompt: fmt.Sprintf("HTTPS mode (%s: self-signed certificate, %s: certificate via ACME, %s: HTTP behind your own reverse proxy)", HTTPSLocal, HTTPSAuto, HTTPSNone),
+		def:    constant(HTTPSLocal),
+		check:  checkOneOf(HTTPSLocal, HTTPSAuto, HTTPSNone),
+		field:  func(a *WizardAnswers) *string { return &a.HTTPS },
+	},
+	{
+		key:    "port",
+		prompt: "Port of the proxy service on the host",
+		def: func(a *WizardAnswers) string {
+			if a.HTTPS == HTTPSAuto {
+				return "443"
+			}
+			return "8000"
+		},
+		check: checkWizardPort,
+		field: func(a *WizardAnswers) *string { return &a.Port },
+	},
+	{
+		key:    "emailHost",
+		prompt: "Email server (leave empty to disable email)",
+		def:    constant(""),
+		field:  func(a *WizardAnswers) *string { return &a.EmailHost },
+	},
+	{
+		key:    "emailPort",
+		prompt: "Port of the email server",
+		def:    constant("465"),
+		ask:    withEmail,
+		check:  checkWizardPort,
+		field:  func(a *WizardAnswers) *string { return &a.EmailPort },
+	},
+	{
+		key:    "emailUser",
+		prompt: "User of the email server (leave empty for none)",
+		def:    constant(""),
+		ask:    withEmail,
+		field:  func(a *WizardAnswers) *string { return &a.EmailUser },
+	},
+	{
+		key:    "emailPasswordFile",
+		prompt: "File with the password of the email server user",
+		def:    constant(""),
+		ask:    func(a *WizardAnswers) bool { return withEmail(a) && a.EmailUser != "" },
+		field:  func(a *WizardAnswers) *string { return &a.EmailPasswordFile },
+	},
+	{
+		key:    "emailTLSMode",
+		prompt: "TLS mode of the email server (tls, starttls or none)",
+		def:    constant("tls"),
+		ask:    withEmail,
+		check:  checkOneOf("tls", "starttls", "none"),
+		field:  func(a *WizardAnswers) *string { return &a.EmailTLSMode },
+	},
+	{
+		key:    "emailFrom",
+		prompt: "Sender address of emails",
+		def:    func(a *WizardAnswers) string { return "noreply@" + a.Domain },
+		ask:    withEmail,
+		check:  checkNotEmpty,
+		field:  func(a *WizardAnswers) *string { return &a.EmailFrom },
+	},
+	{
+		key:    "databaseHost",
+		prompt: "External database server (leave empty to use the postgres service)",
+		def:    constant(""),
+		field:  func(a *WizardAnswers) *string { return &a.DatabaseHost },
+	},
+	{
+		key:    "databasePort",
+		prompt: "Port of the database server",
+		def:    constant("5432"),
+		ask:    withDatabase,
+		check:  checkWizardPort,
+		field:  func(a *WizardAnswers) *string { return &a.DatabasePort },
+	},
+	{
+		key:    "databaseName",
+		prompt: "Name of the database",
+		def:    constant("openslides"),
+		ask:    withDatabase,
+		check:  checkNotEmpty,
+		field:  func(a *WizardAnswers) *string { return &a.DatabaseName },
+	},
+	{
+		key:    "databaseUser",
+		prompt: "User of the database",
+		def:    constant("openslides"),
+		ask:    withDatabase,
+		check:  checkNotEmpty,
+		field:  func(a *WizardAnswers) *string { return &a.DatabaseUser },
+	},
+	{
+		key:    "databasePasswordFile",
+		prompt: "File with the password of the database user (leave empty to create a random password)",
+		def:    constant(""),
+		ask:    withDatabase,
+		field:  func(a *WizardAnswers) *string { return &a.DatabasePasswordFile },
+	},
+	{
+		key:    "superadminPassword",
+		prompt: "Password of the superadmin (leave empty to keep the default password " + DefaultSuperadminPassword + ")",
+		def:    constant(""),
+		field:  func(a *WizardAnswers) *string { return &a.SuperadminPassword },
+	},
+}
+
+func checkNotEmpty(v string) error {
+	if v == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
+
+func checkWizardPort(v string) error {
+	port, err := strconv.Atoi(v)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("%q is not a valid port number", v)
+	}
+	return nil
+}
+
+func checkOneOf(values ...string) func(v string) error {
+	return func(v string) error {
+		for _, allowed := range values {
+			if v == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %q", v, values)
+	}
+}
+
+// ReadWizardAnswers reads the given answers file. It is a YAML file which maps
+// the keys of the questions to the answers.
+func ReadWizardAnswers(filename string) (map[string]string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %q: %w", filename, err)
+	}
+	var given map[string]string
+	if err := yaml.Unmarshal(content, &given); err != nil {
+		return nil, fmt.Errorf("unmarshaling answers file %q: %w", filename, err)
+	}
+	return given, nil
+}
+
+// AskWizard asks the questions of the setup wizard. Questions which are
+// answered in given are not asked. If interactive is true, the other questions
+// are written to w and the answers are read line by line from r. An empty line
+// takes the default. Otherwise the defaults are used.
+func AskWizard(r io.Reader, w io.Writer, given map[string]string, interactive bool) (*WizardAnswers, error) {
+	known := make(map[string]bool)
+	for _, q := range questions {
+		known[q.key] = true
+	}
+	var unknown []string
+	for key := range given {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown answers %q", unknown)
+	}
+
+	a := new(WizardAnswers)
+	br := bufio.NewReader(r)
+	for _, q := range questions {
+		if q.ask != nil && !q.ask(a) {
+			continue
+		}
+		def := q.def(a)
+
+		v, ok := given[q.key]
+		switch {
+		case ok:
+			if q.check != nil {
+				if err := q.check(v); err != nil {
+					return nil, fmt.Errorf("answer %q: %w", q.key, err)
+				}
+			}
+
+		case interactive:
+			var err error
+			v, err = askQuestion(br, w, q, def)
+			if err != nil {
+				return nil, fmt.Errorf("asking for %q: %w", q.key, err)
+			}
+
+		default:
+			v = def
+		}
+		*q.field(a) = v
+	}
+	return a, nil
+}
+
+// askQuestion asks the given question until the answer is valid.
+func askQuestion(r *bufio.Reader, w io.Writer, q question, def string) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(w, "%s [%s]: ", q.prompt, def)
+		} else {
+			fmt.Fprintf(w, "%s: ", q.prompt)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			return "", fmt.Errorf("reading answer: %w", err)
+		}
+		v := strings.TrimSpace(line)
+		if v == "" {
+			v = def
+		}
+		if q.check == nil {
+			return v, nil
+		}
+		if err := q.check(v); err != nil {
+			fmt.Fprintf(w, "Invalid answer: %v\n", err)
+			continue
+		}
+		return v, nil
+	}
+}
+
+// WizardConfig returns the commented setup configuration YAML file for the
+// given answers. The superadmin password is not part of it.
+func WizardConfig(a *WizardAnswers) []byte {
+	b := new(strings.Builder)
+	b.WriteString(`---
+# Setup configuration created by the setup wizard. You can change it and
+# (re)create the container configuration YAML file with
+#
+#   $ ./openslides config --config ` + WizardConfigFileName + ` .
+#
+# See the default setup configuration YAML file for all options.
+
+# The OpenSlides proxy service listens on this port.
+`)
+	fmt.Fprintf(b, "port: %s\n", a.Port)
+
+	switch a.HTTPS {
+	case HTTPSLocal:
+		b.WriteString("\n# HTTPS with a self-signed certificate created by the setup command.\n")
+		b.WriteString("enableLocalHTTPS: true\nenableAutoHTTPS: false\ncertificate:\n")
+		// The certificate always covers localhost, the default address of the
+		// manage client commands.
+		fmt.Fprintf(b, "  dnsNames:\n    - %s\n", quote("localhost"))
+		if net.ParseIP(a.Domain) != nil {
+			fmt.Fprintf(b, "  ipAddresses:\n    - %s\n", quote(a.Domain))
+		} else if a.Domain != "localhost" {
+			fmt.Fprintf(b, "    - %s\n", quote(a.Domain))
+		}
+
+	case HTTPSAuto:
+		b.WriteString("\n# HTTPS with a certificate retrieved via ACME. The proxy service listens on\n")
+		b.WriteString("# all interfaces and has to be reachable under the domain.\n")
+		b.WriteString("host: 0.0.0.0\nenableLocalHTTPS: false\nenableAutoHTTPS: true\n")
+
+	case HTTPSNone:
+		b.WriteString("\n# No HTTPS. Use this only behind your own reverse proxy which terminates\n")
+		b.WriteString("# HTTPS.\n")
+		b.WriteString("enableLocalHTTPS: false\nenableAutoHTTPS: false\n")
+	}
+
+	systemURL := a.Domain
+	if a.HTTPS != HTTPSAuto && a.Port != "443" {
+		systemURL = net.JoinHostPort(a.Domain, a.Port)
+	}
+	b.WriteString("\n# The URL is used in PDF and email templates.\n")
+	fmt.Fprintf(b, "defaultEnvironment:\n  SYSTEM_URL: %s\n", quote(systemURL))
+
+	if a.DatabaseHost != "" {
+		b.WriteString("\n# External database server instead of the postgres service. An empty\n")
+		b.WriteString("# passwordFile means a random password is created (secrets/postgres_password)\n")
+		b.WriteString("# which you have to set for the database user.\n")
+		b.WriteString("externalDatabase:\n")
+		fmt.Fprintf(b, "  host: %s\n", quote(a.DatabaseHost))
+		fmt.Fprintf(b, "  port: %s\n", a.DatabasePort)
+		fmt.Fprintf(b, "  name: %s\n", quote(a.DatabaseName))
+		fmt.Fprintf(b, "  user: %s\n", quote(a.DatabaseUser))
+		fmt.Fprintf(b, "  passwordFile: %s\n", quote(a.DatabasePasswordFile))
+	}
+
+	if a.EmailHost != "" {
+		b.WriteString("\n# Email server of the backend. The password file is copied to the secrets\n")
+		b.WriteString("# directory (secrets/email_password). Check the settings with the command\n")
+		b.WriteString("# \"email test\".\n")
+		b.WriteString("email:\n")
+		fmt.Fprintf(b, "  host: %s\n", quote(a.EmailHost))
+		fmt.Fprintf(b, "  port: %s\n", a.EmailPort)
+		fmt.Fprintf(b, "  tlsMode: %s\n", a.EmailTLSMode)
+		if a.EmailUser != "" {
+			fmt.Fprintf(b, "  user: %s\n", quote(a.EmailUser))
+			fmt.Fprintf(b, "  passwordFile: %s\n", quote(a.EmailPasswordFile))
+		}
+		fmt.Fprintf(b, "  from: %s\n", quote(a.EmailFrom))
+	}
+
+	if a.HTTPS == HTTPSAuto {
+		b.WriteString("\nservices:\n")
+		b.WriteString("  proxy:\n    environment:\n")
+		fmt.Fprintf(b, "      EXTERNAL_ADDRESS: %s\n", quote(a.Domain))
+		b.WriteString("      # Use letsencrypt staging environment for testing\n")
+		b.WriteString("      # ACME_ENDPOINT: https://acme-staging-v02.api.letsencrypt.org/directory\n")
+	}
+	return []byte(b.String())
+}
+
+// quote returns the given string as double quoted YAML scalar.
+func quote(s string) string {
+	// JSON strings are valid YAML.
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// Wizard writes the setup configuration YAML file for the given answers to the
+// given directory. It returns the content of the file which has to be used for
+// Setup. An existing file is only overwritten if force is true.
+func Wizard(dir string, force bool, a *WizardAnswers) ([]byte, error) {
+	content := WizardConfig(a)
+	if err := config.Validate(WizardConfigFileName, content); err != nil {
+		return nil, fmt.Errorf("validating generated config: %w", err)
+	}
+	if _, err := config.NewYmlConfig([][]byte{content}); err != nil {
+		return nil, fmt.Errorf("checking generated config: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("creating directory at %q: %w", dir, err)
+	}
+	p := path.Join(dir, WizardConfigFileName)
+	if _, err := os.Stat(p); err == nil && !force {
+		return nil, fmt.Errorf("file %q already exists, use the force flag to overwrite it", p)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("checking existance of file %q: %w", p, err)
+	}
+	if err := shared.CreateFile(dir, true, WizardConfigFileName, content); err != nil {
+		return nil, fmt.Errorf("creating config file: %w", err)
+	}
+	return content, nil
+}
@@ -0,0 +1,215 @@
+package setup_test
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/OpenSlides/openslides-manage-service/pkg/config"
+	"github.com/OpenSlides/openslides-manage-service/pkg/setup"
+)
+
+func TestAskWizard(t *testing.T) {
+	t.Run("running setup.AskWizard() without answers", func(t *testing.T) {
+		a, err := setup.AskWizard(strings.NewReader(""), new(bytes.Buffer), nil, false)
+		if err != nil {
+			t.Fatalf("running AskWizard() failed with error: %v", err)
+		}
+		if a.Domain != "localhost" || a.Port != "8000" || a.HTTPS != setup.HTTPSLocal {
+			t.Fatalf("wrong defaults, got %+v", a)
+		}
+		if a.EmailHost != "" || a.DatabaseHost != "" || a.SuperadminPassword != "" {
+			t.Fatalf("email, database and superadmin password should be empty, got %+v", a)
+		}
+	})
+
+	t.Run("running setup.AskWizard() interactively", func(t *testing.T) {
+		input := strings.Join([]string{
+			"openslides.example.com", // domain
+			"auto",                   // https
+			"",                       // port
+			"mail.example.com",       // emailHost
+			"587",                    // emailPort
+			"",                       // emailUser
+			"invalid",                // emailTLSMode
+			"starttls",               // emailTLSMode again
+			"",                       // emailFrom
+			"",                       // databaseHost
+			"secret",                 // superadminPassword
+		}, "\n")
+		out := new(bytes.Buffer)
+		a, err := setup.AskWizard(strings.NewReader(input), out, nil, true)
+		if err != nil {
+			t.Fatalf("running AskWizard() failed with error: %v", err)
+		}
+		expected := setup.WizardAnswers{
+			Domain:             "openslides.example.com",
+			HTTPS:              setup.HTTPSAuto,
+			Port:               "443",
+			EmailHost:          "mail.example.com",
+			EmailPort:          "587",
+			EmailTLSMode:       "starttls",
+			EmailFrom:          "noreply@openslides.example.com",
+			SuperadminPassword: "secret",
+		}
+		if *a != expected {
+			t.Fatalf("wrong answers, expected %+v, got %+v", expected, *a)
+		}
+		if !strings.Contains(out.String(), "Invalid answer") {
+			t.Fatalf("got output %q, expected hint for invalid answer", out.String())
+		}
+	})
+
+	t.Run("running setup.AskWizard() interactively with too few lines", func(t *testing.T) {
+		if _, err := setup.AskWizard(strings.NewReader("example.com\n"), new(bytes.Buffer), nil, true); err == nil {
+			t.Fatalf("running AskWizard() with too few lines should fail")
+		}
+	})
+
+	t.Run("running setup.AskWizard() with invalid answer", func(t *testing.T) {
+		given := map[string]string{"port": "http"}
+		if _, err := setup.AskWizard(strings.NewReader(""), new(bytes.Buffer), given, false); err == nil {
+			t.Fatalf("running AskWizard() with invalid port should fail")
+		}
+	})
+
+	t.Run("running setup.AskWizard() with unknown answer", func(t *testing.T) {
+		given := map[string]string{"domian": "example.com"}
+		if _, err := setup.AskWizard(strings.NewReader(""), new(bytes.Buffer), given, false); err == nil {
+			t.Fatalf("running AskWizard() with unknown answer should fail")
+		}
+	})
+}
+
+func TestWizardConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		answers  setup.WizardAnswers
+		contains []string
+	}{
+		{
+			name:     "local HTTPS",
+			answers:  setup.WizardAnswers{Domain: "openslides.example.com", Port: "8000", HTTPS: setup.HTTPSLocal},
+			contains: []string{"enableLocalHTTPS: true", "dnsNames:\n    - \"localhost\"\n    - \"openslides.example.com\"\n", `SYSTEM_URL: "openslides.example.com:8000"`},
+		},
+		{
+			name:     "local HTTPS with IP address",
+			answers:  setup.WizardAnswers{Domain: "192.168.0.10", Port: "8000", HTTPS: setup.HTTPSLocal},
+			contains: []string{"dnsNames:\n    - \"localhost\"\n", "ipAddresses:\n    - \"192.168.0.10\"\n"},
+		},
+		{
+			name:     "local HTTPS with localhost",
+			answers:  setup.WizardAnswers{Domain: "localhost", Port: "8000", HTTPS: setup.HTTPSLocal},
+			contains: []string{"dnsNames:\n    - \"localhost\"\n\n# The URL"},
+		},
+		{
+			name:     "auto HTTPS",
+			answers:  setup.WizardAnswers{Domain: "openslides.example.com", Port: "443", HTTPS: setup.HTTPSAuto},
+			contains: []string{"enableAutoHTTPS: true", "host: 0.0.0.0", `EXTERNAL_ADDRESS: "openslides.example.com"`, `SYSTEM_URL: "openslides.example.com"`},
+		},
+		{
+			name: "no HTTPS with email and external database",
+			answers: setup.WizardAnswers{
+				Domain:            "openslides.example.com",
+				Port:              "8000",
+				HTTPS:             setup.HTTPSNone,
+				EmailHost:         "mail.example.com",
+				EmailPort:         "465",
+				EmailUser:         "user",
+				EmailPasswordFile: `pass"word.txt`,
+				EmailTLSMode:      "tls",
+				EmailFrom:         "os@example.com",
+				DatabaseHost:      "db.example.com",
+				DatabasePort:      "5432",
+				DatabaseName:      "openslides",
+				DatabaseUser:      "openslides",
+			},
+			contains: []string{"enableLocalHTTPS: false", `passwordFile: "pass\"word.txt"`, "tlsMode: tls", `host: "db.example.com"`},
+		},
+	} {
+		t.Run("running setup.WizardConfig() with "+tt.name, func(t *testing.T) {
+			content := setup.WizardConfig(&tt.answers)
+			if err := config.Validate("wizard", content); err != nil {
+				t.Fatalf("generated config is invalid: %v\n%s", err, content)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(string(content), s) {
+					t.Fatalf("generated config does not contain %q:\n%s", s, content)
+				}
+			}
+		})
+	}
+}
+
+func TestCmdWizard(t *testing.T) {
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	answersFile := path.Join(testDir, "answers.yml")
+	answers := "---\ndomain: openslides.example.com\nport: 8443\nsuperadminPassword: my-password\n"
+	if err := os.WriteFile(answersFile, []byte(answers), 0666); err != nil {
+		t.Fatalf("writing answers file failed: %v", err)
+	}
+	dir := path.Join(testDir, "instance")
+
+	t.Run("executing setup.Cmd() with --answers flag", func(t *testing.T) {
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{dir, "--answers", answersFile})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("executing setup subcommand: %v", err)
+		}
+
+		secDir := path.Join(dir, setup.SecretsDirName)
+		testContentFile(t, secDir, setup.SuperadminFileName, "my-password")
+		testKeyFile(t, secDir, "auth_token_key")
+
+		content, err := os.ReadFile(path.Join(dir, setup.WizardConfigFileName))
+		if err != nil {
+			t.Fatalf("reading wizard config failed: %v", err)
+		}
+		if !strings.Contains(string(content), "port: 8443") {
+			t.Fatalf("wizard config does not contain the port:\n%s", content)
+		}
+		yml, err := os.ReadFile(path.Join(dir, "docker-compose.yml"))
+		if err != nil {
+			t.Fatalf("reading docker-compose.yml failed: %v", err)
+		}
+		if !strings.Contains(string(yml), "127.0.0.1:8443:8000") {
+			t.Fatalf("docker-compose.yml does not use the port of the wizard")
+		}
+	})
+
+	t.Run("executing setup.Cmd() with --answers flag again", func(t *testing.T) {
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{dir, "--answers", answersFile})
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("executing setup subcommand should fail because the config file exists")
+		}
+	})
+
+	t.Run("executing setup.Cmd() with email user without TLS", func(t *testing.T) {
+		answersFile := path.Join(testDir, "answers-email.yml")
+		answers := "---\ndomain: openslides.example.com\nemailHost: mail.example.com\nemailUser: openslides\nemailTLSMode: none\n"
+		if err := os.WriteFile(answersFile, []byte(answers), 0666); err != nil {
+			t.Fatalf("writing answers file failed: %v", err)
+		}
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{path.Join(testDir, "instance-email"), "--answers", answersFile})
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("executing setup subcommand should fail because the password would be sent unencrypted")
+		}
+	})
+
+	t.Run("executing setup.Cmd() with --answers and --inventory flag", func(t *testing.T) {
+		cmd := setup.Cmd()
+		cmd.SetArgs([]string{"--inventory", path.Join(testDir, "inventory.yml"), "--answers", answersFile})
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("executing setup subcommand with wizard and inventory should fail")
+		}
+	})
+}
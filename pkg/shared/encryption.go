@@ -0,0 +1,165 @@
+package shared
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	// EncryptedSuffix is appended to the name of encrypted secret files.
+	EncryptedSuffix = ".age"
+
+	// IdentityFileEnv is the name of the environment variable with the path to
+	// an age identity file used to decrypt secret files.
+	IdentityFileEnv = "OPENSLIDES_SECRETS_IDENTITY_FILE"
+
+	// PassphraseEnv is the name of the environment variable with the
+	// passphrase used to encrypt and decrypt secret files.
+	PassphraseEnv = "OPENSLIDES_SECRETS_PASSPHRASE"
+
+	ageBinaryHeader = "age-encryption.org/v1"
+)
+
+// Recipients returns the age recipients for the given X25519 public keys
+// (age1...) and passphrase. An empty passphrase is ignored. A passphrase can
+// not be combined with public keys.
+func Recipients(publicKeys []string, passphrase string) ([]age.Recipient, error) {
+	if passphrase != "" {
+		if len(publicKeys) > 0 {
+			return nil, fmt.Errorf("a passphrase can not be combined with public keys")
+		}
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("creating passphrase recipient: %w", err)
+		}
+		return []age.Recipient{r}, nil
+	}
+
+	var recipients []age.Recipient
+	for _, k := range publicKeys {
+		r, err := age.ParseX25519Recipient(k)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key %q: %w", k, err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// Identities returns the age identities from the given identity file and
+// passphrase. Empty values are ignored.
+func Identities(identityFile, passphrase string) ([]age.Identity, error) {
+	var identities []age.Identity
+	if identityFile != "" {
+		f, err := os.Open(identityFile)
+		if err != nil {
+			return nil, fmt.Errorf("opening identity file: %w", err)
+		}
+		defer f.Close()
+		ids, err := age.ParseIdentities(f)
+		if err != nil {
+			return nil, fmt.Errorf("parsing identity file %q: %w", identityFile, err)
+		}
+		identities = append(identities, ids...)
+	}
+	if passphrase != "" {
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("creating passphrase identity: %w", err)
+		}
+		identities = append(identities, id)
+	}
+	return identities, nil
+}
+
+// IdentitiesFromEnv returns the age identities given by the environment
+// variables OPENSLIDES_SECRETS_IDENTITY_FILE and OPENSLIDES_SECRETS_PASSPHRASE.
+func IdentitiesFromEnv() ([]age.Identity, error) {
+	return Identities(os.Getenv(IdentityFileEnv), os.Getenv(PassphraseEnv))
+}
+
+// Encrypt encrypts the given content for the given recipients in the ASCII
+// armored age format.
+func Encrypt(content []byte, recipients []age.Recipient) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	aw := armor.NewWriter(buf)
+	w, err := age.Encrypt(aw, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("initializing encryption: %w", err)
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, fmt.Errorf("encrypting content: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("finishing encryption: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return nil, fmt.Errorf("finishing armor: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// IsEncrypted reports whether the given content is in the age format with
+// or without ASCII armor.
+func IsEncrypted(content []byte) bool {
+	s := strings.TrimLeft(string(content), " \t\r\n")
+	return strings.HasPrefix(s, armor.Header) || strings.HasPrefix(s, ageBinaryHeader)
+}
+
+// Decrypt decrypts the given content in the age format with or without ASCII
+// armor using the given identities.
+func Decrypt(content []byte, identities []age.Identity) ([]byte, error) {
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no key given, set %s or %s", IdentityFileEnv, PassphraseEnv)
+	}
+	var src io.Reader = bytes.NewReader(content)
+	if strings.HasPrefix(strings.TrimLeft(string(content), " \t\r\n"), armor.Header) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimLeft(content, " \t\r\n")))
+	}
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting content: %w", err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading decrypted content: %w", err)
+	}
+	return plain, nil
+}
+
+// ReadSecretFile reads the secret file at the given path. If it does not
+// exist, the encrypted file with the suffix .age is used instead. Encrypted
+// content is decrypted with the identities from the environment.
+func ReadSecretFile(p string) ([]byte, error) {
+	content, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		var encErr error
+		content, encErr = os.ReadFile(p + EncryptedSuffix)
+		if encErr == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading secret file %q: %w", p, err)
+	}
+
+	if !IsEncrypted(content) {
+		return content, nil
+	}
+	identities, err := IdentitiesFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("getting key for secret file %q: %w", p, err)
+	}
+	plain, err := Decrypt(content, identities)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secret file %q: %w", p, err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,106 @@
+package shared_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/OpenSlides/openslides-manage-service/pkg/shared"
+)
+
+func TestEncryption(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generating identity: %v", err)
+	}
+	testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+	if err != nil {
+		t.Fatalf("generating temporary directory failed: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	identityFile := path.Join(testDir, "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("writing identity file: %v", err)
+	}
+
+	t.Run("encrypting and decrypting with public key", func(t *testing.T) {
+		recipients, err := shared.Recipients([]string{identity.Recipient().String()}, "")
+		if err != nil {
+			t.Fatalf("parsing recipients: %v", err)
+		}
+		encrypted, err := shared.Encrypt([]byte("my_secret"), recipients)
+		if err != nil {
+			t.Fatalf("encrypting: %v", err)
+		}
+		if !shared.IsEncrypted(encrypted) || strings.Contains(string(encrypted), "my_secret") {
+			t.Fatalf("got %q, expected encrypted content", encrypted)
+		}
+		identities, err := shared.Identities(identityFile, "")
+		if err != nil {
+			t.Fatalf("reading identities: %v", err)
+		}
+		plain, err := shared.Decrypt(encrypted, identities)
+		if err != nil {
+			t.Fatalf("decrypting: %v", err)
+		}
+		if string(plain) != "my_secret" {
+			t.Fatalf("got %q, expected %q", plain, "my_secret")
+		}
+	})
+
+	t.Run("encrypting and decrypting with passphrase", func(t *testing.T) {
+		recipients, err := shared.Recipients(nil, "my_passphrase")
+		if err != nil {
+			t.Fatalf("parsing recipients: %v", err)
+		}
+		encrypted, err := shared.Encrypt([]byte("my_secret"), recipients)
+		if err != nil {
+			t.Fatalf("encrypting: %v", err)
+		}
+		identities, err := shared.Identities("", "my_passphrase")
+		if err != nil {
+			t.Fatalf("reading identities: %v", err)
+		}
+		plain, err := shared.Decrypt(encrypted, identities)
+		if err != nil {
+			t.Fatalf("decrypting: %v", err)
+		}
+		if string(plain) != "my_secret" {
+			t.Fatalf("got %q, expected %q", plain, "my_secret")
+		}
+	})
+
+	t.Run("combining passphrase and public key", func(t *testing.T) {
+		if _, err := shared.Recipients([]string{identity.Recipient().String()}, "my_passphrase"); err == nil {
+			t.Fatalf("combining passphrase and public key should fail")
+		}
+	})
+
+	t.Run("reading encrypted secret file with shared.AuthSecret()", func(t *testing.T) {
+		encrypted, err := shared.Encrypt([]byte("my_password"), []age.Recipient{identity.Recipient()})
+		if err != nil {
+			t.Fatalf("encrypting: %v", err)
+		}
+		pwFile := path.Join(testDir, "manage_auth_password")
+		if err := os.WriteFile(pwFile+shared.EncryptedSuffix, encrypted, 0600); err != nil {
+			t.Fatalf("writing encrypted file: %v", err)
+		}
+
+		t.Setenv(shared.IdentityFileEnv, "")
+		t.Setenv(shared.PassphraseEnv, "")
+		if _, err := shared.AuthSecret(pwFile, "false"); err == nil || !strings.Contains(err.Error(), "no key given") {
+			t.Fatalf("got error %v, expected missing key", err)
+		}
+
+		t.Setenv(shared.IdentityFileEnv, identityFile)
+		pw, err := shared.AuthSecret(pwFile, "false")
+		if err != nil {
+			t.Fatalf("running shared.AuthSecret(): %v", err)
+		}
+		if string(pw) != "my_password" {
+			t.Fatalf("got %q, expected %q", pw, "my_password")
+		}
+	})
+}
@@ -24,9 +24,34 @@ const AuthHeader = "authorization"
 
 const fileMode fs.FileMode = 0666
 
+// secretFileMode is the mode of files containing secrets. Docker Compose
+// mounts them with this mode, so the group may read them for services which
+// run with another user.
+const secretFileMode fs.FileMode = 0640
+
+// privateFileMode is the mode of files containing secrets which are never
+// mounted into a container. Only the owner may read them.
+const privateFileMode fs.FileMode = 0600
+
 // CreateFile creates a file in the given directory with the given content.
 // Use a truthy value for force to override an existing file.
 func CreateFile(dir string, force bool, name string, content []byte) error {
+	return createFile(dir, force, name, content, fileMode)
+}
+
+// CreateSecretFile creates a file like CreateFile but only the owner and the
+// group may read it. The mode of an existing file is changed, too.
+func CreateSecretFile(dir string, force bool, name string, content []byte) error {
+	return createFile(dir, force, name, content, secretFileMode)
+}
+
+// CreatePrivateFile creates a file like CreateFile but only the owner may read
+// it. The mode of an existing file is changed, too.
+func CreatePrivateFile(dir string, force bool, name string, content []byte) error {
+	return createFile(dir, force, name, content, privateFileMode)
+}
+
+func createFile(dir string, force bool, name string, content []byte, mode fs.FileMode) error {
 	p := path.Join(dir, name)
 
 	pExists, err := fileExists(p)
@@ -38,7 +63,14 @@ func CreateFile(dir string, force bool, name string, content []byte) error {
 		return nil
 	}
 
-	if err := os.WriteFile(p, content, fileMode); err != nil {
+	if pExists && mode != fileMode {
+		// os.WriteFile does not change the mode of an existing file, so the
+		// content must not be written before the mode is changed.
+		if err := os.Chmod(p, mode); err != nil {
+			return fmt.Errorf("changing mode of file %q: %w", p, err)
+		}
+	}
+	if err := os.WriteFile(p, content, mode); err != nil {
 		return fmt.Errorf("creating and writing to file %q: %w", p, err)
 	}
 	return nil
@@ -99,16 +131,16 @@ func ReadFromFileOrStdin(filename string) ([]byte, error) {
 
 // AuthSecret returns a secret using the secret file as given in
 // environment variable. In case of development it uses the development
-// password.
+// password. Encrypted secret files are decrypted, see ReadSecretFile.
 func AuthSecret(pwFile string, devEnv string) ([]byte, error) {
 	if dev, _ := strconv.ParseBool(devEnv); dev {
 		// Error value does not matter here. In case of an error dev is false and
 		// this is the expected behavior.
 		return []byte(developmentPassword), nil
 	}
-	pw, err := os.ReadFile(pwFile)
+	pw, err := ReadSecretFile(pwFile)
 	if err != nil {
-		return nil, fmt.Errorf("reading secret file %q: %w", pwFile, err)
+		return nil, err
 	}
 	return pw, nil
 }
@@ -76,6 +76,35 @@ func TestCreateFile(t *testing.T) {
 	})
 }
 
+func TestCreateSecretFile(t *testing.T) {
+	t.Run("running shared.CreateSecretFile() on existing file with force true", func(t *testing.T) {
+		testDir, err := os.MkdirTemp("", "openslides-manage-service-")
+		if err != nil {
+			t.Fatalf("generating temporary directory failed: %v", err)
+		}
+		defer os.RemoveAll(testDir)
+		fileName := "test_file_eeGhu6du_7"
+		content := "test_content_kohv2EoT_7"
+		if err := shared.CreateFile(testDir, false, fileName, []byte(content)); err != nil {
+			t.Fatalf("running shared.CreateFile() failed: %v", err)
+		}
+		content = "test_content_kohv2EoT_7b"
+
+		if err := shared.CreateSecretFile(testDir, true, fileName, []byte(content)); err != nil {
+			t.Fatalf("running shared.CreateSecretFile() failed: %v", err)
+		}
+
+		testContentFile(t, testDir, fileName, content)
+		fi, err := os.Stat(path.Join(testDir, fileName))
+		if err != nil {
+			t.Fatalf("getting file info: %v", err)
+		}
+		if fi.Mode().Perm() != 0640 {
+			t.Fatalf("wrong mode of secret file, got %o, expected %o", fi.Mode().Perm(), 0640)
+		}
+	})
+}
+
 func testContentFile(t testing.TB, dir, name, expected string) {
 	t.Helper()
 
@@ -27,6 +27,7 @@ type ManageClient interface {
 	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
 	Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error)
 	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+	SendTestEmail(ctx context.Context, in *SendTestEmailRequest, opts ...grpc.CallOption) (*SendTestEmailResponse, error)
 }
 
 type manageClient struct {
@@ -118,6 +119,15 @@ func (c *manageClient) Health(ctx context.Context, in *HealthRequest, opts ...gr
 	return out, nil
 }
 
+func (c *manageClient) SendTestEmail(ctx context.Context, in *SendTestEmailRequest, opts ...grpc.CallOption) (*SendTestEmailResponse, error) {
+	out := new(SendTestEmailResponse)
+	err := c.cc.Invoke(ctx, "/Manage/SendTestEmail", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ManageServer is the server API for Manage service.
 // All implementations should embed UnimplementedManageServer
 // for forward compatibility
@@ -131,6 +141,7 @@ type ManageServer interface {
 	Set(context.Context, *SetRequest) (*SetResponse, error)
 	Version(context.Context, *VersionRequest) (*VersionResponse, error)
 	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+	SendTestEmail(context.Context, *SendTestEmailRequest) (*SendTestEmailResponse, error)
 }
 
 // UnimplementedManageServer should be embedded to have forward compatible implementations.
@@ -164,6 +175,9 @@ func (UnimplementedManageServer) Version(context.Context, *VersionRequest) (*Ver
 func (UnimplementedManageServer) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
 }
+func (UnimplementedManageServer) SendTestEmail(context.Context, *SendTestEmailRequest) (*SendTestEmailResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendTestEmail not implemented")
+}
 
 // UnsafeManageServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to ManageServer will
@@ -338,6 +352,24 @@ func _Manage_Health_Handler(srv interface{}, ctx context.Context, dec func(inter
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Manage_SendTestEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendTestEmailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManageServer).SendTestEmail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Manage/SendTestEmail",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManageServer).SendTestEmail(ctx, req.(*SendTestEmailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Manage_ServiceDesc is the grpc.ServiceDesc for Manage service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -381,6 +413,10 @@ var Manage_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Health",
 			Handler:    _Manage_Health_Handler,
 		},
+		{
+			MethodName: "SendTestEmail",
+			Handler:    _Manage_SendTestEmail_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/manage.proto",